@@ -0,0 +1,75 @@
+package main
+
+import "fmt"
+
+// anchorPoint is where the nodes inserted at an anchor go, right after last, or at the start of the flow if it's nil.
+type anchorPoint struct {
+	last IBasicFlowNode
+}
+
+// Anchor names the position after the most recently added node, so that nodes can be inserted there later, wherever
+// it has moved to by then.
+func (f *FlowEngine) Anchor(name string) *FlowEngine {
+	if f.anchors == nil {
+		f.anchors = make(map[string]*anchorPoint)
+	}
+	point := new(anchorPoint)
+	if len(f.nodes) != 0 {
+		point.last = f.nodes[len(f.nodes)-1]
+	}
+	f.anchors[name] = point
+	return f
+}
+
+// InsertAtAnchor moves the nodes added by build to the anchor, after the ones inserted there earlier. Nodes inserted
+// between an If and its Else break the branches, so an anchor is better put after the Else.
+func (f *FlowEngine) InsertAtAnchor(name string, build func(flow *FlowEngine)) error {
+	point, ok := f.anchors[name]
+	if !ok {
+		return fmt.Errorf("anchor %q not found", name)
+	}
+	if f.finished {
+		return fmt.Errorf("anchor %q: the flow has run, nodes can't be inserted until Reset", name)
+	}
+	position := 0
+	if point.last != nil {
+		position = f.indexOf(point.last) + 1
+	}
+
+	count := len(f.nodes)
+	build(f)
+	inserted := append([]IBasicFlowNode(nil), f.nodes[count:]...)
+	if len(inserted) == 0 {
+		return nil
+	}
+	nodes := make([]IBasicFlowNode, 0, len(f.nodes))
+	nodes = append(nodes, f.nodes[:position]...)
+	nodes = append(nodes, inserted...)
+	nodes = append(nodes, f.nodes[position:count]...)
+	point.last = inserted[len(inserted)-1]
+
+	f.nodes = f.nodes[:0]
+	for _, node := range nodes {
+		node.SetNext(nil)
+		f.appendNode(node)
+	}
+	return nil
+}
+
+func (e *ElseFlowEngine) Anchor(name string) *ElseFlowEngine {
+	e.invoker.Anchor(name)
+	return e
+}
+
+func (e *ElseFlowEngine) InsertAtAnchor(name string, build func(flow *FlowEngine)) error {
+	return e.invoker.InsertAtAnchor(name, build)
+}
+
+func (f *FlowEngine) indexOf(node IBasicFlowNode) int {
+	for i, current := range f.nodes {
+		if current == node {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestInsertAtAnchorAfterOtherInsertions(t *testing.T) {
+	c := newCalls()
+	flow := NewFlow().
+		Anchor("start").
+		Do(c.fn("load", nil)).
+		Anchor("loaded").
+		Do(c.fn("save", nil)).
+		Anchor("saved")
+	insert := func(anchor string, names ...string) {
+		err := flow.InsertAtAnchor(anchor, func(flow *FlowEngine) {
+			for _, name := range names {
+				flow.Do(c.fn(name, nil))
+			}
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	insert("start", "auth", "audit")
+	insert("saved", "notify")
+	insert("loaded", "validate")
+	insert("loaded", "enrich")
+	insert("start", "trace")
+	if result := flow.Wait(); result.Err != nil {
+		t.Fatal(result.Err)
+	}
+	want := []string{"auth", "audit", "trace", "load", "validate", "enrich", "save", "notify"}
+	if got := c.sequence(); !reflect.DeepEqual(got, want) {
+		t.Errorf("calls %v", got)
+	}
+}
+
+func TestInsertAtAnUnknownAnchor(t *testing.T) {
+	if err := NewFlow().Do(ok).InsertAtAnchor("missing", func(*FlowEngine) {}); err == nil {
+		t.Error("inserted at an anchor which doesn't exist")
+	}
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+func named(data *DataSet, _ *Result) bool {
+	return data.Name != ""
+}
+
+func TestAssertFailsOnFreshData(t *testing.T) {
+	c := newCalls()
+	result := NewFlow().Assert("named", named).SetNote("check").Do(c.fn("after", nil)).Wait()
+	var assertion *AssertionFailedError
+	if !errors.As(result.Err, &assertion) || assertion.Name != "named" || assertion.GetNote() != "check" {
+		t.Fatalf("got %v", result.Err)
+	}
+	if !errors.Is(result.Err, ErrAssertionFailed) || c.count("after") != 0 {
+		t.Errorf("got %v after %v", result.Err, c.sequence())
+	}
+}
+
+func TestAssertThatHoldsLeavesTheResult(t *testing.T) {
+	c := newCalls()
+	flow := NewFlow().Do(setName("Tom")).Assert("named", named).Do(c.fn("after", nil))
+	before := *flow.result
+	if result := flow.Wait(); result != before || c.count("after") != 1 {
+		t.Errorf("got %+v after %v", result, c.sequence())
+	}
+}
+
+func TestAssertSeesTheResultSoFar(t *testing.T) {
+	var seen *Result
+	NewFlow().SetFailurePredicate(func(result *Result) bool { return result.Err != nil }).
+		Parallel(status(3)).
+		Assert("status", func(_ *DataSet, result *Result) bool {
+			seen = result
+			return true
+		}).
+		Wait()
+	if seen == nil || seen.StatusCode != 3 {
+		t.Errorf("saw %+v", seen)
+	}
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// closeBreakerAfter forgets the named breaker once the test is done, since the breakers outlive the flows.
+func closeBreakerAfter(t *testing.T, name string) {
+	t.Cleanup(func() {
+		ResetBreaker(name)
+	})
+}
+
+func TestBreakerOpensAndShortCircuits(t *testing.T) {
+	useFakeClock(t)
+	closeBreakerAfter(t, "trips")
+	c := newCalls()
+	config := BreakerConfig{FailureThreshold: 2, Cooldown: time.Minute}
+	run := func() *Result {
+		return NewFlow().Breaker("trips", config, c.fn("call", failed(errTest))).Wait()
+	}
+	for i := 0; i < 2; i++ {
+		if result := run(); result.Err != errTest {
+			t.Fatalf("run %d got %v", i, result.Err)
+		}
+	}
+	if state := GetBreaker("trips").State(); state != BreakerOpen {
+		t.Fatalf("the breaker is %v after 2 failures", state)
+	}
+	if result := run(); !errors.Is(result.Err, ErrCircuitOpen) {
+		t.Errorf("got %v", result.Err)
+	}
+	if c.count("call") != 2 {
+		t.Errorf("the functor ran %d times", c.count("call"))
+	}
+}
+
+func TestBreakerProbesAfterTheCooldown(t *testing.T) {
+	clock := useFakeClock(t)
+	closeBreakerAfter(t, "probes")
+	healthy := false
+	call := func(*DataSet) *Result {
+		if healthy {
+			return nil
+		}
+		return failed(errTest)
+	}
+	flow := NewFlow().Breaker("probes", BreakerConfig{FailureThreshold: 1, Cooldown: time.Minute}, call)
+	flow.Wait()
+	breaker := GetBreaker("probes")
+
+	clock.Advance(time.Minute)
+	if result := flow.Reset().Wait(); result.Err != errTest || breaker.State() != BreakerOpen {
+		t.Fatalf("a failed probe ends with %v and leaves the breaker %v", result.Err, breaker.State())
+	}
+	if result := flow.Reset().Wait(); !errors.Is(result.Err, ErrCircuitOpen) {
+		t.Fatalf("the cooldown restarts after a failed probe, got %v", result.Err)
+	}
+
+	clock.Advance(time.Minute)
+	healthy = true
+	if result := flow.Reset().Wait(); result.Err != nil || breaker.State() != BreakerClosed {
+		t.Errorf("a good probe ends with %v and leaves the breaker %v", result.Err, breaker.State())
+	}
+}
+
+func TestBreakerIsSharedByName(t *testing.T) {
+	useFakeClock(t)
+	closeBreakerAfter(t, "shared")
+	config := BreakerConfig{FailureThreshold: 1, Cooldown: time.Minute}
+	NewFlow().Breaker("shared", config, fail).Wait()
+	c := newCalls()
+	result := NewFlow().Breaker("shared", config, c.fn("other", nil)).Wait()
+	if !errors.Is(result.Err, ErrCircuitOpen) || c.count("other") != 0 {
+		t.Errorf("another flow got %v", result.Err)
+	}
+	GetBreaker("shared").Reset()
+	if result := NewFlow().Breaker("shared", config, ok).Wait(); result.Err != nil {
+		t.Errorf("got %v after the reset", result.Err)
+	}
+}
+
+func TestBreakerWithAnotherConfigIsReported(t *testing.T) {
+	closeBreakerAfter(t, "configured")
+	config := BreakerConfig{FailureThreshold: 2, Cooldown: time.Minute}
+	if errs := NewFlow().Breaker("configured", config, ok).Validate(); len(errs) != 0 {
+		t.Fatalf("the first config is reported: %v", errs)
+	}
+	if errs := NewFlow().Breaker("configured", config, ok).Validate(); len(errs) != 0 {
+		t.Errorf("the same config is reported: %v", errs)
+	}
+	other := BreakerConfig{FailureThreshold: 5, Cooldown: time.Minute}
+	if errs := NewFlow().Breaker("configured", other, ok).Validate(); len(errs) != 1 {
+		t.Errorf("another config is reported as %v", errs)
+	}
+	defer func() {
+		if recover() == nil {
+			t.Error("another config doesn't panic in a strict flow")
+		}
+	}()
+	NewFlow().Strict().Breaker("configured", other, ok)
+}
+
+func TestResetBreakerForgetsTheConfig(t *testing.T) {
+	closeBreakerAfter(t, "forgotten")
+	first := NewFlow().Breaker("forgotten", BreakerConfig{FailureThreshold: 2}, ok)
+	ResetBreaker("forgotten")
+	if GetBreaker("forgotten") != nil {
+		t.Fatal("the breaker is still there")
+	}
+	other := BreakerConfig{FailureThreshold: 5, Cooldown: time.Minute}
+	if errs := NewFlow().Breaker("forgotten", other, ok).Validate(); len(errs) != 0 {
+		t.Errorf("the new config is reported: %v", errs)
+	}
+	if node := first.nodes[0].(*BreakerNode); node.Breaker == GetBreaker("forgotten") {
+		t.Error("the earlier node lost its breaker")
+	}
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSlowSuccessCallbackDoesNotDelayWait(t *testing.T) {
+	clock := useFakeClock(t)
+	logs := captureLog(t)
+	release := make(chan struct{})
+	defer close(release)
+	flow := NewFlow().SetName("slow").Do(ok).SetCallbackTimeout(50 * time.Millisecond).
+		OnSuccess(func(*DataSet, *Result) {
+			<-release
+		})
+	start := clock.Now()
+	flow.Wait()
+	if waited := clock.Now().Sub(start); waited > 50*time.Millisecond {
+		t.Errorf("Wait took %v", waited)
+	}
+	if !strings.Contains(logs.String(), `OnSuccess of flow "slow" is still running after 50ms`) {
+		t.Errorf("logged %q", logs.String())
+	}
+}
+
+func TestSlowDeferredAndCompensationDoNotDelayWait(t *testing.T) {
+	useFakeClock(t)
+	logs := captureLog(t)
+	release := make(chan struct{})
+	defer close(release)
+	hang := func(*DataSet) *Result {
+		<-release
+		return failed(errTest)
+	}
+	result := NewFlow().SetCallbackTimeout(time.Second).
+		DoWithCompensation(ok, hang).
+		Do(status(4)).
+		Defer(hang).
+		DeferWithResult(func(*DataSet, *Result) { <-release }).
+		Wait()
+	if result.StatusCode != 4 || result.Err != nil {
+		t.Errorf("the deferred function given up on changes the result: %+v", result)
+	}
+	for _, name := range []string{"Compensation", "Defer"} {
+		if !strings.Contains(logs.String(), name+` of flow "" is still running`) {
+			t.Errorf("%s isn't given up on: %q", name, logs.String())
+		}
+	}
+}
+
+func TestDeferredInTimeStillFailsTheFlow(t *testing.T) {
+	result := NewFlow().SetCallbackTimeout(time.Second).Do(ok).Defer(fail).Wait()
+	if result.Err != errTest {
+		t.Errorf("got %+v", result)
+	}
+}
+
+func TestPanicInAbandonedCallbackIsLogged(t *testing.T) {
+	useFakeClock(t)
+	logs := captureLog(t)
+	release := make(chan struct{})
+	flow := NewFlow().SetName("panicky").SetCallbackTimeout(time.Millisecond).Do(ok).
+		OnSuccess(func(*DataSet, *Result) {
+			<-release
+			panic("late")
+		})
+	flow.Wait()
+	close(release)
+	if !eventually(func() bool { return strings.Contains(logs.String(), `OnSuccess of flow "panicky" panicked: late`) }) {
+		t.Errorf("logged %q", logs.String())
+	}
+}
+
+func TestOnlyTheSuccessCallbackFiresOnACleanRun(t *testing.T) {
+	c := newCalls()
+	var onSuccess IOnSuccessFunc = func(*DataSet, *Result) { c.record("success") }
+	var onFail IOnFailFunc = func(*DataSet, *Result) { c.record("fail") }
+	NewFlow().Do(ok).OnSuccess(onSuccess).OnFail(onFail).Wait()
+	NewFlow().If(holds, ok).Else(ok).OnSuccess(onSuccess).OnFail(onFail).Wait()
+	if c.count("success") != 2 || c.count("fail") != 0 {
+		t.Errorf("calls %v", c.sequence())
+	}
+	NewFlow().Do(fail).OnSuccess(onSuccess).OnFail(onFail).Wait()
+	if c.count("success") != 2 || c.count("fail") != 1 {
+		t.Errorf("calls %v", c.sequence())
+	}
+}
+
+func TestAlwaysFiresWhetherTheFlowPassesOrFails(t *testing.T) {
+	c := newCalls()
+	always := func(_ *DataSet, result *Result) {
+		if result.Err != nil {
+			c.record("always after a failure")
+		} else {
+			c.record("always")
+		}
+	}
+	NewFlow().Do(ok).OnSuccess(func(*DataSet, *Result) { c.record("success") }).Always(always).Wait()
+	NewFlow().If(holds, fail).OnFail(func(*DataSet, *Result) { c.record("fail") }).Always(always).Wait()
+	want := []string{"success", "always", "fail", "always after a failure"}
+	if got := c.sequence(); !reflect.DeepEqual(got, want) {
+		t.Errorf("calls %v", got)
+	}
+}
+
+func TestAlwaysRunsAfterAPanickingCallback(t *testing.T) {
+	for name, timeout := range map[string]time.Duration{"inline": 0, "with a timeout": time.Second} {
+		logs := captureLog(t)
+		c := newCalls()
+		result := NewFlow().SetName("panicky").SetCallbackTimeout(timeout).Do(fail).
+			OnFail(func(*DataSet, *Result) { panic("broken") }).
+			Always(func(*DataSet, *Result) { c.record("always") }).
+			Wait()
+		if result.Err != errTest || c.count("always") != 1 {
+			t.Errorf("%s: got %v after %v", name, result.Err, c.sequence())
+		}
+		if !strings.Contains(logs.String(), `OnFail of flow "panicky" panicked: broken`) {
+			t.Errorf("%s: logged %q", name, logs.String())
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestCancelledHalfwayStopsTheChain(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	c := newCalls()
+	flow := NewFlow().
+		Do(c.fn("first", nil)).
+		Do(func(data *DataSet) *Result {
+			cancel()
+			return nil
+		}).
+		Do(c.fn("third", nil)).SetNote("third").
+		Do(c.fn("fourth", nil))
+	flow.data.Ctx = ctx
+	result := flow.Wait()
+	if c.count("first") != 1 || c.count("third") != 0 || c.count("fourth") != 0 {
+		t.Errorf("calls %v", c.sequence())
+	}
+	if !errors.Is(result.Err, ErrCancelled) || !errors.Is(result.Err, context.Canceled) {
+		t.Fatalf("got %v", result.Err)
+	}
+	var flowErr FlowError
+	if !errors.As(result.Err, &flowErr) || flowErr.GetNote() != "third" {
+		t.Errorf("cancelled at %v", flowErr)
+	}
+}
+
+func TestForChecksTheContextEachIteration(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	iterations := 0
+	flow := NewFlow().For(5, func(*DataSet) *Result {
+		iterations++
+		if iterations == 2 {
+			cancel()
+		}
+		return nil
+	})
+	flow.data.Ctx = ctx
+	if result := flow.Wait(); !errors.Is(result.Err, context.Canceled) {
+		t.Errorf("got %v", result.Err)
+	}
+	if iterations != 2 {
+		t.Errorf("%d iterations after the cancellation", iterations)
+	}
+}
+
+func TestParallelStopsDrainingWhenCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	release := make(chan struct{})
+	defer close(release)
+	blocked := func(*DataSet) *Result {
+		<-release
+		return nil
+	}
+	cancels := func(*DataSet) *Result {
+		cancel()
+		return nil
+	}
+	flow := NewFlow().Parallel(blocked, cancels)
+	flow.data.Ctx = ctx
+	if result := flow.Wait(); !errors.Is(result.Err, ErrCancelled) {
+		t.Errorf("got %v", result.Err)
+	}
+}
+
+func TestAlreadyCancelledRunsNothing(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	c := newCalls()
+	flow := NewFlow().Do(c.fn("first", nil))
+	flow.data.Ctx = ctx
+	if result := flow.Wait(); !errors.Is(result.Err, context.Canceled) || c.count("first") != 0 {
+		t.Errorf("got %v after %d calls", result.Err, c.count("first"))
+	}
+}
+
+func TestWaitContextCancelledMidFlow(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	c := newCalls()
+	flow := NewFlow().
+		Do(c.fn("first", nil)).
+		Do(func(*DataSet) *Result {
+			cancel()
+			return nil
+		}).
+		Do(c.fn("third", nil))
+	result := flow.WaitContext(ctx)
+	if !errors.Is(result.Err, ErrCancelled) || !errors.Is(result.Err, context.Canceled) {
+		t.Fatalf("got %v", result.Err)
+	}
+	if c.count("first") != 1 || c.count("third") != 0 {
+		t.Errorf("calls %v", c.sequence())
+	}
+	if flow.data.Ctx != nil {
+		t.Error("the ctx is put in the data")
+	}
+}
+
+func TestWaitContextStopsParallelFromStartingFunctors(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	c := newCalls()
+	cancels := func(*DataSet) *Result {
+		c.record("cancels")
+		cancel()
+		return nil
+	}
+	result := NewFlow().ParallelWithLimit(1, cancels, c.fn("second", nil), c.fn("third", nil)).WaitContext(ctx)
+	if !errors.Is(result.Err, context.Canceled) {
+		t.Fatalf("got %v", result.Err)
+	}
+	if c.count("second") != 0 || c.count("third") != 0 {
+		t.Errorf("calls %v", c.sequence())
+	}
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestResumeFromTheLastCheckpoint(t *testing.T) {
+	c := newCalls()
+	crashed := true
+	registry := map[string]ICallable{
+		// The functors are told apart by their code in ToSpec, so they aren't made by c.fn
+		"load": func(*DataSet) *Result {
+			c.record("load")
+			return nil
+		},
+		"save": func(data *DataSet) *Result {
+			c.record("save")
+			if crashed {
+				return failed(errTest)
+			}
+			return nil
+		},
+		"name": setName("Tom"),
+		"ship": func(*DataSet) *Result {
+			c.record("ship")
+			return nil
+		},
+	}
+	spec, err := NewFlow().Do(registry["load"]).Do(registry["name"]).Do(registry["save"]).Do(registry["ship"]).ToSpec(registry, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	flow, err := BuildFromSpec(spec, registry, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var saved [][]byte
+	flow.SetDataMarshaler(func(data *DataSet) ([]byte, error) { return json.Marshal(data.Name) }).
+		OnCheckpoint(func(state []byte, err error) {
+			if err != nil {
+				t.Fatal(err)
+			}
+			saved = append(saved, state)
+		})
+	if result := flow.Wait(); result.Err != errTest {
+		t.Fatalf("got %v", result.Err)
+	}
+	if len(saved) != 2 {
+		t.Fatalf("%d checkpoints before the failure", len(saved))
+	}
+
+	// The process restarts with the save fixed
+	crashed = false
+	resumed, err := Resume(saved[len(saved)-1], registry, nil, func(bytes []byte, data *DataSet) error {
+		return json.Unmarshal(bytes, &data.Name)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resumed.data.Name != "Tom" {
+		t.Errorf("the data is %+v", resumed.data)
+	}
+	if result := resumed.Wait(); result.Err != nil {
+		t.Fatalf("got %v", result.Err)
+	}
+	if got := c.sequence(); !reflect.DeepEqual(got, []string{"load", "save", "save", "ship"}) {
+		t.Errorf("calls %v", got)
+	}
+}
+
+func TestCheckpointNeedsASpec(t *testing.T) {
+	if _, err := NewFlow().Do(ok).Checkpoint(); err == nil || !strings.Contains(err.Error(), "BuildFromSpec") {
+		t.Errorf("got %v", err)
+	}
+}
+
+func TestResumeWithAMissingFunctor(t *testing.T) {
+	registry := map[string]ICallable{"ok": ok}
+	spec, err := NewFlow().Do(ok).ToSpec(registry, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	flow, err := BuildFromSpec(spec, registry, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	state, err := flow.Checkpoint()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Resume(state, map[string]ICallable{}, nil, nil); err == nil {
+		t.Error("resumed without the functor")
+	}
+}
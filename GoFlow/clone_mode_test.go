@@ -0,0 +1,70 @@
+package main
+
+import (
+	"testing"
+)
+
+func countingCloner(clones *int) IDataCloneFunc {
+	return func(data *DataSet) *DataSet {
+		*clones++
+		return ShallowCloneData(data)
+	}
+}
+
+func keepName(dst *DataSet, src *DataSet) {
+	if src.Name != "" {
+		dst.Name = src.Name
+	}
+}
+
+func TestSequentialFlowNeverClones(t *testing.T) {
+	clones := 0
+	NewFlow().SetDataIsolation(keepName, countingCloner(&clones)).SetCloneMode(CloneAlways).
+		Do(ok).For(3, ok).If(holds, ok).Else(ok).
+		Wait()
+	if clones != 0 {
+		t.Errorf("cloned %d times without a Parallel node", clones)
+	}
+}
+
+func TestParallelFlowClonesEachFunctor(t *testing.T) {
+	clones := 0
+	flow := NewFlow().SetDataIsolation(keepName, countingCloner(&clones)).
+		Do(ok).
+		SetDeterministic(true).
+		Parallel(setName("a"), ok, ok)
+	flow.Wait()
+	if clones != 3 || flow.data.Name != "a" {
+		t.Errorf("cloned %d times, merged %q", clones, flow.data.Name)
+	}
+}
+
+func TestCloneModeOverridesTheDetection(t *testing.T) {
+	clones := 0
+	flow := NewFlow().SetDataIsolation(keepName, countingCloner(&clones)).SetCloneMode(CloneNever).
+		Parallel(setName("shared"))
+	flow.Wait()
+	if clones != 0 || flow.data.Name != "shared" {
+		t.Errorf("CloneNever cloned %d times", clones)
+	}
+
+	clones = 0
+	flow = NewFlow().SetDataIsolation(nil, countingCloner(&clones)).SetCloneMode(CloneAlways).
+		Parallel(setName("lost"))
+	flow.Wait()
+	if clones != 1 || flow.data.Name != "" {
+		t.Errorf("CloneAlways cloned %d times and kept %q", clones, flow.data.Name)
+	}
+}
+
+func BenchmarkSequentialFlow(b *testing.B) {
+	clones := 0
+	cloner := countingCloner(&clones)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		NewFlow().SetDataIsolation(keepName, cloner).Do(ok).Do(ok).For(2, ok).Wait()
+	}
+	if clones != 0 {
+		b.Errorf("cloned %d times", clones)
+	}
+}
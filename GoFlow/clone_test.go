@@ -0,0 +1,106 @@
+package main
+
+import (
+	"reflect"
+	"sync"
+	"testing"
+)
+
+func TestCloneRunsWithItsOwnState(t *testing.T) {
+	var mu sync.Mutex
+	successes := 0
+	greet := func(data *DataSet) *Result {
+		data.Name = "hello " + data.Name
+		return nil
+	}
+	flow := NewFlow().
+		OnSuccess(func(*DataSet, *Result) {
+			mu.Lock()
+			successes++
+			mu.Unlock()
+		}).
+		Do(greet).
+		Do(func(data *DataSet) *Result {
+			if data.Name == "hello bad" {
+				return withStatus(400)
+			}
+			return nil
+		})
+	clone := flow.Clone()
+	flow.data.Name, clone.data.Name = "good", "bad"
+
+	var wg sync.WaitGroup
+	var results [2]*Result
+	for i, engine := range []*FlowEngine{flow, clone} {
+		wg.Add(1)
+		go func(i int, engine *FlowEngine) {
+			defer wg.Done()
+			results[i] = engine.Wait()
+		}(i, engine)
+	}
+	wg.Wait()
+	if flow.data.Name != "hello good" || clone.data.Name != "hello bad" {
+		t.Errorf("the flow has %q and the clone %q", flow.data.Name, clone.data.Name)
+	}
+	if results[0].StatusCode != 0 || results[1].StatusCode != 400 {
+		t.Errorf("results %+v and %+v", results[0], results[1])
+	}
+	if successes != 1 {
+		t.Errorf("OnSuccess called %d times", successes)
+	}
+}
+
+func TestCloneAfterARun(t *testing.T) {
+	flow := NewFlow().Do(status(2)).SetNote("first")
+	flow.Wait()
+	clone := flow.Clone()
+	if (*clone.result).StatusCode != 0 || len(clone.traces) != 0 {
+		t.Error("the clone keeps what is left of the last run")
+	}
+	if result := clone.Wait(); result.StatusCode != 2 {
+		t.Errorf("got %+v", result)
+	}
+}
+
+func TestAppendRunsTheFragmentAfterTheFlow(t *testing.T) {
+	c := newCalls()
+	fragment := NewFlow().Do(c.fn("fragment 1", nil)).Do(func(data *DataSet) *Result {
+		c.record("fragment 2 sees " + data.Name)
+		return nil
+	})
+	flow := NewFlow().Do(c.fn("base", nil)).Do(setName("Tom")).Append(fragment).Do(c.fn("after", nil))
+	if result := flow.Wait(); result.Err != nil {
+		t.Fatal(result.Err)
+	}
+	want := []string{"base", "fragment 1", "fragment 2 sees Tom", "after"}
+	if got := c.sequence(); !reflect.DeepEqual(got, want) {
+		t.Errorf("calls %v", got)
+	}
+	if len(fragment.nodes) != 2 || fragment.data.Name != "" || fragment.nodes[0].GetRunCount() != 0 {
+		t.Error("the fragment is changed")
+	}
+	ids := make(map[string]bool)
+	for _, node := range flow.nodes {
+		if ids[node.GetID()] {
+			t.Errorf("the ID %q is taken twice", node.GetID())
+		}
+		ids[node.GetID()] = true
+	}
+}
+
+func TestAppendSharesTheResult(t *testing.T) {
+	c := newCalls()
+	flow := NewFlow().Do(fail).Append(NewFlow().Do(c.fn("fragment", nil)))
+	if result := flow.Wait(); result.Err != errTest || c.count("fragment") != 0 {
+		t.Errorf("got %v after %v", result.Err, c.sequence())
+	}
+}
+
+func TestAppendWithAnEmptyFlow(t *testing.T) {
+	c := newCalls()
+	flow := NewFlow().Append(NewFlow().Do(c.fn("fragment", nil))).Append(NewFlow()).Do(c.fn("after", nil))
+	flow.Wait()
+	if got := c.sequence(); !reflect.DeepEqual(got, []string{"fragment", "after"}) {
+		t.Errorf("calls %v", got)
+	}
+}
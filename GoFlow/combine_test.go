@@ -0,0 +1,51 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestCombineMergesTheNamedResults(t *testing.T) {
+	var got []*Result
+	sum := func(results []*Result) *Result {
+		got = results
+		total := int64(0)
+		for _, result := range results {
+			total += result.StatusCode
+		}
+		return withStatus(total)
+	}
+	// The status codes are not failures, so that each branch leaves its result
+	flow := NewFlow().SetFailurePredicate(func(result *Result) bool { return result.Err != nil })
+	result := flow.Parallel(status(1)).SetNote("a").
+		Parallel(status(2)).SetNote("b").
+		Parallel(status(3)).SetNote("c").
+		Combine([]string{"c", "a", "b"}, sum).
+		Wait()
+	if result.StatusCode != 6 {
+		t.Fatalf("got %+v", result)
+	}
+	if len(got) != 3 || got[0].StatusCode != 3 || got[1].StatusCode != 1 || got[2].StatusCode != 2 {
+		t.Errorf("combined %v", got)
+	}
+}
+
+func TestCombineFailsForANoteWhichDidNotRun(t *testing.T) {
+	called := false
+	merge := func([]*Result) *Result {
+		called = true
+		return nil
+	}
+	result := NewFlow().Do(ok).SetNote("a").
+		If(fails, ok).SetNote("skipped").
+		Else(ok).SetNote("else").
+		Combine([]string{"a", "missing"}, merge).SetNote("combine").
+		Wait()
+	var notRun *NodeNotRunError
+	if !errors.As(result.Err, &notRun) || notRun.Target != "missing" || notRun.GetNote() != "combine" {
+		t.Fatalf("got %v", result.Err)
+	}
+	if called {
+		t.Error("merged without all the results")
+	}
+}
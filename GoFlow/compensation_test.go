@@ -0,0 +1,50 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCompensationsRunInReverseOnFailure(t *testing.T) {
+	c := newCalls()
+	var seen []*DataSet
+	release := func(name string) ICallable {
+		return func(data *DataSet) *Result {
+			seen = append(seen, data)
+			c.record(name)
+			return nil
+		}
+	}
+	flow := NewFlow().
+		DoWithCompensation(c.fn("lock a", nil), release("release a")).
+		DoWithCompensation(c.fn("lock b", nil), release("release b")).
+		Do(fail).
+		DoWithCompensation(c.fn("lock c", nil), release("release c"))
+	if result := flow.Wait(); result.Err != errTest {
+		t.Fatalf("got %v", result.Err)
+	}
+	want := []string{"lock a", "lock b", "release b", "release a"}
+	if got := c.sequence(); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v", got)
+	}
+	if len(seen) != 2 || seen[0] != flow.data || seen[1] != flow.data {
+		t.Error("the compensations don't get the shared data")
+	}
+}
+
+func TestNoCompensationOnSuccess(t *testing.T) {
+	c := newCalls()
+	NewFlow().DoWithCompensation(ok, c.fn("release", nil)).Do(ok).Wait()
+	if c.count("release") != 0 {
+		t.Error("compensated a successful flow")
+	}
+}
+
+func TestFailedActionIsNotCompensated(t *testing.T) {
+	c := newCalls()
+	NewFlow().DoWithCompensation(c.fn("lock a", nil), c.fn("release a", nil)).
+		DoWithCompensation(fail, c.fn("release b", nil)).Wait()
+	if got := c.sequence(); !reflect.DeepEqual(got, []string{"lock a", "release a"}) {
+		t.Errorf("got %v", got)
+	}
+}
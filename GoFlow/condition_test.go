@@ -0,0 +1,184 @@
+package main
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestNilConditionAbortsTheFlow(t *testing.T) {
+	c := newCalls()
+	failures := 0
+	result := NewFlow().If(nil, c.fn("then", nil)).SetNote("nil condition").
+		Do(c.fn("after", nil)).
+		OnFail(func(*DataSet, *Result) { failures++ }).
+		Wait()
+	var notFound *ConditionNotFoundError
+	if !errors.As(result.Err, &notFound) || notFound.GetNote() != "nil condition" {
+		t.Fatalf("got %v", result.Err)
+	}
+	if c.count("then") != 0 || c.count("after") != 0 {
+		t.Errorf("calls %v", c.sequence())
+	}
+	if failures != 1 {
+		t.Errorf("OnFail fired %d times", failures)
+	}
+}
+
+func TestNilElseIfConditionAbortsTheFlow(t *testing.T) {
+	c := newCalls()
+	result := NewFlow().If(fails, ok).ElseIf(nil, ok).Else(ok).Do(c.fn("after", nil)).Wait()
+	if !errors.Is(result.Err, ErrConditionNotFound) || c.count("after") != 0 {
+		t.Errorf("got %v after %v", result.Err, c.sequence())
+	}
+}
+
+func TestMatchedBranchSkipsTheRestOfTheChain(t *testing.T) {
+	for _, test := range []struct {
+		ifMatches, elseIfMatches bool
+		want                     string
+	}{
+		{true, true, "if"},
+		{false, true, "else if"},
+		{false, false, "else"},
+	} {
+		c := newCalls()
+		flow := NewFlow().
+			If(func(*DataSet) bool { return test.ifMatches }, c.fn("if", nil)).
+			ElseIf(func(*DataSet) bool { return test.elseIfMatches }, c.fn("else if", nil)).
+			Else(c.fn("else", nil)).
+			Do(c.fn("after", nil))
+		flow.Wait()
+		if got := c.sequence(); !reflect.DeepEqual(got, []string{test.want, "after"}) {
+			t.Errorf("%s: calls %v", test.want, got)
+		}
+	}
+}
+
+func TestBranchesAreSkippedAgainOnEachRun(t *testing.T) {
+	matches := true
+	c := newCalls()
+	flow := NewFlow().
+		If(func(*DataSet) bool { return matches }, c.fn("if", nil)).
+		Else(c.fn("else", nil))
+	flow.Wait()
+	matches = false
+	flow.Reset().Wait()
+	if got := c.sequence(); !reflect.DeepEqual(got, []string{"if", "else"}) {
+		t.Errorf("calls %v", got)
+	}
+}
+
+func TestIfErrAbortsWithTheFailureOfTheCondition(t *testing.T) {
+	c := newCalls()
+	lookup := func(*DataSet) (bool, *Result) { return false, withStatus(503) }
+	result := NewFlow().
+		IfErr(lookup, c.fn("then", nil)).
+		Else(c.fn("else", nil)).
+		Do(c.fn("after", nil)).
+		Wait()
+	if result.StatusCode != 503 {
+		t.Errorf("got %+v", result)
+	}
+	if got := c.sequence(); len(got) != 0 {
+		t.Errorf("calls %v", got)
+	}
+}
+
+func TestIfErrBranchesOnTheBool(t *testing.T) {
+	checked := func(matched bool) ICheckedBoolFunc {
+		return func(*DataSet) (bool, *Result) { return matched, nil }
+	}
+	c := newCalls()
+	result := NewFlow().
+		IfErr(checked(false), c.fn("if", nil)).
+		ElseIfErr(checked(true), c.fn("else if", nil)).
+		Else(c.fn("else", nil)).
+		Wait()
+	if result.Err != nil || !reflect.DeepEqual(c.sequence(), []string{"else if"}) {
+		t.Errorf("got %+v after %v", result, c.sequence())
+	}
+}
+
+func TestElseIfErrAbortsWithTheFailureOfTheCondition(t *testing.T) {
+	c := newCalls()
+	result := NewFlow().
+		If(fails, c.fn("if", nil)).
+		ElseIfErr(func(*DataSet) (bool, *Result) { return true, failed(errTest) }, c.fn("else if", nil)).
+		Else(c.fn("else", nil)).
+		Wait()
+	if result.Err != errTest || len(c.sequence()) != 0 {
+		t.Errorf("got %v after %v", result.Err, c.sequence())
+	}
+}
+
+func TestConditionCombinators(t *testing.T) {
+	for name, test := range map[string]struct {
+		condition IBoolFunc
+		want      bool
+	}{
+		"And()":                             {And(), true},
+		"Or()":                              {Or(), false},
+		"And(holds, holds)":                 {And(holds, holds), true},
+		"And(holds, fails)":                 {And(holds, fails), false},
+		"Or(fails, holds)":                  {Or(fails, holds), true},
+		"Or(fails, fails)":                  {Or(fails, fails), false},
+		"Not(fails)":                        {Not(fails), true},
+		"Not(And(holds, Or(fails, holds)))": {Not(And(holds, Or(fails, holds))), false},
+	} {
+		if got := test.condition(&DataSet{}); got != test.want {
+			t.Errorf("%s is %v", name, got)
+		}
+	}
+}
+
+func TestConditionCombinatorsShortCircuit(t *testing.T) {
+	c := newCalls()
+	checked := func(name string, result bool) IBoolFunc {
+		return func(*DataSet) bool {
+			c.record(name)
+			return result
+		}
+	}
+	And(checked("and 1", false), checked("and 2", true))(&DataSet{})
+	Or(checked("or 1", true), checked("or 2", false))(&DataSet{})
+	if got := c.sequence(); !reflect.DeepEqual(got, []string{"and 1", "or 1"}) {
+		t.Errorf("checked %v", got)
+	}
+}
+
+func TestConditionCombinatorsInABranch(t *testing.T) {
+	named := func(data *DataSet) bool { return data.Name != "" }
+	c := newCalls()
+	NewFlow().Do(setName("Tom")).
+		If(And(named, Not(fails)), c.fn("then", nil)).
+		Else(c.fn("else", nil)).
+		Wait()
+	if got := c.sequence(); !reflect.DeepEqual(got, []string{"then"}) {
+		t.Errorf("calls %v", got)
+	}
+}
+
+func TestEachConditionIsCheckedOncePerRun(t *testing.T) {
+	c := newCalls()
+	checked := func(name string, result bool) IBoolFunc {
+		return func(data *DataSet) bool {
+			c.record(name)
+			data.Name += name
+			return result
+		}
+	}
+	flow := NewFlow().
+		If(checked("if", false), ok).
+		ElseIf(checked("first", true), ok).
+		ElseIf(checked("second", true), ok).
+		ElseIf(checked("third", true), ok).
+		Else(ok)
+	flow.Wait()
+	if got := c.sequence(); !reflect.DeepEqual(got, []string{"if", "first"}) {
+		t.Errorf("checked %v", got)
+	}
+	if flow.data.Name != "iffirst" {
+		t.Errorf("the data is %q", flow.data.Name)
+	}
+}
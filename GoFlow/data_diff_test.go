@@ -0,0 +1,27 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDataDiffLoggerLogsTheChangedField(t *testing.T) {
+	logged := make(map[string]map[string][2]interface{})
+	logger := func(note string, changes map[string][2]interface{}) {
+		logged[note] = changes
+	}
+	NewFlow().SetDataDiffLogger(logger).
+		Do(setName("Tom")).SetNote("name").
+		Do(ok).SetNote("unchanged").
+		Do(setName("Jerry")).SetNote("rename").
+		Wait()
+	if len(logged) != 2 {
+		t.Fatalf("logged %v", logged)
+	}
+	if !reflect.DeepEqual(logged["name"], map[string][2]interface{}{"Name": {"", "Tom"}}) {
+		t.Errorf("the first node logged %v", logged["name"])
+	}
+	if !reflect.DeepEqual(logged["rename"], map[string][2]interface{}{"Name": {"Tom", "Jerry"}}) {
+		t.Errorf("the last node logged %v", logged["rename"])
+	}
+}
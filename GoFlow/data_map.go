@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"reflect"
+)
+
+var contextType = reflect.TypeOf((*context.Context)(nil)).Elem()
+
+// dataFields lists the fields of DataSet which can be read and written generically. The key is the value of the `flow`
+// tag or the name of the field, a tag of "-" leaves the field out, and so are the unexported fields and the Ctx.
+func dataFields() map[string]int {
+	fields := make(map[string]int)
+	dataType := reflect.TypeOf(DataSet{})
+	for i := 0; i < dataType.NumField(); i++ {
+		field := dataType.Field(i)
+		if field.PkgPath != "" || field.Type == contextType {
+			continue
+		}
+		key := field.Name
+		if tag, ok := field.Tag.Lookup("flow"); ok {
+			if tag == "-" {
+				continue
+			}
+			key = tag
+		}
+		fields[key] = i
+	}
+	return fields
+}
+
+// DataToMap copies the fields of the data into a map, so they can be accessed by name.
+func DataToMap(_data *DataSet) map[string]interface{} {
+	res := make(map[string]interface{})
+	if _data == nil {
+		return res
+	}
+	value := reflect.ValueOf(_data).Elem()
+	for key, index := range dataFields() {
+		res[key] = value.Field(index).Interface()
+	}
+	return res
+}
+
+// MapToData builds the data from a map made by DataToMap. A value is converted to the type of the field if possible, for
+// example the float64 from JSON into an int, otherwise it's ignored as well as the unknown keys.
+func MapToData(values map[string]interface{}) *DataSet {
+	res := new(DataSet)
+	value := reflect.ValueOf(res).Elem()
+	for key, index := range dataFields() {
+		item, ok := values[key]
+		if !ok || item == nil {
+			continue
+		}
+		field := value.Field(index)
+		itemValue := reflect.ValueOf(item)
+		if itemValue.Type().AssignableTo(field.Type()) {
+			field.Set(itemValue)
+		} else if isNumber(itemValue.Kind()) && isNumber(field.Kind()) {
+			field.Set(itemValue.Convert(field.Type()))
+		}
+	}
+	return res
+}
+
+func isNumber(kind reflect.Kind) bool {
+	return kind >= reflect.Int && kind <= reflect.Float64
+}
+
+// WithValue keeps the value under the key in the Ctx of the data, which is replaced by context.WithValue, so a functor
+// can leave a request ID to the ones after it without a field for it. The Ctx is written, so it must not be called by
+// the functors of a Parallel node sharing the data, while Value can be called by all of them if nothing writes.
+func (d *DataSet) WithValue(key interface{}, value interface{}) {
+	parent := d.Ctx
+	if parent == nil {
+		parent = context.Background()
+	}
+	d.Ctx = context.WithValue(parent, key, value)
+}
+
+// Value returns the value under the key in the Ctx of the data, nil if there's none.
+func (d *DataSet) Value(key interface{}) interface{} {
+	if d.Ctx == nil {
+		return nil
+	}
+	return d.Ctx.Value(key)
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+)
+
+func TestDataRoundTripsThroughMap(t *testing.T) {
+	data := &DataSet{Ctx: context.Background(), Name: "Tom"}
+	values := DataToMap(data)
+	if _, found := values["Ctx"]; found {
+		t.Error("the Ctx is in the map")
+	}
+	if values["Name"] != "Tom" {
+		t.Errorf("map %v", values)
+	}
+	back := MapToData(values)
+	if back.Name != "Tom" || back.Ctx != nil {
+		t.Errorf("got %+v", back)
+	}
+}
+
+func TestDataRoundTripsThroughJSONMap(t *testing.T) {
+	bytes, err := json.Marshal(DataToMap(&DataSet{Name: "Jerry"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var values map[string]interface{}
+	if err := json.Unmarshal(bytes, &values); err != nil {
+		t.Fatal(err)
+	}
+	if back := MapToData(values); back.Name != "Jerry" {
+		t.Errorf("got %+v", back)
+	}
+}
+
+func TestMapToDataIgnoresUnknownAndMistypedValues(t *testing.T) {
+	back := MapToData(map[string]interface{}{"Name": 3, "Unknown": "x"})
+	if back.Name != "" {
+		t.Errorf("got %+v", back)
+	}
+	if len(DataToMap(nil)) != 0 {
+		t.Error("nil data gives values")
+	}
+}
+
+type traceIDKey struct{}
+
+func TestValueSetInPrepareIsReadLater(t *testing.T) {
+	var seen interface{}
+	stash := func(data *DataSet, _ InputParam) *Result {
+		data.WithValue(traceIDKey{}, "trace-1")
+		return nil
+	}
+	read := func(data *DataSet) *Result {
+		seen = data.Value(traceIDKey{})
+		return nil
+	}
+	flow := NewFlow().Prepare(InputParam{}, stash).Do(ok).Do(read)
+	if result := flow.Wait(); result.Err != nil {
+		t.Fatal(result.Err)
+	}
+	if seen != "trace-1" {
+		t.Errorf("read %v", seen)
+	}
+}
+
+func TestValueKeepsTheCtx(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	data := &DataSet{Ctx: ctx}
+	data.WithValue(traceIDKey{}, "trace-1")
+	cancel()
+	if data.Ctx.Err() == nil {
+		t.Error("the Ctx with the value isn't cancelled with the one before")
+	}
+	if (&DataSet{}).Value(traceIDKey{}) != nil || data.Value("missing") != nil {
+		t.Error("a missing value isn't nil")
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestFlowTimeoutStopsPartway(t *testing.T) {
+	ran := 0
+	step := func(*DataSet) *Result {
+		ran++
+		time.Sleep(20 * time.Millisecond)
+		return nil
+	}
+	flow := NewFlow().SetFlowTimeout(50 * time.Millisecond)
+	for i := 0; i < 5; i++ {
+		flow.Do(step)
+	}
+	result := flow.Wait()
+	if !errors.Is(result.Err, ErrFlowDeadline) {
+		t.Fatalf("got %v", result.Err)
+	}
+	if ran == 0 || ran == 5 {
+		t.Errorf("%d nodes ran", ran)
+	}
+}
+
+func TestDeadlineStopsWaitingForAParallelNode(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	blocked := func(*DataSet) *Result {
+		<-release
+		return nil
+	}
+	c := newCalls()
+	result := NewFlow().SetDeadline(time.Now().Add(20*time.Millisecond)).
+		Parallel(blocked, blocked).
+		Do(c.fn("after", nil)).
+		Wait()
+	if !errors.Is(result.Err, ErrFlowDeadline) || c.count("after") != 0 {
+		t.Errorf("got %v", result.Err)
+	}
+}
+
+func TestDeadlineLeavesTheCtxOfTheData(t *testing.T) {
+	original := context.Background()
+	var during, handled context.Context
+	flow := NewFlow().SetFlowTimeout(time.Hour).
+		Do(func(data *DataSet) *Result {
+			during = data.Ctx
+			return nil
+		}).
+		OnSuccess(func(data *DataSet, result *Result) { handled = data.Ctx })
+	flow.data.Ctx = original
+	if result := flow.Wait(); result.Err != nil {
+		t.Fatal(result.Err)
+	}
+	if during != original || handled != original || flow.data.Ctx != original {
+		t.Error("the Ctx of the data is replaced")
+	}
+	if flow.ctx != nil {
+		t.Error("the ctx with the deadline is kept after Wait")
+	}
+}
+
+func TestDeadlineWithWaitContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	c := newCalls()
+	flow := NewFlow().SetFlowTimeout(time.Hour).
+		Do(func(*DataSet) *Result {
+			cancel()
+			return nil
+		}).
+		Do(c.fn("after", nil))
+	if result := flow.WaitContext(ctx); !errors.Is(result.Err, context.Canceled) || c.count("after") != 0 {
+		t.Errorf("got %v", result.Err)
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDeferWithResultSeesTheFailure(t *testing.T) {
+	var seen *Result
+	NewFlow().
+		DeferWithResult(func(data *DataSet, result *Result) { seen = result }).
+		Do(ok).
+		Do(status(500)).
+		Wait()
+	if seen == nil || seen.StatusCode != 500 {
+		t.Errorf("the deferred function sees %+v", seen)
+	}
+}
+
+func TestDeferredRunInReverseOrder(t *testing.T) {
+	c := newCalls()
+	NewFlow().
+		Defer(c.fn("first", nil)).
+		DeferWithResult(func(*DataSet, *Result) { c.record("second") }).
+		Defer(c.fn("third", nil)).
+		Do(c.fn("node", nil)).
+		OnFail(func(*DataSet, *Result) { c.record("fail") }).
+		Do(fail).
+		Wait()
+	if got := c.sequence(); !reflect.DeepEqual(got, []string{"node", "third", "second", "first", "fail"}) {
+		t.Errorf("calls %v", got)
+	}
+}
+
+func TestDeferFailsASucceededFlow(t *testing.T) {
+	if result := NewFlow().Do(ok).Defer(fail, status(2)).Wait(); result.Err != errTest {
+		t.Errorf("got %+v", result)
+	}
+	if result := NewFlow().Do(status(3)).Defer(fail).Wait(); result.StatusCode != 3 || result.Err != nil {
+		t.Errorf("the deferred failure replaces %+v", result)
+	}
+}
+
+func TestDeferAddedAfterAFailingNodeStillRuns(t *testing.T) {
+	c := newCalls()
+	result := NewFlow().Do(fail).Do(c.fn("skipped", nil)).Defer(c.fn("cleanup", nil), fail, c.fn("cleanup 2", nil)).Wait()
+	if result.Err != errTest {
+		t.Fatalf("got %v", result.Err)
+	}
+	if got := c.sequence(); !reflect.DeepEqual(got, []string{"cleanup", "cleanup 2"}) {
+		t.Errorf("calls %v", got)
+	}
+}
+
+func TestPanickingDeferDoesNotStopTheOthers(t *testing.T) {
+	logs := captureLog(t)
+	c := newCalls()
+	result := NewFlow().SetName("cleanup").
+		Defer(c.fn("first", nil)).
+		Defer(func(*DataSet) *Result { panic("broken") }).
+		Do(ok).
+		Wait()
+	if result.Err != nil || c.count("first") != 1 {
+		t.Errorf("got %v after %v", result.Err, c.sequence())
+	}
+	if !strings.Contains(logs.String(), `Defer of flow "cleanup" panicked: broken`) {
+		t.Errorf("logged %q", logs.String())
+	}
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestDoAllRunsEveryFunctorAndKeepsTheFirstFailure(t *testing.T) {
+	first, second := errors.New("first"), errors.New("second")
+	c := newCalls()
+	result := NewFlow().
+		DoAll(c.fn("Func1", nil), c.fn("Func8", failed(first)), c.fn("Func3", failed(second)), c.fn("Func4", nil)).
+		Do(c.fn("after", nil)).
+		Wait()
+	if result.Err != first {
+		t.Errorf("got %v", result.Err)
+	}
+	if got := c.sequence(); !reflect.DeepEqual(got, []string{"Func1", "Func8", "Func3", "Func4"}) {
+		t.Errorf("calls %v", got)
+	}
+}
+
+func TestDoAllRecoversAPanickingFunctor(t *testing.T) {
+	c := newCalls()
+	panics := func(*DataSet) *Result { panic("boom") }
+	result := NewFlow().DoAll(panics, c.fn("after the panic", nil)).Wait()
+	if !errors.Is(result.Err, ErrPanicHappened) || c.count("after the panic") != 1 {
+		t.Errorf("got %v after %v", result.Err, c.sequence())
+	}
+}
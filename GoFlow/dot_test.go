@@ -0,0 +1,36 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestExportDOTWithoutRunning(t *testing.T) {
+	c := newCalls()
+	flow := NewFlow().SetName("checkout").
+		Do(c.fn("load", nil)).SetNote("load").
+		If(holds, c.fn("then", nil)).SetNote("cached").
+		ElseIf(fails, ok).
+		Else(ok).
+		Do(ok).SetNote("save")
+	dot := flow.ExportDOT()
+	if len(c.sequence()) != 0 {
+		t.Fatal("exporting runs the functors")
+	}
+	for _, want := range []string{
+		`digraph "checkout" {`,
+		`n0 [label="load\nNormal"];`,
+		`n1 [label="cached\nIf"];`,
+		`n2 [label="ElseIf"];`,
+		`n0 -> n1;`,
+		`n1 -> n2 [label="else"];`,
+		`n1 -> n4 [label="then"];`,
+		`n2 -> n3 [label="else"];`,
+		`n2 -> n4 [label="then"];`,
+		`n3 -> n4;`,
+	} {
+		if !strings.Contains(dot, want) {
+			t.Errorf("%s isn't in\n%s", want, dot)
+		}
+	}
+}
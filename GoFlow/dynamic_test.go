@@ -0,0 +1,46 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDoDynamicRunsTheFunctorsForTheData(t *testing.T) {
+	c := newCalls()
+	provider := func(data *DataSet) []ICallable {
+		if data.Name == "" {
+			return nil
+		}
+		return []ICallable{c.fn("first", nil), c.fn("third", nil)}
+	}
+	flow := NewFlow().DoDynamic(provider).Do(c.fn("after", nil))
+	flow.Wait()
+	flow.data.Name = "Tom"
+	flow.Reset().Wait()
+	if got := c.sequence(); !reflect.DeepEqual(got, []string{"after", "first", "third", "after"}) {
+		t.Errorf("calls %v", got)
+	}
+}
+
+func TestDoDynamicStopsAtTheFirstFailure(t *testing.T) {
+	c := newCalls()
+	provider := func(*DataSet) []ICallable {
+		return []ICallable{c.fn("first", nil), fail, c.fn("third", nil)}
+	}
+	result := NewFlow().DoDynamic(provider).Wait()
+	if result.Err != errTest || !reflect.DeepEqual(c.sequence(), []string{"first"}) {
+		t.Errorf("got %v after %v", result.Err, c.sequence())
+	}
+}
+
+func TestPreflightOfDoDynamic(t *testing.T) {
+	provider := func(*DataSet) []ICallable { return nil }
+	if err := NewFlow().DoDynamic(provider).Preflight(); err != nil {
+		t.Errorf("a provider is taken for missing functors: %v", err)
+	}
+	err := NewFlow().DoDynamic(nil).SetNote("plugins").Preflight()
+	if err == nil || !strings.Contains(err.Error(), `(Normal "plugins"): provider is nil`) {
+		t.Errorf("got %v", err)
+	}
+}
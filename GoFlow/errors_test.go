@@ -0,0 +1,67 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestFlowErrorsRoundTripThroughAs(t *testing.T) {
+	cases := []struct {
+		err      error
+		sentinel error
+		category ErrorCategory
+	}{
+		{NewConditionNotFoundErrorFor("n"), ErrConditionNotFound, ConditionErrorCategory},
+		{NewPanicHappenedFor("n", "boom", nil), ErrPanicHappened, PanicErrorCategory},
+		{NewCancelledError("n", errTest), ErrCancelled, CancelledErrorCategory},
+		{NewNodeTimeoutError("n", time.Second), ErrNodeTimeout, TimeoutErrorCategory},
+		{NewFlowDeadlineError("n", time.Now()), ErrFlowDeadline, TimeoutErrorCategory},
+		{NewCircuitOpenError("n", "breaker"), ErrCircuitOpen, CircuitErrorCategory},
+		{NewAssertionFailedError("n", "check"), ErrAssertionFailed, AssertionErrorCategory},
+		{NewNodeNotRunError("n", "target"), ErrNodeNotRun, ReferenceErrorCategory},
+		{NewNodeNotFoundError("n", "target"), ErrNodeNotFound, ReferenceErrorCategory},
+		{NewTooManyJumpsError("n", 3), ErrTooManyJumps, JumpErrorCategory},
+	}
+	for _, c := range cases {
+		wrapped := fmt.Errorf("wrapped: %w", c.err)
+		var flowErr FlowError
+		if !errors.As(wrapped, &flowErr) {
+			t.Fatalf("%T doesn't satisfy FlowError", c.err)
+		}
+		if flowErr.GetNote() != "n" || flowErr.GetCategory() != c.category {
+			t.Errorf("%T: note %q category %d", c.err, flowErr.GetNote(), flowErr.GetCategory())
+		}
+		if !errors.Is(wrapped, c.sentinel) {
+			t.Errorf("%T isn't %v", c.err, c.sentinel)
+		}
+	}
+}
+
+func TestStatusErrorIsFlowError(t *testing.T) {
+	var flowErr FlowError
+	if !errors.As(NewStatusError(3, "bad"), &flowErr) || flowErr.GetCategory() != StatusErrorCategory {
+		t.Fatal("StatusError isn't a FlowError with the status category")
+	}
+	if !errors.Is(NewStatusError(3, "bad"), ErrStatusNotOK) {
+		t.Error("StatusError isn't ErrStatusNotOK")
+	}
+}
+
+func TestOldConstructorsStillWork(t *testing.T) {
+	if err := NewConditionNotFoundError(); !errors.Is(err, ErrConditionNotFound) || err.GetNote() != "" {
+		t.Error("NewConditionNotFoundError without a note")
+	}
+	if err := NewPanicHappened("stack"); err.Error() != "stack" || err.GetCategory() != PanicErrorCategory {
+		t.Errorf("NewPanicHappened gives %q", err.Error())
+	}
+}
+
+func TestNodeErrorsCarryTheNote(t *testing.T) {
+	err := NewFlow().Do(func(*DataSet) *Result { panic("boom") }).SetNote("panicky").Run()
+	var flowErr FlowError
+	if !errors.As(err, &flowErr) || flowErr.GetNote() != "panicky" || flowErr.GetCategory() != PanicErrorCategory {
+		t.Fatalf("got %v", err)
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"testing"
+)
+
+// okIs200 treats anything but 200 as a failure, a zero status code too.
+func okIs200(result *Result) bool {
+	return result.Err != nil || result.StatusCode != 200
+}
+
+func TestFailurePredicateLetsA200Through(t *testing.T) {
+	c := newCalls()
+	var succeeded, failedToo bool
+	result := NewFlow().SetFailurePredicate(okIs200).
+		OnSuccess(func(*DataSet, *Result) { succeeded = true }).
+		OnFail(func(*DataSet, *Result) { failedToo = true }).
+		Parallel(status(200)).
+		Do(c.fn("after", nil)).
+		Wait()
+	if c.count("after") != 1 || result.StatusCode != 200 {
+		t.Errorf("got %+v after %v", result, c.sequence())
+	}
+	if !succeeded || failedToo {
+		t.Error("the flow doesn't end as a success")
+	}
+}
+
+func TestFailurePredicateDoesntFailTheEmptyStartingResult(t *testing.T) {
+	c := newCalls()
+	var succeeded, failedToo bool
+	flow := NewFlow().SetFailurePredicate(okIs200).
+		OnSuccess(func(*DataSet, *Result) { succeeded = true }).
+		OnFail(func(*DataSet, *Result) { failedToo = true }).
+		Do(c.fn("first", nil)).
+		Retry(2, 0, c.fn("retried", nil))
+	flow.Wait()
+	if c.count("first") != 1 || c.count("retried") != 1 {
+		t.Errorf("got %v", c.sequence())
+	}
+	if !succeeded || failedToo {
+		t.Error("the flow doesn't end as a success")
+	}
+
+	flow.Reset().Wait()
+	if c.count("first") != 2 {
+		t.Error("the flow doesn't run again after Reset")
+	}
+	flow.Clone().Wait()
+	if c.count("first") != 3 {
+		t.Error("the clone doesn't run")
+	}
+}
+
+func TestFailurePredicateGoesOnAfterAFallback(t *testing.T) {
+	c := newCalls()
+	result := NewFlow().SetFailurePredicate(okIs200).
+		Parallel(status(500)).
+		Fallback(c.fn("fallback", nil)).
+		Do(c.fn("after", nil)).
+		Wait()
+	if c.count("fallback") != 1 || c.count("after") != 1 || result.StatusCode != 0 {
+		t.Errorf("got %+v after %v", result, c.sequence())
+	}
+}
+
+func TestFailurePredicateStopsOnA500(t *testing.T) {
+	c := newCalls()
+	var failedWith *Result
+	result := NewFlow().SetFailurePredicate(okIs200).
+		OnFail(func(data *DataSet, result *Result) { failedWith = result }).
+		Parallel(status(200)).
+		Do(status(500)).
+		Do(c.fn("after", nil)).
+		Wait()
+	if result.StatusCode != 500 || failedWith != result || c.count("after") != 0 {
+		t.Errorf("got %+v after %v", result, c.sequence())
+	}
+}
+
+func TestFailurePredicateFailsAZeroStatusCodeOfANode(t *testing.T) {
+	c := newCalls()
+	result := NewFlow().SetFailurePredicate(okIs200).
+		Do(status(0)).
+		Do(c.fn("after", nil)).
+		Wait()
+	if result.StatusCode != 0 || c.count("after") != 0 {
+		t.Errorf("got %+v after %v", result, c.sequence())
+	}
+}
+
+func TestNilFailurePredicateRestoresTheDefault(t *testing.T) {
+	c := newCalls()
+	NewFlow().SetFailurePredicate(okIs200).SetFailurePredicate(nil).Do(status(200)).Do(c.fn("after", nil)).Wait()
+	if c.count("after") != 0 {
+		t.Error("a 200 isn't a failure by default")
+	}
+}
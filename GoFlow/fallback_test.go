@@ -0,0 +1,129 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFallbackRecoversAFailure(t *testing.T) {
+	c := newCalls()
+	result := NewFlow().Do(fail).Fallback(c.fn("recover", nil)).Do(c.fn("after", nil)).Wait()
+	if result.Err != nil || result.StatusCode != 0 {
+		t.Errorf("got %+v", result)
+	}
+	if c.count("recover") != 1 || c.count("after") != 1 {
+		t.Errorf("calls %v", c.sequence())
+	}
+}
+
+func TestFallbackOnlyRunsAfterAFailure(t *testing.T) {
+	c := newCalls()
+	result := NewFlow().Do(ok).Fallback(c.fn("recover", nil)).Wait()
+	if result != nil && (result.Err != nil || result.StatusCode != 0) || c.count("recover") != 0 {
+		t.Errorf("got %+v after %v", result, c.sequence())
+	}
+}
+
+func TestFallbackAfterANonZeroStatus(t *testing.T) {
+	c := newCalls()
+	result := NewFlow().For(2, status(5)).Fallback(c.fn("recover", nil)).Wait()
+	if result.StatusCode != 0 || c.count("recover") != 1 {
+		t.Errorf("got %+v", result)
+	}
+}
+
+func TestFailingFallbackFailsTheFlow(t *testing.T) {
+	c := newCalls()
+	result := NewFlow().Do(status(5)).Fallback(fail).Do(c.fn("after", nil)).Wait()
+	if result.Err != errTest || c.count("after") != 0 {
+		t.Errorf("got %+v", result)
+	}
+}
+
+func TestDoWithFallbackUsesTheFallbackForASlowPrimary(t *testing.T) {
+	clock := useManualClock(t)
+	release := make(chan struct{})
+	defer close(release)
+	slow := func(*DataSet) *Result {
+		<-release
+		return withStatus(1)
+	}
+	resultChan := make(chan *Result)
+	go func() {
+		resultChan <- NewFlow().DoWithFallback(200*time.Millisecond, slow, status(2)).Wait()
+	}()
+	clock.fire()
+	if result := <-resultChan; result.StatusCode != 2 {
+		t.Errorf("got %+v", result)
+	}
+}
+
+func TestDoWithFallbackKeepsAFastPrimary(t *testing.T) {
+	useManualClock(t)
+	c := newCalls()
+	fast := func(*DataSet) *Result {
+		return &Result{Err: nil, StatusCode: 0, StatusMsg: "primary"}
+	}
+	result := NewFlow().DoWithFallback(200*time.Millisecond, fast, c.fn("fallback", nil)).Wait()
+	if result.StatusMsg != "primary" || c.count("fallback") != 0 {
+		t.Errorf("got %+v", result)
+	}
+}
+
+func TestDoWithFallbackAfterAFailedPrimary(t *testing.T) {
+	result := NewFlow().DoWithFallback(time.Second, fail, ok).Wait()
+	if result.Err != nil {
+		t.Errorf("got %v", result.Err)
+	}
+}
+
+// Run with -race: the primary given up on writes to the data while the fallback does.
+func TestDoWithFallbackKeepsALatePrimaryOffTheData(t *testing.T) {
+	release := make(chan struct{})
+	wrote := make(chan struct{})
+	late := func(data *DataSet) *Result {
+		<-release
+		data.Name = "late"
+		close(wrote)
+		return nil
+	}
+	fallback := func(data *DataSet) *Result {
+		close(release)
+		data.Name = "fallback"
+		return nil
+	}
+	flow := NewFlow().DoWithFallback(5*time.Millisecond, late, fallback).Do(func(data *DataSet) *Result {
+		if data.Name != "fallback" {
+			return failed(errTest)
+		}
+		return nil
+	})
+	if result := flow.Wait(); result.Err != nil {
+		t.Fatal(result.Err)
+	}
+	<-wrote
+	if flow.data.Name != "fallback" {
+		t.Errorf("the late primary wrote %q", flow.data.Name)
+	}
+}
+
+func TestDoWithFallbackCopiesBackAPrimaryInTime(t *testing.T) {
+	flow := NewFlow().DoWithFallback(time.Second, setName("primary"), fail)
+	if result := flow.Wait(); result.Err != nil || flow.data.Name != "primary" {
+		t.Errorf("got %v with %q", result.Err, flow.data.Name)
+	}
+}
+
+func TestDoWithFallbackWithoutTimeout(t *testing.T) {
+	useFakeClock(t)
+	c := newCalls()
+	for _, timeout := range []time.Duration{0, -time.Second} {
+		flow := NewFlow().DoWithFallback(timeout, setName("primary"), c.fn("fallback", nil))
+		if result := flow.Wait(); result.Err != nil || flow.data.Name != "primary" {
+			t.Errorf("%v: got %v with %q", timeout, result.Err, flow.data.Name)
+		}
+	}
+	if c.count("fallback") != 0 {
+		t.Errorf("calls %v", c.sequence())
+	}
+}
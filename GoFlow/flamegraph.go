@@ -0,0 +1,59 @@
+package main
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ToFlamegraph turns the traces of the last run into the folded stack format of flamegraph.pl, one line for each node
+// that ran with its duration in microseconds. The functors of a Parallel node are frames under the node, so the width of
+// the node is the sum of its functors rather than the time it took. There is no other nesting, a flow has no sections or
+// subflows, so all the other nodes are frames right under the flow.
+func (f *FlowEngine) ToFlamegraph() []byte {
+	root := f.name
+	if root == "" {
+		root = "flow"
+	}
+	root = flameFrame(root)
+
+	buf := new(bytes.Buffer)
+	for _, trace := range f.traces {
+		if trace.Skipped {
+			continue
+		}
+		frame := root + ";" + flameFrame(traceLabel(trace))
+		if len(trace.Branches) != 0 {
+			for i, duration := range trace.Branches {
+				writeFlameLine(buf, frame+";branch#"+strconv.Itoa(i), duration)
+			}
+			continue
+		}
+		writeFlameLine(buf, frame, trace.Duration)
+	}
+	return buf.Bytes()
+}
+
+func (e *ElseFlowEngine) ToFlamegraph() []byte {
+	return e.invoker.ToFlamegraph()
+}
+
+func traceLabel(trace NodeTrace) string {
+	if trace.Note != "" {
+		return trace.Note
+	}
+	return trace.NodeType.String() + "#" + strconv.Itoa(trace.Index)
+}
+
+// flameFrame keeps the separators of the format out of a frame.
+func flameFrame(name string) string {
+	return strings.NewReplacer(";", "_", "\n", " ").Replace(name)
+}
+
+func writeFlameLine(buf *bytes.Buffer, stack string, duration time.Duration) {
+	buf.WriteString(stack)
+	buf.WriteByte(' ')
+	buf.WriteString(strconv.FormatInt(int64(duration/time.Microsecond), 10))
+	buf.WriteByte('\n')
+}
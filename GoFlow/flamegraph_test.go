@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFlamegraphFoldsTheRun(t *testing.T) {
+	clock := useFakeClock(t)
+	takes := func(d time.Duration) ICallable {
+		return func(*DataSet) *Result {
+			clock.Advance(d)
+			return nil
+		}
+	}
+	flow := NewFlow().SetName("checkout").SetDeterministic(true).
+		Do(takes(5*time.Millisecond)).SetNote("load").
+		Parallel(takes(2*time.Millisecond), takes(3*time.Millisecond)).SetNote("fan;out").
+		If(fails, ok).SetNote("check").
+		Do(takes(time.Millisecond))
+	flow.Wait()
+
+	lines := strings.Split(strings.TrimSpace(string(flow.ToFlamegraph())), "\n")
+	want := []string{
+		"checkout;load 5000",
+		"checkout;fan_out;branch#0 2000",
+		"checkout;fan_out;branch#1 3000",
+		"checkout;check 0",
+		"checkout;Normal#3 1000",
+	}
+	if strings.Join(lines, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("got\n%s", strings.Join(lines, "\n"))
+	}
+	total := int64(0)
+	for _, line := range lines {
+		micros, err := strconv.ParseInt(line[strings.LastIndex(line, " ")+1:], 10, 64)
+		if err != nil {
+			t.Fatal(err)
+		}
+		total += micros
+	}
+	if total != 11000 {
+		t.Errorf("the frames sum to %d", total)
+	}
+}
+
+func TestFlamegraphForgetsTheBranchesOfACancelledParallel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	release := make(chan struct{})
+	defer close(release)
+	blocked := func(*DataSet) *Result {
+		<-release
+		return nil
+	}
+	cancels := func(*DataSet) *Result {
+		cancel()
+		return nil
+	}
+	flow := NewFlow().Parallel(ok, ok).SetNote("fan-out")
+	flow.Wait()
+	flow.Reset()
+	node := flow.nodes[0].(*ParallelNode)
+	node.Functors = []ICallable{blocked, cancels}
+	flow.data.Ctx = ctx
+	flow.Wait()
+	if node.Durations != nil || node.Gathered != nil || node.Errors != nil {
+		t.Errorf("the last run is kept: %v %v %v", node.Durations, node.Gathered, node.Errors)
+	}
+	if folded := string(flow.ToFlamegraph()); strings.Contains(folded, "branch#") {
+		t.Errorf("got %q", folded)
+	}
+}
+
+func TestFlamegraphKeepsTheBranchesOfEachRun(t *testing.T) {
+	clock := useFakeClock(t)
+	runs := 0
+	flow := NewFlow().SetDeterministic(true).
+		Parallel(func(*DataSet) *Result {
+			clock.Advance(time.Duration(runs+1) * time.Millisecond)
+			return nil
+		}, func(*DataSet) *Result {
+			clock.Advance(time.Millisecond)
+			return nil
+		}).SetNote("fan-out").
+		Goto("fan-out", func(*DataSet) bool {
+			runs++
+			return runs == 1
+		})
+	flow.Wait()
+
+	var branches []string
+	for _, line := range strings.Split(strings.TrimSpace(string(flow.ToFlamegraph())), "\n") {
+		if strings.Contains(line, "branch#") {
+			branches = append(branches, line)
+		}
+	}
+	want := []string{
+		"flow;fan-out;branch#0 1000",
+		"flow;fan-out;branch#1 1000",
+		"flow;fan-out;branch#0 2000",
+		"flow;fan-out;branch#1 1000",
+	}
+	if strings.Join(branches, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("got\n%s", strings.Join(branches, "\n"))
+	}
+	if first := flow.traces[0]; len(first.Branches) != 2 || first.Branches[0] != time.Millisecond {
+		t.Errorf("the first trace has %v", first.Branches)
+	}
+}
@@ -0,0 +1,318 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+)
+
+// Call is a call to a functor or a condition recorded by RecordingEngine. Kind tells which of the functions of the node
+// it is, such as "functor", "condition" or "guard", and Position is its place among them. Data is a shallow copy made
+// before the call. Result is a copy of what a functor returned, and Matched what a condition returned.
+type Call struct {
+	Node     int
+	Note     string
+	NodeType NodeType
+	Kind     string
+	Position int
+	Data     *DataSet
+	Result   *Result
+	Matched  bool
+}
+
+func (c Call) String() string {
+	res := fmt.Sprintf("%d:%s", c.Node, c.NodeType)
+	if c.Note != "" {
+		res += "[" + c.Note + "]"
+	}
+	return res + fmt.Sprintf(".%s#%d", c.Kind, c.Position)
+}
+
+// RecordingEngine runs a clone of a flow with all the functors and conditions wrapped to record their calls, so that a
+// test can check what was called in which order. Nodes added to it afterwards are not recorded.
+type RecordingEngine struct {
+	*FlowEngine
+	mutex sync.Mutex
+	calls []Call
+}
+
+func NewRecordingEngine(flow *FlowEngine) *RecordingEngine {
+	r := &RecordingEngine{FlowEngine: flow.Clone()}
+	for i, node := range r.nodes {
+		r.wrapNode(i, node)
+	}
+	return r
+}
+
+// Transcript is the calls in the order they returned, Parallel functors included.
+func (r *RecordingEngine) Transcript() []Call {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return append([]Call(nil), r.calls...)
+}
+
+// Count tells how many times the functions of the kind of the node with the note were called.
+func (r *RecordingEngine) Count(note string, kind string) int {
+	count := 0
+	for _, call := range r.Transcript() {
+		if call.Note == note && call.Kind == kind {
+			count++
+		}
+	}
+	return count
+}
+
+func (r *RecordingEngine) wrapNode(index int, node IBasicFlowNode) {
+	switch n := node.(type) {
+	case *NormalNode:
+		n.Functors = r.callables(index, node, "functor", n.Functors)
+		n.Provider = r.provider(index, node, n.Provider)
+	case *ElseNode:
+		n.Functors = r.callables(index, node, "functor", n.Functors)
+	case *ForNode:
+		n.Functors = r.callables(index, node, "functor", n.Functors)
+	case *FallbackNode:
+		n.Functors = r.callables(index, node, "functor", n.Functors)
+	case *RetryNode:
+		n.Functors = r.callables(index, node, "functor", n.Functors)
+	case *RaceNode:
+		n.Functors = r.callables(index, node, "functor", n.Functors)
+	case *PrevNode:
+		functors := make([]IPrevCallable, len(n.Functors))
+		for i, functor := range n.Functors {
+			functors[i] = r.prev(index, node, i, functor)
+		}
+		n.Functors = functors
+	case *TapNode:
+		functors := make([]ITapFunc, len(n.Functors))
+		for i, functor := range n.Functors {
+			functors[i] = r.tap(index, node, i, functor)
+		}
+		n.Functors = functors
+	case *IfNode:
+		n.Condition = r.condition(index, node, "condition", 0, n.Condition)
+		n.CheckedCondition = r.checkedCondition(index, node, n.CheckedCondition)
+		n.Functors = r.callables(index, node, "functor", n.Functors)
+	case *ElseIfNode:
+		n.Condition = r.condition(index, node, "condition", 0, n.Condition)
+		n.CheckedCondition = r.checkedCondition(index, node, n.CheckedCondition)
+		n.Functors = r.callables(index, node, "functor", n.Functors)
+	case *ParallelNode:
+		n.Condition = r.condition(index, node, "condition", 0, n.Condition)
+		n.Functors = r.callables(index, node, "functor", n.Functors)
+		if n.Guards != nil {
+			guards := make([]IBoolFunc, len(n.Guards))
+			for i, guard := range n.Guards {
+				guards[i] = r.condition(index, node, "guard", i, guard)
+			}
+			n.Guards = guards
+		}
+	case *GotoNode:
+		n.Condition = r.condition(index, node, "condition", 0, n.Condition)
+	case *BreakerNode:
+		n.Functors = r.callables(index, node, "functor", n.Functors)
+	case *RateLimitedNode:
+		n.Functors = r.callables(index, node, "functor", n.Functors)
+	case *SplitNode:
+		branches := make([]WeightedBranch, len(n.Branches))
+		for i, branch := range n.Branches {
+			branches[i] = WeightedBranch{Weight: branch.Weight, Functors: r.callables(index, node, fmt.Sprintf("branch %d", i), branch.Functors)}
+		}
+		n.Branches = branches
+	case *PollNode:
+		n.Until = r.condition(index, node, "condition", 0, n.Until)
+		n.Functors = r.callables(index, node, "functor", n.Functors)
+	case *ForEachNode:
+		n.Body = r.item(index, node, n.Body)
+	case *AssertNode:
+		n.Check = r.assertion(index, node, n.Check)
+	case *PrepareNode:
+		functors := make([]IPrepareFunc, len(n.Functors))
+		for i, functor := range n.Functors {
+			functors[i] = r.prepare(index, node, i, functor)
+		}
+		n.Functors = functors
+	case *RouteNode:
+		routes := make(map[int64][]ICallable, len(n.Routes))
+		for code, route := range n.Routes {
+			routes[code] = r.callables(index, node, fmt.Sprintf("route %d", code), route)
+		}
+		n.Routes = routes
+		n.DefaultRoute = r.callables(index, node, "default route", n.DefaultRoute)
+	case *CompensableNode:
+		n.Action = r.callable(index, node, "action", 0, n.Action)
+		n.Compensate = r.callable(index, node, "compensate", 0, n.Compensate)
+	case *TimeoutFallbackNode:
+		n.Primary = r.callable(index, node, "primary", 0, n.Primary)
+		n.Fallback = r.callable(index, node, "fallback", 0, n.Fallback)
+	}
+}
+
+func (r *RecordingEngine) newCall(index int, node IBasicFlowNode, kind string, position int, _data *DataSet) Call {
+	call := Call{Node: index, Note: node.GetNote(), NodeType: node.GetNodeType(), Kind: kind, Position: position}
+	if _data != nil {
+		call.Data = ShallowCloneData(_data)
+	}
+	return call
+}
+
+func (r *RecordingEngine) record(call Call) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.calls = append(r.calls, call)
+}
+
+func (r *RecordingEngine) callables(index int, node IBasicFlowNode, kind string, functors []ICallable) []ICallable {
+	if functors == nil {
+		return nil
+	}
+	wrapped := make([]ICallable, len(functors))
+	for i, functor := range functors {
+		wrapped[i] = r.callable(index, node, kind, i, functor)
+	}
+	return wrapped
+}
+
+func (r *RecordingEngine) callable(index int, node IBasicFlowNode, kind string, position int, functor ICallable) ICallable {
+	if functor == nil {
+		return nil
+	}
+	return func(_data *DataSet) *Result {
+		call := r.newCall(index, node, kind, position, _data)
+		defer func() {
+			r.record(call)
+		}()
+		result := functor(_data)
+		if result != nil {
+			snapshot := *result
+			call.Result = &snapshot
+		}
+		return result
+	}
+}
+
+func (r *RecordingEngine) condition(index int, node IBasicFlowNode, kind string, position int, condition IBoolFunc) IBoolFunc {
+	if condition == nil {
+		return nil
+	}
+	return func(_data *DataSet) bool {
+		call := r.newCall(index, node, kind, position, _data)
+		defer func() {
+			r.record(call)
+		}()
+		call.Matched = condition(_data)
+		return call.Matched
+	}
+}
+
+func (r *RecordingEngine) checkedCondition(index int, node IBasicFlowNode, condition ICheckedBoolFunc) ICheckedBoolFunc {
+	if condition == nil {
+		return nil
+	}
+	return func(_data *DataSet) (bool, *Result) {
+		call := r.newCall(index, node, "condition", 0, _data)
+		defer func() {
+			r.record(call)
+		}()
+		matched, result := condition(_data)
+		call.Matched = matched
+		if result != nil {
+			snapshot := *result
+			call.Result = &snapshot
+		}
+		return matched, result
+	}
+}
+
+func (r *RecordingEngine) prepare(index int, node IBasicFlowNode, position int, functor IPrepareFunc) IPrepareFunc {
+	if functor == nil {
+		return nil
+	}
+	return func(_data *DataSet, input InputParam) *Result {
+		call := r.newCall(index, node, "prepare", position, _data)
+		defer func() {
+			r.record(call)
+		}()
+		result := functor(_data, input)
+		if result != nil {
+			snapshot := *result
+			call.Result = &snapshot
+		}
+		return result
+	}
+}
+
+func (r *RecordingEngine) prev(index int, node IBasicFlowNode, position int, functor IPrevCallable) IPrevCallable {
+	if functor == nil {
+		return nil
+	}
+	return func(_data *DataSet, _prev *Result) *Result {
+		call := r.newCall(index, node, "functor", position, _data)
+		defer func() {
+			r.record(call)
+		}()
+		result := functor(_data, _prev)
+		if result != nil {
+			snapshot := *result
+			call.Result = &snapshot
+		}
+		return result
+	}
+}
+
+func (r *RecordingEngine) tap(index int, node IBasicFlowNode, position int, functor ITapFunc) ITapFunc {
+	if functor == nil {
+		return nil
+	}
+	return func(_data *DataSet, _result *Result) {
+		call := r.newCall(index, node, "functor", position, _data)
+		defer func() {
+			r.record(call)
+		}()
+		if _result != nil {
+			snapshot := *_result
+			call.Result = &snapshot
+		}
+		functor(_data, _result)
+	}
+}
+
+func (r *RecordingEngine) assertion(index int, node IBasicFlowNode, check IAssertFunc) IAssertFunc {
+	if check == nil {
+		return nil
+	}
+	return func(_data *DataSet, _result *Result) bool {
+		call := r.newCall(index, node, "check", 0, _data)
+		defer func() {
+			r.record(call)
+		}()
+		call.Matched = check(_data, _result)
+		return call.Matched
+	}
+}
+
+func (r *RecordingEngine) provider(index int, node IBasicFlowNode, provider IFunctorProvider) IFunctorProvider {
+	if provider == nil {
+		return nil
+	}
+	return func(_data *DataSet) []ICallable {
+		return r.callables(index, node, "functor", provider(_data))
+	}
+}
+
+func (r *RecordingEngine) item(index int, node IBasicFlowNode, body IItemCallable) IItemCallable {
+	if body == nil {
+		return nil
+	}
+	return func(_data *DataSet, item interface{}) *Result {
+		call := r.newCall(index, node, "body", 0, _data)
+		defer func() {
+			r.record(call)
+		}()
+		result := body(_data, item)
+		if result != nil {
+			snapshot := *result
+			call.Result = &snapshot
+		}
+		return result
+	}
+}
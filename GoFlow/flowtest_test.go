@@ -0,0 +1,62 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRecordingEngineTranscriptOfBranchesAndALoop(t *testing.T) {
+	flow := NewFlow().
+		Do(setName("loaded")).SetNote("load").
+		If(fails, ok).SetNote("cached").
+		ElseIf(holds, status(0)).SetNote("fresh").
+		Else(ok).
+		For(3, ok).SetNote("loop")
+	recording := NewRecordingEngine(flow)
+	if result := recording.Wait(); result.Err != nil {
+		t.Fatal(result.Err)
+	}
+	var calls []string
+	for _, call := range recording.Transcript() {
+		calls = append(calls, call.String())
+	}
+	want := []string{
+		"0:Normal[load].functor#0",
+		"1:If[cached].condition#0",
+		"2:ElseIf[fresh].condition#0",
+		"2:ElseIf[fresh].functor#0",
+		"4:For[loop].functor#0",
+		"4:For[loop].functor#0",
+		"4:For[loop].functor#0",
+	}
+	if !reflect.DeepEqual(calls, want) {
+		t.Errorf("transcript %v", calls)
+	}
+	if recording.Count("loop", "functor") != 3 || recording.Count("cached", "functor") != 0 {
+		t.Error("wrong counts")
+	}
+
+	transcript := recording.Transcript()
+	if transcript[0].Data.Name != "" || transcript[1].Data.Name != "loaded" {
+		t.Error("the data isn't copied before each call")
+	}
+	if transcript[1].Matched || !transcript[2].Matched {
+		t.Error("the conditions are recorded wrong")
+	}
+	if transcript[3].Result == nil || transcript[3].Result.StatusCode != 0 {
+		t.Errorf("the result of the ElseIf is %+v", transcript[3].Result)
+	}
+}
+
+func TestRecordingEngineLeavesTheFlowAlone(t *testing.T) {
+	c := newCalls()
+	flow := NewFlow().Do(c.fn("a", nil))
+	NewRecordingEngine(flow).Wait()
+	if c.count("a") != 1 {
+		t.Fatal("the recording doesn't run the functors")
+	}
+	flow.Wait()
+	if c.count("a") != 2 {
+		t.Error("the flow isn't left as it is")
+	}
+}
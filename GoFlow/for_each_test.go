@@ -0,0 +1,107 @@
+package main
+
+import (
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestForEachResolvesTheItemsWhenItRuns(t *testing.T) {
+	var slice []int
+	items := func(*DataSet) []interface{} {
+		values := make([]interface{}, len(slice))
+		for i, value := range slice {
+			values[i] = value
+		}
+		return values
+	}
+	var seen []interface{}
+	body := func(data *DataSet, item interface{}) *Result {
+		seen = append(seen, item)
+		return nil
+	}
+	flow := NewFlow().ForEach(items, body)
+	// Filled after the flow is built
+	slice = []int{3, 1, 4, 1, 5}
+	if result := flow.Wait(); result.Err != nil {
+		t.Fatal(result.Err)
+	}
+	if !reflect.DeepEqual(seen, []interface{}{3, 1, 4, 1, 5}) {
+		t.Errorf("the body ran for %v", seen)
+	}
+}
+
+func TestForEachStopsOnTheFirstFailure(t *testing.T) {
+	items := func(*DataSet) []interface{} { return []interface{}{1, 2, 3} }
+	runs := 0
+	body := func(data *DataSet, item interface{}) *Result {
+		runs++
+		if item == 2 {
+			return withStatus(2)
+		}
+		return nil
+	}
+	result := NewFlow().ForEach(items, body).Wait()
+	if result.StatusCode != 2 || runs != 2 {
+		t.Errorf("%d runs end with %+v", runs, result)
+	}
+	runs = 0
+	NewFlow().Do(fail).ForEach(items, body).Wait()
+	if runs != 0 {
+		t.Error("runs after a failure")
+	}
+}
+
+func TestParallelForEachCapsTheWorkers(t *testing.T) {
+	const n = 100
+	items := func(*DataSet) []interface{} {
+		values := make([]interface{}, n)
+		for i := range values {
+			values[i] = i
+		}
+		return values
+	}
+	var mu sync.Mutex
+	inFlight, peak := 0, 0
+	seen := make(map[int]bool)
+	body := func(data *DataSet, item interface{}) *Result {
+		mu.Lock()
+		inFlight++
+		if inFlight > peak {
+			peak = inFlight
+		}
+		seen[item.(int)] = true
+		mu.Unlock()
+		time.Sleep(time.Millisecond)
+		mu.Lock()
+		inFlight--
+		mu.Unlock()
+		return nil
+	}
+	if result := NewFlow().ParallelForEach(4, items, body).Wait(); result.Err != nil {
+		t.Fatal(result.Err)
+	}
+	if peak > 4 || peak == 0 {
+		t.Errorf("peak of %d workers", peak)
+	}
+	if len(seen) != n {
+		t.Errorf("%d distinct items processed", len(seen))
+	}
+}
+
+func TestParallelForEachRecoversAPanickingItem(t *testing.T) {
+	items := func(*DataSet) []interface{} { return []interface{}{1, 2, 3} }
+	body := func(data *DataSet, item interface{}) *Result {
+		if item == 2 {
+			panic("boom")
+		}
+		return nil
+	}
+	c := newCalls()
+	result := NewFlow().ParallelForEach(2, items, body).Do(c.fn("after", nil)).Wait()
+	if !errors.Is(result.Err, ErrPanicHappened) || c.count("after") != 0 {
+		t.Errorf("got %v", result.Err)
+	}
+}
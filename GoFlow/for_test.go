@@ -0,0 +1,50 @@
+package main
+
+import (
+	"strconv"
+	"testing"
+)
+
+func TestForRecordsEachIteration(t *testing.T) {
+	pass := 0
+	count := func(*DataSet) *Result {
+		pass++
+		return &Result{Err: nil, StatusCode: 0, StatusMsg: "pass " + strconv.Itoa(pass)}
+	}
+	flow := NewFlow().For(3, count)
+	if result := flow.Wait(); result.Err != nil || result.StatusMsg != "" {
+		t.Fatalf("got %+v", result)
+	}
+	iterations := flow.nodes[0].(*ForNode).IterationResults()
+	if len(iterations) != 3 {
+		t.Fatalf("%d iterations", len(iterations))
+	}
+	for i, result := range iterations {
+		if result.StatusMsg != "pass "+strconv.Itoa(i+1) {
+			t.Errorf("iteration %d is %+v", i, result)
+		}
+	}
+}
+
+func TestForStopsRecordingAtTheFailure(t *testing.T) {
+	pass := 0
+	failsSecond := func(*DataSet) *Result {
+		pass++
+		if pass == 2 {
+			return failed(errTest)
+		}
+		return nil
+	}
+	flow := NewFlow().For(3, failsSecond)
+	if result := flow.Wait(); result.Err != errTest {
+		t.Fatalf("got %v", result.Err)
+	}
+	iterations := flow.nodes[0].(*ForNode).IterationResults()
+	if len(iterations) != 2 || iterations[0] != nil || iterations[1].Err != errTest {
+		t.Errorf("iterations %v", iterations)
+	}
+	flow.Reset().Wait()
+	if len(flow.nodes[0].(*ForNode).IterationResults()) != 3 {
+		t.Error("the iterations of the run before are kept")
+	}
+}
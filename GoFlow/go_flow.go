@@ -1,24 +1,133 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+	"os"
+	"reflect"
 	"runtime/debug"
+	"strconv"
 	"sync"
+	"time"
 )
 
 type ICallable = func(_data *DataSet) *Result
 
+// IPrevCallable is an ICallable which also gets the result so far, used by DoWithPrev.
+type IPrevCallable = func(_data *DataSet, _prev *Result) *Result
+
 type IBoolFunc = func(_data *DataSet) bool
 
+// ICheckedBoolFunc is a condition which can fail, the flow fails with the result if it's a failure.
+type ICheckedBoolFunc = func(_data *DataSet) (bool, *Result)
+
+// IPrepareFunc fills the data in place, the data is shared by all the nodes and never replaced.
 type IPrepareFunc = func(_data *DataSet, input InputParam) *Result
 
 type INodeBeginLogger = func(note string, _data *DataSet)
 
 type INodeEndLogger = func(note string, _data *DataSet, _result *Result)
 
+// INodeBeginIDLogger is INodeBeginLogger with the ID of the node, which tells apart the nodes with the same note.
+type INodeBeginIDLogger = func(id string, note string, _data *DataSet)
+
+// INodeEndIDLogger is INodeEndLogger with the ID of the node, which tells apart the nodes with the same note.
+type INodeEndIDLogger = func(id string, note string, _data *DataSet, _result *Result)
+
+// ILimiter is waited on by a RateLimited node before it runs. A *rate.Limiter of golang.org/x/time/rate satisfies it,
+// the flow doesn't depend on the package itself.
+type ILimiter interface {
+	Wait(ctx context.Context) error
+}
+
+// ITracer is the tracing hook, StartNode is called before a node runs and the function returned after it's done
+type ITracer interface {
+	StartNode(note string, nodeType NodeType, _data *DataSet) func(_result *Result)
+}
+
+// FlowLogger is told about every node of the flow: OnBegin and OnEnd around the ones which run, and OnSkip for the ones
+// which don't, like the branches not taken.
+type FlowLogger interface {
+	OnBegin(ctx FlowLogContext)
+	OnEnd(ctx FlowLogContext)
+	OnSkip(ctx FlowLogContext)
+}
+
+// FlowLogContext is the node given to a FlowLogger, Result is the result so far, and the result of the node in OnEnd.
+type FlowLogContext struct {
+	Note     string
+	NodeType NodeType
+	ID       string
+	Result   *Result
+}
+
+// NopFlowLogger is the FlowLogger of a flow until SetLogger is called.
+type NopFlowLogger struct{}
+
+func (NopFlowLogger) OnBegin(FlowLogContext) {}
+
+func (NopFlowLogger) OnEnd(FlowLogContext) {}
+
+func (NopFlowLogger) OnSkip(FlowLogContext) {}
+
 type IOnSuccessFunc = func(_data *DataSet, _result *Result)
 
 type IOnFailFunc = func(_data *DataSet, _result *Result)
 
+type IAlwaysFunc = func(_data *DataSet, _result *Result)
+
+type IOnPanicFunc = func(_data *DataSet, recovered interface{}, stack []byte)
+
+type IPanicMapFunc = func(recovered interface{}, stack []byte) *Result
+
+type IDeferFunc = func(_data *DataSet, _result *Result)
+
+type ITapFunc = func(_data *DataSet, _result *Result)
+
+type IItemsFunc = func(_data *DataSet) []interface{}
+
+type IItemCallable = func(_data *DataSet, item interface{}) *Result
+
+type IDataDiffLogger = func(note string, changes map[string][2]interface{})
+
+// INodeBeforeHook is called before each node which is going to run, it can skip the node with SetShouldSkip(true) or
+// fail the flow by returning an error.
+type INodeBeforeHook = func(_data *DataSet, node IBasicFlowNode) error
+
+type IDataCloneFunc = func(_data *DataSet) *DataSet
+
+// IResultMergeFunc folds the result of a node into the result so far, see SetResultMerger.
+type IResultMergeFunc = func(prev *Result, next *Result) *Result
+
+// IFunctorProvider gives the functors of DoDynamic when the node runs.
+type IFunctorProvider = func(_data *DataSet) []ICallable
+
+// IRetryFunc tells whether the failure of an attempt of RetryIf is worth another attempt.
+type IRetryFunc = func(_result *Result) bool
+
+// IAssertFunc tells whether the invariant of Assert holds for the data and the result so far.
+type IAssertFunc = func(_data *DataSet, _result *Result) bool
+
+// IResultReduceFunc folds the result of a functor of ParallelReduce into the ones before it.
+type IResultReduceFunc = func(acc *Result, next *Result) *Result
+
+// ISkipFunc tells from the result so far whether a node is to be skipped, see SkipIf.
+type ISkipFunc = func(_result *Result) bool
+
+// IFailurePredicate tells whether a result fails the flow, see SetFailurePredicate.
+type IFailurePredicate = func(_result *Result) bool
+
+type IDataMergeFunc = func(dst *DataSet, src *DataSet)
+
+type IBeforeRetryFunc = func(_data *DataSet) *DataSet
+
+type IVersionFunc = func(_data *DataSet) int
+
+type IConflictFunc = func(expected int, _data *DataSet, _result *Result) bool
+
 type NodeType int64
 
 const (
@@ -29,8 +138,67 @@ const (
 	ParallelNodeType
 	ElseIfNodeType
 	PrepareNodeType
+	RetryNodeType
+	FallbackNodeType
+	RouteNodeType
+	CompensableNodeType
+	CombineNodeType
+	TimeoutFallbackNodeType
+	GotoNodeType
+	RaceNodeType
+	PrevNodeType
+	TapNodeType
+	ForEachNodeType
+	PollNodeType
+	SplitNodeType
+	BreakerNodeType
+	RateLimitedNodeType
+	AssertNodeType
+)
+
+// RunMode tells a node to run when the result so far is a success, which is the default, or only when it's a failure, or
+// in both cases.
+type RunMode int64
+
+const (
+	RunOnSuccess RunMode = iota
+	RunOnFailure
+	RunAlways
 )
 
+var nodeTypeNames = map[NodeType]string{
+	NormalNodeType:          "Normal",
+	IfNodeType:              "If",
+	ElseNodeType:            "Else",
+	ForNodeType:             "For",
+	ParallelNodeType:        "Parallel",
+	ElseIfNodeType:          "ElseIf",
+	PrepareNodeType:         "Prepare",
+	RetryNodeType:           "Retry",
+	FallbackNodeType:        "Fallback",
+	RouteNodeType:           "Route",
+	CompensableNodeType:     "Compensable",
+	CombineNodeType:         "Combine",
+	TimeoutFallbackNodeType: "TimeoutFallback",
+	GotoNodeType:            "Goto",
+	RaceNodeType:            "Race",
+	PrevNodeType:            "Prev",
+	TapNodeType:             "Tap",
+	ForEachNodeType:         "ForEach",
+	PollNodeType:            "Poll",
+	SplitNodeType:           "Split",
+	BreakerNodeType:         "Breaker",
+	RateLimitedNodeType:     "RateLimited",
+	AssertNodeType:          "Assert",
+}
+
+func (n NodeType) String() string {
+	if name, ok := nodeTypeNames[n]; ok {
+		return name
+	}
+	return "NodeType(" + strconv.FormatInt(int64(n), 10) + ")"
+}
+
 type IBasicFlowNode interface {
 	SetParentResult(result *Result)
 	GetParentResult() *Result
@@ -40,12 +208,25 @@ type IBasicFlowNode interface {
 	GetNext() IBasicFlowNode
 	GetNodeType() NodeType
 	SetShouldSkip(shouldSkip bool)
+	GetShouldSkip() bool
 	SetNote(note string)
 	GetNote() string
 	SetBeginLogger(logger INodeBeginLogger)
 	GetBeginLogger() INodeBeginLogger
 	SetEndLogger(logger INodeEndLogger)
 	GetEndLogger() INodeEndLogger
+	SetTimeout(timeout time.Duration)
+	GetTimeout() time.Duration
+	SetPanicMapper(mapper IPanicMapFunc)
+	SetSkipIf(predicate ISkipFunc)
+	GetFunctorCount() int
+	GetID() string
+	GetRunCount() int
+	GetLastRun() time.Time
+	SetMeta(key string, value string)
+	GetMeta(key string) (string, bool)
+	attach(engine *FlowEngine, index int)
+	metadata() map[string]string
 }
 
 type Flow = FlowEngine
@@ -54,615 +235,3752 @@ func NewFlow() *Flow {
 	return NewFlowEngine()
 }
 
+// And holds if all the conditions hold, which are checked in order until one doesn't. It holds if there is none.
+func And(conditions ...IBoolFunc) IBoolFunc {
+	return func(_data *DataSet) bool {
+		for _, condition := range conditions {
+			if !condition(_data) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// Or holds if any of the conditions holds, which are checked in order until one does. It doesn't hold if there is none.
+func Or(conditions ...IBoolFunc) IBoolFunc {
+	return func(_data *DataSet) bool {
+		for _, condition := range conditions {
+			if condition(_data) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+func Not(condition IBoolFunc) IBoolFunc {
+	return func(_data *DataSet) bool {
+		return !condition(_data)
+	}
+}
+
 //Errors
 
-type ConditionNotFoundError struct{}
+type ErrorCategory int64
 
-func NewConditionNotFoundError() *ConditionNotFoundError {
-	return &ConditionNotFoundError{}
+const (
+	UnknownErrorCategory ErrorCategory = iota
+	ConditionErrorCategory
+	PanicErrorCategory
+	CancelledErrorCategory
+	TimeoutErrorCategory
+	ReferenceErrorCategory
+	JumpErrorCategory
+	CircuitErrorCategory
+	AssertionErrorCategory
+	StatusErrorCategory
+)
+
+var (
+	ErrConditionNotFound = errors.New("condition is nil")
+	ErrPanicHappened     = errors.New("panic happened")
+	ErrCancelled         = errors.New("flow is cancelled")
+	ErrNodeTimeout       = errors.New("node timeout")
+	ErrNodeNotRun        = errors.New("node has not run")
+	ErrNodeNotFound      = errors.New("node not found")
+	ErrTooManyJumps      = errors.New("too many jumps")
+	ErrFlowDeadline      = errors.New("flow deadline exceeded")
+	ErrStatusNotOK       = errors.New("status is not ok")
+	ErrCircuitOpen       = errors.New("circuit is open")
+	ErrAssertionFailed   = errors.New("assertion failed")
+)
+
+// FlowError is satisfied by every error produced by the flow itself, so that the caller can use errors.As to get the
+// note of the node where the error happened and switch on its category.
+type FlowError interface {
+	error
+	GetNote() string
+	GetCategory() ErrorCategory
 }
 
-func (c *ConditionNotFoundError) Error() string {
-	return "condition is nil"
+type BasicFlowError struct {
+	Note     string
+	Category ErrorCategory
 }
 
-type PanicHappened struct {
-	Msg string
+func NewBasicFlowError(note string, category ErrorCategory) *BasicFlowError {
+	return &BasicFlowError{Note: note, Category: category}
 }
 
-func NewPanicHappened(bt string) *PanicHappened {
-	return &PanicHappened{Msg: bt}
+func (b *BasicFlowError) GetNote() string {
+	return b.Note
 }
 
-func (c *PanicHappened) Error() string {
-	return c.Msg
+func (b *BasicFlowError) GetCategory() ErrorCategory {
+	return b.Category
 }
 
-//END Errors
+type ConditionNotFoundError struct {
+	*BasicFlowError
+}
 
-// BasicFlowNode Implementation
-type BasicFlowNode struct {
-	NodeType     NodeType
-	Next         IBasicFlowNode
-	Data         *DataSet
-	ShouldSkip   bool
-	parentResult **Result
-	BeginLogger  INodeBeginLogger
-	EndLogger    INodeEndLogger
-	Note         string
+func NewConditionNotFoundError() *ConditionNotFoundError {
+	return NewConditionNotFoundErrorFor("")
 }
 
-func NewBasicFlowNode(data *DataSet, parentResult **Result, nodeType NodeType) *BasicFlowNode {
-	return &BasicFlowNode{
-		NodeType:     nodeType,
-		Data:         data,
-		parentResult: parentResult,
-	}
+// NewConditionNotFoundErrorFor is NewConditionNotFoundError with the note of the node whose condition is nil.
+func NewConditionNotFoundErrorFor(note string) *ConditionNotFoundError {
+	return &ConditionNotFoundError{BasicFlowError: NewBasicFlowError(note, ConditionErrorCategory)}
 }
 
-func (b *BasicFlowNode) SetParentResult(result *Result) {
-	*b.parentResult = result
+func (c *ConditionNotFoundError) Error() string {
+	return ErrConditionNotFound.Error()
 }
 
-func (b *BasicFlowNode) GetParentResult() *Result {
-	return *b.parentResult
+func (c *ConditionNotFoundError) Is(target error) bool {
+	return target == ErrConditionNotFound
 }
 
-func (b *BasicFlowNode) Run() {
-	if b.ShouldSkip || b.GetParentResult().Err != nil || b.GetParentResult().StatusCode != 0 {
-		return
-	}
-	if b.BeginLogger != nil {
-		b.BeginLogger(b.Note, b.Data)
-	}
+// PanicHappened keeps what is recovered from the panic. Msg is the recovered value followed by the stack.
+type PanicHappened struct {
+	*BasicFlowError
+	Msg       string
+	Recovered interface{}
+}
 
-	result := b.ImplTask()
-	if result != nil {
-		b.SetParentResult(result)
-	}
+func NewPanicHappened(bt string) *PanicHappened {
+	return &PanicHappened{BasicFlowError: NewBasicFlowError("", PanicErrorCategory), Msg: bt}
+}
 
-	if b.EndLogger != nil {
-		b.EndLogger(b.Note, b.Data, b.GetParentResult())
+// NewPanicHappenedFor is NewPanicHappened with the note of the node which panicked, the value it recovered and the stack.
+func NewPanicHappenedFor(note string, recovered interface{}, stack []byte) *PanicHappened {
+	return &PanicHappened{
+		BasicFlowError: NewBasicFlowError(note, PanicErrorCategory),
+		Msg:            fmt.Sprintf("panic: %v\n%s", recovered, stack),
+		Recovered:      recovered,
 	}
 }
 
-func (b *BasicFlowNode) ImplTask() *Result {
-	return &Result{
-		Err:        nil,
-		StatusCode: 0,
-		StatusMsg:  "",
-	}
+func (c *PanicHappened) Error() string {
+	return c.Msg
 }
 
-func (b *BasicFlowNode) GetNext() IBasicFlowNode {
-	return b.Next
+func (c *PanicHappened) Is(target error) bool {
+	return target == ErrPanicHappened
 }
 
-func (b *BasicFlowNode) SetNext(node IBasicFlowNode) {
-	b.Next = node
+// Unwrap returns the recovered value if it's an error, so that a panic with an error can be checked with errors.Is.
+func (c *PanicHappened) Unwrap() error {
+	err, _ := c.Recovered.(error)
+	return err
 }
 
-func (b *BasicFlowNode) GetNodeType() NodeType {
-	return b.NodeType
+// CancelledError wraps the error of the context of the data, so errors.Is still works with context.Canceled and
+// context.DeadlineExceeded.
+type CancelledError struct {
+	*BasicFlowError
+	Err error
 }
 
-func (b *BasicFlowNode) SetShouldSkip(shouldSkip bool) {
-	b.ShouldSkip = shouldSkip
+func NewCancelledError(note string, err error) *CancelledError {
+	return &CancelledError{BasicFlowError: NewBasicFlowError(note, CancelledErrorCategory), Err: err}
 }
 
-func (b *BasicFlowNode) SetNote(note string) {
-	b.Note = note
+func (c *CancelledError) Error() string {
+	return ErrCancelled.Error() + ": " + c.Err.Error()
 }
 
-func (b *BasicFlowNode) GetNote() string {
-	return b.Note
+func (c *CancelledError) Is(target error) bool {
+	return target == ErrCancelled
 }
 
-func (b *BasicFlowNode) SetBeginLogger(logger INodeBeginLogger) {
-	b.BeginLogger = logger
+func (c *CancelledError) Unwrap() error {
+	return c.Err
 }
 
-func (b *BasicFlowNode) GetBeginLogger() INodeBeginLogger {
-	return b.BeginLogger
+type NodeTimeoutError struct {
+	*BasicFlowError
+	Timeout time.Duration
 }
 
-func (b *BasicFlowNode) SetEndLogger(logger INodeEndLogger) {
-	b.EndLogger = logger
+func NewNodeTimeoutError(note string, timeout time.Duration) *NodeTimeoutError {
+	return &NodeTimeoutError{BasicFlowError: NewBasicFlowError(note, TimeoutErrorCategory), Timeout: timeout}
 }
 
-func (b *BasicFlowNode) GetEndLogger() INodeEndLogger {
-	return b.EndLogger
+func (n *NodeTimeoutError) Error() string {
+	return ErrNodeTimeout.Error() + " after " + n.Timeout.String()
 }
 
-//END BasicFlowNode
+func (n *NodeTimeoutError) Is(target error) bool {
+	return target == ErrNodeTimeout
+}
 
-//IfNode Implementation
-type IfNode struct {
-	*BasicFlowNode
-	Condition IBoolFunc
-	Functors  []ICallable
+// FlowDeadlineError is returned when the deadline of the flow has passed, Note is the node which was to run next.
+type FlowDeadlineError struct {
+	*BasicFlowError
+	Deadline time.Time
 }
 
-func NewIfNode(data *DataSet, parentResult **Result, condition IBoolFunc, functors ...ICallable) *IfNode {
-	return &IfNode{
-		BasicFlowNode: NewBasicFlowNode(data, parentResult, IfNodeType),
-		Condition:     condition,
-		Functors:      functors,
-	}
+func NewFlowDeadlineError(note string, deadline time.Time) *FlowDeadlineError {
+	return &FlowDeadlineError{BasicFlowError: NewBasicFlowError(note, TimeoutErrorCategory), Deadline: deadline}
 }
 
-func (i *IfNode) ImplTask() *Result {
-	if i.Condition == nil {
-		return &Result{
-			Err:        NewConditionNotFoundError(),
-			StatusCode: 0,
-			StatusMsg:  "",
-		}
-	}
+func (f *FlowDeadlineError) Error() string {
+	return ErrFlowDeadline.Error() + " at " + f.Deadline.String()
+}
 
-	if i.Condition(i.Data) {
-		for _, functor := range i.Functors {
-			result := functor(i.Data)
-			if result != nil && (result.Err != nil || result.StatusCode != 0) {
-				return result
-			}
-		}
-		current := i.Next
-		for current != nil && (current.GetNodeType() == ElseIfNodeType || current.GetNodeType() == ElseNodeType) {
-			current.SetShouldSkip(true)
-			current = current.GetNext()
-		}
-	}
+func (f *FlowDeadlineError) Is(target error) bool {
+	return target == ErrFlowDeadline
+}
 
-	return i.GetParentResult()
+// StatusError is returned by Run when the flow ends with a non-zero status code and no error.
+type StatusError struct {
+	*BasicFlowError
+	StatusCode int64
+	StatusMsg  string
 }
 
-func (i *IfNode) Run() {
-	if i.ShouldSkip || i.GetParentResult().Err != nil || i.GetParentResult().StatusCode != 0 {
-		return
-	}
-	if i.BeginLogger != nil {
-		i.BeginLogger(i.Note, i.Data)
+func NewStatusError(statusCode int64, statusMsg string) *StatusError {
+	return &StatusError{
+		BasicFlowError: NewBasicFlowError("", StatusErrorCategory),
+		StatusCode:     statusCode,
+		StatusMsg:      statusMsg,
 	}
+}
 
-	result := i.ImplTask()
-	if result != nil {
-		i.SetParentResult(result)
-	}
+func (s *StatusError) Error() string {
+	return fmt.Sprintf("status %s: %s", StatusName(s.StatusCode), s.StatusMsg)
+}
 
-	if i.EndLogger != nil {
-		i.EndLogger(i.Note, i.Data, i.GetParentResult())
-	}
+func (s *StatusError) Is(target error) bool {
+	return target == ErrStatusNotOK
 }
 
-//END IfNode
+// CircuitOpenError is returned by a Breaker node whose breaker refuses the run.
+type CircuitOpenError struct {
+	*BasicFlowError
+	Name string
+}
 
-//ElseNode Implementation
-type ElseNode struct {
-	*BasicFlowNode
-	Functors []ICallable
+func NewCircuitOpenError(note string, name string) *CircuitOpenError {
+	return &CircuitOpenError{BasicFlowError: NewBasicFlowError(note, CircuitErrorCategory), Name: name}
 }
 
-func NewElseNode(data *DataSet, parentResult **Result, functors ...ICallable) *ElseNode {
-	return &ElseNode{BasicFlowNode: NewBasicFlowNode(data, parentResult, ElseNodeType), Functors: functors}
+func (c *CircuitOpenError) Error() string {
+	return ErrCircuitOpen.Error() + ": " + c.Name
 }
 
-func (e *ElseNode) ImplTask() *Result {
-	for _, functor := range e.Functors {
-		result := functor(e.Data)
-		if result != nil && (result.Err != nil || result.StatusCode != 0) {
-			return result
-		}
-	}
-	return e.GetParentResult()
+func (c *CircuitOpenError) Is(target error) bool {
+	return target == ErrCircuitOpen
 }
 
-func (e *ElseNode) Run() {
-	if e.ShouldSkip || e.GetParentResult().Err != nil || e.GetParentResult().StatusCode != 0 {
-		return
-	}
-	if e.BeginLogger != nil {
-		e.BeginLogger(e.Note, e.Data)
-	}
+// AssertionFailedError is returned by an Assert node whose check doesn't hold.
+type AssertionFailedError struct {
+	*BasicFlowError
+	Name string
+}
 
-	result := e.ImplTask()
-	if result != nil {
-		e.SetParentResult(result)
-	}
+func NewAssertionFailedError(note string, name string) *AssertionFailedError {
+	return &AssertionFailedError{BasicFlowError: NewBasicFlowError(note, AssertionErrorCategory), Name: name}
+}
 
-	if e.EndLogger != nil {
-		e.EndLogger(e.Note, e.Data, e.GetParentResult())
-	}
+func (a *AssertionFailedError) Error() string {
+	return ErrAssertionFailed.Error() + ": " + a.Name
 }
 
-//END ElseNode
+func (a *AssertionFailedError) Is(target error) bool {
+	return target == ErrAssertionFailed
+}
 
-// ElseIfNode Implementation
-type ElseIfNode struct {
-	*BasicFlowNode
-	Condition IBoolFunc
-	Functors  []ICallable
+// NodeNotRunError is returned when a node refers to another node by note which hasn't run.
+type NodeNotRunError struct {
+	*BasicFlowError
+	Target string
 }
 
-func NewElseIfNode(data *DataSet, parentResult **Result, condition IBoolFunc, functors ...ICallable) *ElseIfNode {
-	return &ElseIfNode{
-		BasicFlowNode: NewBasicFlowNode(data, parentResult, ElseIfNodeType),
-		Condition:     condition,
-		Functors:      functors,
-	}
+func NewNodeNotRunError(note string, target string) *NodeNotRunError {
+	return &NodeNotRunError{BasicFlowError: NewBasicFlowError(note, ReferenceErrorCategory), Target: target}
 }
 
-func (e *ElseIfNode) ImplTask() *Result {
-	if e.Condition == nil {
-		return &Result{
-			Err:        NewConditionNotFoundError(),
-			StatusCode: 0,
-			StatusMsg:  "",
-		}
-	}
+func (n *NodeNotRunError) Error() string {
+	return ErrNodeNotRun.Error() + ": " + n.Target
+}
 
-	if e.Condition(e.Data) {
-		for _, functor := range e.Functors {
-			result := functor(e.Data)
-			if result != nil && (result.Err != nil || result.StatusCode != 0) {
-				return result
-			}
-		}
+func (n *NodeNotRunError) Is(target error) bool {
+	return target == ErrNodeNotRun
+}
 
-		current := e.Next
-		for current != nil && (current.GetNodeType() == ElseIfNodeType || current.GetNodeType() == ElseNodeType) {
-			current.SetShouldSkip(true)
-			current = current.GetNext()
-		}
-	}
+// NodeNotFoundError is returned when a node refers to another node by note which isn't in the flow.
+type NodeNotFoundError struct {
+	*BasicFlowError
+	Target string
+}
 
-	return e.GetParentResult()
+func NewNodeNotFoundError(note string, target string) *NodeNotFoundError {
+	return &NodeNotFoundError{BasicFlowError: NewBasicFlowError(note, ReferenceErrorCategory), Target: target}
 }
 
-func (e *ElseIfNode) Run() {
-	if e.ShouldSkip || e.GetParentResult().Err != nil || e.GetParentResult().StatusCode != 0 {
-		return
-	}
-	if e.BeginLogger != nil {
-		e.BeginLogger(e.Note, e.Data)
-	}
+func (n *NodeNotFoundError) Error() string {
+	return ErrNodeNotFound.Error() + ": " + n.Target
+}
 
-	result := e.ImplTask()
-	if result != nil {
-		e.SetParentResult(result)
-	}
+func (n *NodeNotFoundError) Is(target error) bool {
+	return target == ErrNodeNotFound
+}
 
-	if e.EndLogger != nil {
-		e.EndLogger(e.Note, e.Data, e.GetParentResult())
-	}
+// TooManyJumpsError is returned when the flow has jumped back more times than it's allowed to in a run.
+type TooManyJumpsError struct {
+	*BasicFlowError
+	MaxJumps int
 }
 
-//END ElseIfNode
+func NewTooManyJumpsError(note string, maxJumps int) *TooManyJumpsError {
+	return &TooManyJumpsError{BasicFlowError: NewBasicFlowError(note, JumpErrorCategory), MaxJumps: maxJumps}
+}
 
-//NormalNode Implementation
-type NormalNode struct {
-	*BasicFlowNode
-	Functors []ICallable
+func (t *TooManyJumpsError) Error() string {
+	return fmt.Sprintf("%s: more than %d", ErrTooManyJumps.Error(), t.MaxJumps)
 }
 
-func NewNormalNode(data *DataSet, parentResult **Result, functors ...ICallable) *NormalNode {
-	return &NormalNode{BasicFlowNode: NewBasicFlowNode(data, parentResult, NormalNodeType), Functors: functors}
+func (t *TooManyJumpsError) Is(target error) bool {
+	return target == ErrTooManyJumps
 }
 
-func (n *NormalNode) ImplTask() *Result {
-	for _, functor := range n.Functors {
-		result := functor(n.Data)
-		if result != nil && (result.Err != nil || result.StatusCode != 0) {
-			return result
-		}
-	}
-	return n.GetParentResult()
+// JumpRequest is not a failure but what JumpTo returns, for the flow to jump to the node with the note Target.
+type JumpRequest struct {
+	Target string
 }
 
-func (n *NormalNode) Run() {
-	if n.ShouldSkip || n.GetParentResult().Err != nil || n.GetParentResult().StatusCode != 0 {
-		return
-	}
-	if n.BeginLogger != nil {
-		n.BeginLogger(n.Note, n.Data)
-	}
+func (j *JumpRequest) Error() string {
+	return "jump to " + j.Target
+}
 
-	result := n.ImplTask()
-	if result != nil {
-		n.SetParentResult(result)
+// JumpTo is returned by a functor for the flow to go on from the first node with the note once the current node is
+// done, whether it's before or after the current one. The jumps count towards the limit of SetMaxJumps like the ones
+// of Goto.
+func JumpTo(note string) *Result {
+	return &Result{
+		Err:        &JumpRequest{Target: note},
+		StatusCode: 0,
+		StatusMsg:  "",
 	}
+}
 
-	if n.EndLogger != nil {
-		n.EndLogger(n.Note, n.Data, n.GetParentResult())
+// isFlowRequest tells whether the result asks the flow to go on somewhere else or to end rather than failing it, so
+// the nodes which retry, fall back or count failures pass it on as it is.
+func isFlowRequest(result *Result) bool {
+	if result == nil {
+		return false
 	}
+	switch result.Err.(type) {
+	case *JumpRequest, *ReturnRequest:
+		return true
+	}
+	return false
 }
 
-//END NormalNode
+// ReturnRequest is not a failure but what ReturnEarly returns, for the flow to end successfully after the current node.
+type ReturnRequest struct{}
 
-//ForNode Implementation
-type ForNode struct {
-	*BasicFlowNode
-	Times    int
-	Functors []ICallable
+func (r *ReturnRequest) Error() string {
+	return "return early"
 }
 
-func NewForNode(times int, data *DataSet, parentResult **Result, functors ...ICallable) *ForNode {
-	return &ForNode{
-		BasicFlowNode: NewBasicFlowNode(data, parentResult, ForNodeType),
-		Times:         times,
-		Functors:      functors,
+// ReturnEarly is returned by a functor for the flow to stop once the current node is done, with the result so far, so
+// it ends as a success. The deferred functions and OnSuccess still run.
+func ReturnEarly() *Result {
+	return &Result{
+		Err:        &ReturnRequest{},
+		StatusCode: 0,
+		StatusMsg:  "",
 	}
 }
 
-func (f *ForNode) ImplTask() *Result {
-	for i := 0; i < f.Times; i++ {
-		for _, functor := range f.Functors {
-			result := functor(f.Data)
-			if result != nil && (result.Err != nil || result.StatusCode != 0) {
-				return result
-			}
-		}
+//END Errors
+
+//Clock
+
+// IClock is the source of time used by the nodes which wait, so that the waiting can be faked in tests.
+type IClock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+}
+
+type SystemClock struct{}
+
+func (SystemClock) Now() time.Time {
+	return time.Now()
+}
+
+func (SystemClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
+
+var Clock IClock = SystemClock{}
+
+// Debug prints the stack of the recovered panics to stderr.
+var Debug = false
+
+//END Clock
+
+// BasicFlowNode Implementation
+type BasicFlowNode struct {
+	NodeType     NodeType
+	Next         IBasicFlowNode
+	Data         *DataSet
+	ShouldSkip   bool
+	parentResult **Result
+	BeginLogger  INodeBeginLogger
+	EndLogger    INodeEndLogger
+	Note         string
+	Timeout      time.Duration
+	RunMode      RunMode
+	PanicMapper  IPanicMapFunc
+	SkipIf       ISkipFunc
+	Meta         map[string]string
+	engine       *FlowEngine
+	index        int
+	id           string
+	matched      *bool
+	runCount     int
+	lastRun      time.Time
+	sandbox      *taskSandbox
+}
+
+func NewBasicFlowNode(data *DataSet, parentResult **Result, nodeType NodeType) *BasicFlowNode {
+	return &BasicFlowNode{
+		NodeType:     nodeType,
+		Data:         data,
+		parentResult: parentResult,
 	}
-	return f.GetParentResult()
 }
 
-func (f *ForNode) Run() {
-	if f.ShouldSkip || f.GetParentResult().Err != nil || f.GetParentResult().StatusCode != 0 {
+func (b *BasicFlowNode) SetParentResult(result *Result) {
+	*b.parentResult = result
+}
+
+func (b *BasicFlowNode) GetParentResult() *Result {
+	return *b.parentResult
+}
+
+func (b *BasicFlowNode) Run() {
+	b.run(b.ImplTask)
+}
+
+// run is shared by the Run of all the nodes, because the embedded BasicFlowNode cannot call the ImplTask of the outer node.
+func (b *BasicFlowNode) run(task func() *Result) {
+	start := Clock.Now()
+	b.matched = nil
+	if !b.shouldRun() {
+		b.logSkip()
+		b.trace(start, true)
+		return
+	}
+	if b.ShouldSkip || b.SkipIf != nil && b.SkipIf(b.GetParentResult()) || b.filteredOut() {
+		b.logSkip()
+		b.trace(start, true)
+		return
+	}
+	if result := b.callBeforeHook(); result != nil {
+		b.SetParentResult(result)
+		b.trace(start, false)
+		return
+	}
+	if b.ShouldSkip {
+		// Skipped by the before hook
+		b.logSkip()
+		b.trace(start, true)
 		return
 	}
-	if f.BeginLogger != nil {
-		f.BeginLogger(f.Note, f.Data)
+	if result := b.checkCancelled(); result != nil {
+		b.SetParentResult(result)
+		b.trace(start, false)
+		return
+	}
+	finish := b.startSpan()
+	if logger := b.beginLogger(); logger != nil {
+		logger(b.Note, b.Data)
+	}
+	if b.engine != nil && b.engine.beginIDLogger != nil {
+		b.engine.beginIDLogger(b.id, b.Note, b.Data)
+	}
+	if b.engine != nil {
+		b.engine.logger.OnBegin(b.logContext())
 	}
 
-	result := f.ImplTask()
+	b.runCount, b.lastRun = b.runCount+1, start
+	before := b.snapshotData()
+	result := b.runTask(task)
+	if result != nil && b.engine != nil {
+		if request, ok := result.Err.(*JumpRequest); ok {
+			result = b.engine.jump(b.Note, request.Target)
+		} else if _, ok := result.Err.(*ReturnRequest); ok {
+			result, b.engine.returned = nil, true
+		}
+	}
 	if result != nil {
-		f.SetParentResult(result)
+		b.SetParentResult(b.mergeResult(result))
 	}
+	b.logDataDiff(before)
 
-	if f.EndLogger != nil {
-		f.EndLogger(f.Note, f.Data, f.GetParentResult())
+	if logger := b.endLogger(); logger != nil {
+		logger(b.Note, b.Data, b.GetParentResult())
+	}
+	if b.engine != nil && b.engine.endIDLogger != nil {
+		b.engine.endIDLogger(b.id, b.Note, b.Data, b.GetParentResult())
 	}
+	if b.engine != nil {
+		b.engine.logger.OnEnd(b.logContext())
+	}
+	finish(b.GetParentResult())
+	b.trace(start, false)
 }
 
-//END NormalNode
+func (b *BasicFlowNode) logContext() FlowLogContext {
+	return FlowLogContext{Note: b.Note, NodeType: b.NodeType, ID: b.id, Result: b.GetParentResult()}
+}
 
-//ParallelNode Implementation
-type ParallelNode struct {
-	*BasicFlowNode
-	Functors []ICallable
+func (b *BasicFlowNode) logSkip() {
+	if b.engine != nil {
+		b.engine.logger.OnSkip(b.logContext())
+	}
 }
 
-func NewParallelNode(data *DataSet, parentResult **Result, functors ...ICallable) *ParallelNode {
-	return &ParallelNode{
-		BasicFlowNode: NewBasicFlowNode(data, parentResult, ParallelNodeType),
-		Functors:      functors,
+// checkCondition calls the condition, the result is returned instead if it's a failure.
+func (b *BasicFlowNode) checkCondition(condition ICheckedBoolFunc) (bool, *Result) {
+	matched, result := condition(b.Data)
+	if b.isFailure(result) {
+		return false, result
 	}
+	return matched, nil
 }
 
-func (p *ParallelNode) ImplTask() *Result {
-	resultChan := make(chan *Result, len(p.Functors))
+// skipBranches sets the skip of the ElseIf and Else nodes following the node, which belong to the same If. Whatever is
+// inside a skipped branch is never run, since it's the branch node which runs it.
+func (b *BasicFlowNode) skipBranches(skip bool) {
+	b.outside(func() {
+		for current := b.Next; current != nil && isBranchNode(current); current = current.GetNext() {
+			current.SetShouldSkip(skip)
+		}
+	})
+}
 
-	wg := sync.WaitGroup{}
-	wg.Add(len(p.Functors))
+// callBeforeHook calls the before hook of the engine with the outer node, the failure is returned if it refuses the node
+// or panics, like a functor does.
+func (b *BasicFlowNode) callBeforeHook() *Result {
+	node := b.outer()
+	if node == nil || b.engine.beforeHook == nil {
+		return nil
+	}
+	return b.recoverTask(func() *Result {
+		if err := b.engine.beforeHook(b.Data, node); err != nil {
+			return &Result{
+				Err:        err,
+				StatusCode: 0,
+				StatusMsg:  "",
+			}
+		}
+		return nil
+	})
+}
 
-	go func(wg *sync.WaitGroup) {
-		wg.Wait()
-		close(resultChan)
-	}(&wg)
+// mergeResult folds the result of the node into the result so far by the merger of the engine, the result replaces it
+// if there's no merger or the node has left it as it is.
+func (b *BasicFlowNode) mergeResult(result *Result) *Result {
+	prev := b.GetParentResult()
+	if b.engine == nil || b.engine.resultMerger == nil || result == prev {
+		return result
+	}
+	if merged := b.engine.resultMerger(prev, result); merged != nil {
+		return merged
+	}
+	return result
+}
 
-	for _, functor := range p.Functors {
-		go func(wg *sync.WaitGroup, f ICallable) {
-			defer func() {
-				wg.Done()
-				if a := recover(); a != nil {
-					debug.PrintStack()
-					resultChan <- &Result{
-						Err:        NewPanicHappened(""),
-						StatusCode: 0,
-						StatusMsg:  "",
-					}
-				}
-			}()
-			result := f(p.Data)
-			resultChan <- result
-		}(&wg, functor)
+// startSpan calls the tracer of the engine, the returned function is to be called with the result once the node is done
+func (b *BasicFlowNode) startSpan() func(_result *Result) {
+	if b.engine == nil || b.engine.tracer == nil {
+		return func(*Result) {}
 	}
+	return b.engine.tracer.StartNode(b.Note, b.NodeType, b.Data)
+}
 
-	result := p.GetParentResult()
-	for item := range resultChan {
-		if result != nil && (result.StatusCode != 0 || result.Err != nil) {
-			continue
-		}
-		result = item
+// snapshotData copies the data before the node runs if the flow logs the changes, so what's changed inside a shared map
+// or slice can only be seen with a deep cloner.
+func (b *BasicFlowNode) snapshotData() *DataSet {
+	if b.engine == nil || b.engine.dataDiffLogger == nil {
+		return nil
 	}
+	return b.copyData()
+}
 
-	return result
+// copyData copies the data by the cloner of the flow or ShallowCloneData, nil if there's no data.
+func (b *BasicFlowNode) copyData() *DataSet {
+	if b.Data == nil {
+		return nil
+	}
+	if b.engine != nil && b.engine.dataCloner != nil {
+		return b.engine.dataCloner(b.Data)
+	}
+	return ShallowCloneData(b.Data)
 }
 
-func (p *ParallelNode) Run() {
-	if p.ShouldSkip || p.GetParentResult().Err != nil || p.GetParentResult().StatusCode != 0 {
+func (b *BasicFlowNode) logDataDiff(before *DataSet) {
+	if before == nil {
 		return
 	}
-	if p.BeginLogger != nil {
-		p.BeginLogger(p.Note, p.Data)
+	after := DataToMap(b.Data)
+	changes := make(map[string][2]interface{})
+	for key, old := range DataToMap(before) {
+		if !reflect.DeepEqual(old, after[key]) {
+			changes[key] = [2]interface{}{old, after[key]}
+		}
+	}
+	if len(changes) != 0 {
+		b.engine.dataDiffLogger(b.Note, changes)
 	}
+}
 
-	result := p.ImplTask()
-	if result != nil {
-		p.SetParentResult(result)
+// beginLogger is the logger of the node, or the global one of the engine if it has none
+func (b *BasicFlowNode) beginLogger() INodeBeginLogger {
+	if b.BeginLogger == nil && b.engine != nil {
+		return b.engine.beginLogger
 	}
+	return b.BeginLogger
+}
 
-	if p.EndLogger != nil {
-		p.EndLogger(p.Note, p.Data, p.GetParentResult())
+// endLogger is the logger of the node, or the global one of the engine if it has none
+func (b *BasicFlowNode) endLogger() INodeEndLogger {
+	if b.EndLogger == nil && b.engine != nil {
+		return b.engine.endLogger
 	}
+	return b.EndLogger
 }
 
-//END NormalNode
+func (b *BasicFlowNode) shouldRun() bool {
+	switch b.RunMode {
+	case RunOnFailure:
+		return b.parentFailed()
+	case RunAlways:
+		return true
+	default:
+		return !b.parentFailed()
+	}
+}
 
-//PrepareNode Implementation
-type PrepareNode struct {
-	*BasicFlowNode
-	Functors []IPrepareFunc
-	Input    InputParam
+func (b *BasicFlowNode) parentFailed() bool {
+	return b.isFailure(b.GetParentResult())
 }
 
-func NewPrepareNode(data *DataSet, parentResult **Result, input InputParam, functors ...IPrepareFunc) *PrepareNode {
-	return &PrepareNode{
-		BasicFlowNode: NewBasicFlowNode(data, parentResult, PrepareNodeType),
-		Functors:      functors,
-		Input:         input,
+// isFailure tells whether the result fails the flow, by the failure predicate of the engine if it has one.
+func (b *BasicFlowNode) isFailure(result *Result) bool {
+	if b.engine != nil {
+		return b.engine.isFailure(result)
 	}
+	return DefaultFailure(result)
 }
 
-func (p *PrepareNode) ImplTask() *Result {
-	for _, functor := range p.Functors {
-		result := functor(p.Data, p.Input)
-		if result != nil && (result.Err != nil || result.StatusCode != 0) {
+// emptyResult is the result a node clearing a failure leaves behind, the empty result the flow starts with so that no
+// failure predicate takes it for a failure.
+func (b *BasicFlowNode) emptyResult() *Result {
+	if b.engine != nil {
+		return b.engine.startResult
+	}
+	return new(Result)
+}
+
+// callFunctor runs the functor, and a nil one does nothing, as every node skips the nil functors.
+func callFunctor(functor ICallable, data *DataSet) *Result {
+	if functor == nil {
+		return nil
+	}
+	return functor(data)
+}
+
+// runEach runs the functors in turn, skipping the nil ones, and returns the first failure, nil if none fails.
+func (b *BasicFlowNode) runEach(functors []ICallable) *Result {
+	for _, functor := range functors {
+		if result := callFunctor(functor, b.Data); b.isFailure(result) {
 			return result
 		}
 	}
-	return p.GetParentResult()
+	return nil
 }
 
-func (p *PrepareNode) Run() {
-	if p.ShouldSkip || p.GetParentResult().Err != nil || p.GetParentResult().StatusCode != 0 {
+// runTask gives up the task once it takes longer than Timeout. The task is left running in the background, so it runs on
+// a copy of the node with a copy of the data and of the result so far, which are only copied back if it's done in time.
+// What it does after the timeout is lost instead of racing with the nodes after it, except for what is shared by the
+// copy of the data, which is made by the cloner of the flow or ShallowCloneData. A node which isn't in a flow runs the
+// task in place.
+func (b *BasicFlowNode) runTask(task func() *Result) *Result {
+	if b.Timeout <= 0 {
+		return b.recoverTask(task)
+	}
+	sandbox := b.newSandbox()
+	if sandbox != nil {
+		task = sandbox.task
+	}
+	resultChan := make(chan *Result, 1)
+	go func() {
+		resultChan <- task()
+	}()
+	select {
+	case result := <-resultChan:
+		if sandbox != nil {
+			sandbox.copyBack(b)
+		}
+		return result
+	case <-Clock.After(b.Timeout):
+		if sandbox != nil {
+			sandbox.abandon()
+		}
+		return &Result{
+			Err:        NewNodeTimeoutError(b.Note, b.Timeout),
+			StatusCode: 0,
+			StatusMsg:  "",
+		}
+	}
+}
+
+// taskSandbox is the copy of a node which the task of the node runs on when it has a timeout.
+type taskSandbox struct {
+	origin    IBasicFlowNode
+	node      IBasicFlowNode
+	basic     *BasicFlowNode
+	result    *Result
+	lock      sync.Mutex
+	abandoned bool
+}
+
+func (b *BasicFlowNode) newSandbox() *taskSandbox {
+	origin := b.outer()
+	if origin == nil {
+		return nil
+	}
+	sandbox := &taskSandbox{origin: origin, result: b.GetParentResult()}
+	sandbox.node = cloneNode(origin, b.copyData(), &sandbox.result)
+	sandbox.basic = basicNode(sandbox.node)
+	sandbox.basic.Next, sandbox.basic.sandbox = b.Next, sandbox
+	return sandbox
+}
+
+func (s *taskSandbox) task() *Result {
+	return s.basic.recoverTask(s.node.ImplTask)
+}
+
+// copyBack copies the data, the result so far and the fields of the copy of the node back into the node.
+func (s *taskSandbox) copyBack(b *BasicFlowNode) {
+	if b.Data != nil && s.basic.Data != nil {
+		*b.Data = *s.basic.Data
+	}
+	b.SetParentResult(s.result)
+	b.matched = s.basic.matched
+	origin, node := reflect.ValueOf(s.origin).Elem(), reflect.ValueOf(s.node).Elem()
+	for i := 0; i < origin.NumField(); i++ {
+		if origin.Type().Field(i).Name != "BasicFlowNode" {
+			origin.Field(i).Set(node.Field(i))
+		}
+	}
+}
+
+func (s *taskSandbox) abandon() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.abandoned = true
+}
+
+// outside makes a change to the other nodes or to the flow, unless the node runs in a sandbox which has been given up
+// on, then the change is dropped.
+func (b *BasicFlowNode) outside(change func()) {
+	if b.sandbox == nil {
+		change()
 		return
 	}
-	if p.BeginLogger != nil {
-		p.BeginLogger(p.Note, p.Data)
+	b.sandbox.lock.Lock()
+	defer b.sandbox.lock.Unlock()
+	if !b.sandbox.abandoned {
+		change()
 	}
+}
 
-	result := p.ImplTask()
-	if result != nil {
-		p.SetParentResult(result)
+// outer is the node which embeds b, nil if b isn't in a flow.
+func (b *BasicFlowNode) outer() IBasicFlowNode {
+	if b.engine == nil || b.index >= len(b.engine.nodes) {
+		return nil
 	}
+	return b.engine.nodes[b.index]
+}
+
+// recoverTask turns a panic in the task into a failed result, so that the flow fails instead of the process.
+func (b *BasicFlowNode) recoverTask(task func() *Result) (result *Result) {
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			result = b.panicked(recovered, debug.Stack())
+		}
+	}()
+	return task()
+}
 
-	if p.EndLogger != nil {
-		p.EndLogger(p.Note, p.Data, p.GetParentResult())
+// panicked hands the panic to the OnPanic handler of the flow and returns the result for it, which is made by the
+// PanicMapper of the node if it has one, and a PanicHappened otherwise.
+func (b *BasicFlowNode) panicked(recovered interface{}, stack []byte) *Result {
+	if b.engine != nil && b.engine.onPanicFunc != nil {
+		b.engine.onPanicFunc(b.Data, recovered, stack)
+	}
+	if Debug {
+		_, _ = os.Stderr.Write(stack)
+	}
+	if b.PanicMapper != nil {
+		if result := b.PanicMapper(recovered, stack); result != nil {
+			return result
+		}
+	}
+	return &Result{
+		Err:        NewPanicHappenedFor(b.Note, recovered, stack),
+		StatusCode: 0,
+		StatusMsg:  "",
 	}
 }
 
-//END PrepareNode
+// checkCancelled returns a failed result if the context of the data is done, otherwise nil.
+func (b *BasicFlowNode) checkCancelled() *Result {
+	var err error
+	if b.Data != nil && b.Data.Ctx != nil {
+		err = b.Data.Ctx.Err()
+	}
+	if err == nil && b.engine != nil && b.engine.ctx != nil {
+		err = b.engine.ctx.Err()
+	}
+	if err == nil {
+		return nil
+	}
+	return &Result{
+		Err:        NewCancelledError(b.Note, err),
+		StatusCode: 0,
+		StatusMsg:  "",
+	}
+}
 
-//FlowEngine Implementation
+// filteredOut tells whether RunOnly is running the flow without the node.
+func (b *BasicFlowNode) filteredOut() bool {
+	return b.engine != nil && b.engine.runOnly != nil && !b.engine.runOnly[b.Note]
+}
 
-type FlowEngine struct {
-	data          *DataSet
-	nodes         []IBasicFlowNode
-	result        **Result
-	onFailFunc    IOnFailFunc
-	onSuccessFunc IOnSuccessFunc
+func (b *BasicFlowNode) deterministic() bool {
+	return b.engine != nil && b.engine.deterministic
 }
 
-func NewFlowEngine() *FlowEngine {
-	res := &FlowEngine{
-		nodes: make([]IBasicFlowNode, 0, 10),
+// ctxDone is the Done of the ctx, nil if there's no ctx.
+func ctxDone(ctx context.Context) <-chan struct{} {
+	if ctx == nil {
+		return nil
 	}
-	res.data = new(DataSet)
+	return ctx.Done()
+}
 
-	tempResult := new(Result)
-	res.result = &tempResult
-	return res
+// flowDone is closed once the context given to WaitContext is done, it's nil if there is none.
+func (b *BasicFlowNode) flowDone() <-chan struct{} {
+	if b.engine == nil {
+		return nil
+	}
+	return ctxDone(b.engine.ctx)
 }
 
-func (f *FlowEngine) Prepare(input InputParam, prepareFunc ...IPrepareFunc) *FlowEngine {
-	node := NewPrepareNode(f.data, f.result, input, prepareFunc...)
-	if len(f.nodes) != 0 {
-		f.nodes[len(f.nodes)-1].SetNext(node)
+func (b *BasicFlowNode) trace(start time.Time, skipped bool) {
+	if b.engine == nil {
+		return
+	}
+	trace := NewNodeTrace(b, start, skipped)
+	b.engine.traces = append(b.engine.traces, trace)
+	if b.engine.sinkRun != nil && !skipped {
+		b.engine.sinkRun.push(sinkItem{note: b.Note, nodeType: b.NodeType, result: trace.Result})
+	}
+	if b.engine.metrics == nil {
+		return
+	}
+	if skipped {
+		b.engine.metrics.RecordSkipped(b.Note, b.NodeType)
+	} else {
+		b.engine.metrics.RecordNode(b.Note, b.NodeType, trace.Duration, b.parentFailed())
 	}
-	f.nodes = append(f.nodes, node)
-	return f
 }
 
-func (f *FlowEngine) Do(functors ...ICallable) *FlowEngine {
-	node := NewNormalNode(f.data, f.result, functors...)
-	if len(f.nodes) != 0 {
-		f.nodes[len(f.nodes)-1].SetNext(node)
+func (b *BasicFlowNode) SetTimeout(timeout time.Duration) {
+	b.Timeout = timeout
+}
+
+func (b *BasicFlowNode) GetTimeout() time.Duration {
+	return b.Timeout
+}
+
+func (b *BasicFlowNode) SetPanicMapper(mapper IPanicMapFunc) {
+	b.PanicMapper = mapper
+}
+
+func (b *BasicFlowNode) SetSkipIf(predicate ISkipFunc) {
+	b.SkipIf = predicate
+}
+
+func (b *BasicFlowNode) GetFunctorCount() int {
+	return 0
+}
+
+// describeNode is the String of the nodes, the type followed by the note if there is one and the number of functors.
+func describeNode(node IBasicFlowNode) string {
+	description := node.GetNodeType().String()
+	if node.GetNote() != "" {
+		description += " " + strconv.Quote(node.GetNote())
 	}
-	f.nodes = append(f.nodes, node)
-	return f
+	return description + fmt.Sprintf(" (%d functors)", node.GetFunctorCount())
 }
 
-func (f *FlowEngine) For(times int, functors ...ICallable) *FlowEngine {
-	node := NewForNode(times, f.data, f.result, functors...)
-	if len(f.nodes) != 0 {
-		f.nodes[len(f.nodes)-1].SetNext(node)
+// attach also gives the node its ID the first time, which is kept when the node is moved or the flow is cloned.
+func (b *BasicFlowNode) attach(engine *FlowEngine, index int) {
+	b.engine = engine
+	b.index = index
+	if b.id == "" {
+		engine.nodeSeq++
+		b.id = strconv.Itoa(engine.nodeSeq)
 	}
-	f.nodes = append(f.nodes, node)
+}
+
+// GetID is unique among the nodes of the flow, and it's given in the order the nodes are added.
+func (b *BasicFlowNode) GetID() string {
+	return b.id
+}
+
+// GetRunCount tells how many times the node has run its task in all the runs of the flow, the skipped ones are not
+// counted, and a loop like For counts once for all its iterations, while a Goto back to the node counts again.
+func (b *BasicFlowNode) GetRunCount() int {
+	return b.runCount
+}
+
+// GetLastRun is when the node last started to run its task, zero if it never has.
+func (b *BasicFlowNode) GetLastRun() time.Time {
+	return b.lastRun
+}
+
+// SetMeta attaches the value to the node for the tools reading the flow, it's shown by ExportDOT and kept in the traces,
+// but it has nothing to do with how the node runs.
+func (b *BasicFlowNode) SetMeta(key string, value string) {
+	if b.Meta == nil {
+		b.Meta = make(map[string]string)
+	}
+	b.Meta[key] = value
+}
+
+func (b *BasicFlowNode) GetMeta(key string) (string, bool) {
+	value, ok := b.Meta[key]
+	return value, ok
+}
+
+func (b *BasicFlowNode) metadata() map[string]string {
+	return b.Meta
+}
+
+func (b *BasicFlowNode) setMatched(matched bool) {
+	b.matched = &matched
+}
+
+func (b *BasicFlowNode) ImplTask() *Result {
+	return &Result{
+		Err:        nil,
+		StatusCode: 0,
+		StatusMsg:  "",
+	}
+}
+
+func (b *BasicFlowNode) GetNext() IBasicFlowNode {
+	return b.Next
+}
+
+func (b *BasicFlowNode) SetNext(node IBasicFlowNode) {
+	b.Next = node
+}
+
+func (b *BasicFlowNode) GetNodeType() NodeType {
+	return b.NodeType
+}
+
+func (b *BasicFlowNode) SetShouldSkip(shouldSkip bool) {
+	b.ShouldSkip = shouldSkip
+}
+
+func (b *BasicFlowNode) GetShouldSkip() bool {
+	return b.ShouldSkip
+}
+
+func (b *BasicFlowNode) SetNote(note string) {
+	b.Note = note
+}
+
+func (b *BasicFlowNode) GetNote() string {
+	return b.Note
+}
+
+func (b *BasicFlowNode) SetBeginLogger(logger INodeBeginLogger) {
+	b.BeginLogger = logger
+}
+
+func (b *BasicFlowNode) GetBeginLogger() INodeBeginLogger {
+	return b.BeginLogger
+}
+
+func (b *BasicFlowNode) SetEndLogger(logger INodeEndLogger) {
+	b.EndLogger = logger
+}
+
+func (b *BasicFlowNode) GetEndLogger() INodeEndLogger {
+	return b.EndLogger
+}
+
+//END BasicFlowNode
+
+//IfNode Implementation
+
+// IfNode runs the functors if the condition holds. CheckedCondition is used instead of Condition if it's set. If
+// ByStatus is set, the condition is that the status code of the result so far is StatusCode with no error instead, the
+// node runs even if the flow has failed, and the status is cleared once the functors succeed. The condition is called
+// once each time the node runs, the branches following it are skipped by their flag, without calling it again.
+type IfNode struct {
+	*BasicFlowNode
+	Condition        IBoolFunc
+	CheckedCondition ICheckedBoolFunc
+	Functors         []ICallable
+	ByStatus         bool
+	StatusCode       int64
+}
+
+func NewIfNode(data *DataSet, parentResult **Result, condition IBoolFunc, functors ...ICallable) *IfNode {
+	return &IfNode{
+		BasicFlowNode: NewBasicFlowNode(data, parentResult, IfNodeType),
+		Condition:     condition,
+		Functors:      functors,
+	}
+}
+
+func (i *IfNode) ImplTask() *Result {
+	if i.Condition == nil && i.CheckedCondition == nil && !i.ByStatus {
+		return &Result{
+			Err:        NewConditionNotFoundErrorFor(i.Note),
+			StatusCode: 0,
+			StatusMsg:  "",
+		}
+	}
+
+	// The branches skipped by the last run may have to run this time, after a Goto or in another Wait
+	i.skipBranches(false)
+
+	matched, failure := i.matchCondition()
+	if failure != nil {
+		return failure
+	}
+	i.setMatched(matched)
+	if matched {
+		if result := i.runEach(i.Functors); result != nil {
+			return result
+		}
+		i.skipBranches(true)
+		if i.ByStatus && i.parentFailed() {
+			return i.emptyResult()
+		}
+	}
+
+	return i.GetParentResult()
+}
+
+func (i *IfNode) matchCondition() (bool, *Result) {
+	if i.CheckedCondition != nil {
+		return i.checkCondition(i.CheckedCondition)
+	}
+	if !i.ByStatus {
+		return i.Condition(i.Data), nil
+	}
+	result := i.GetParentResult()
+	if result == nil {
+		return i.StatusCode == 0, nil
+	}
+	return result.Err == nil && result.StatusCode == i.StatusCode, nil
+}
+
+func (i *IfNode) GetFunctorCount() int {
+	return len(i.Functors)
+}
+
+func (i *IfNode) Run() {
+	i.run(i.ImplTask)
+}
+
+func (i *IfNode) String() string {
+	return describeNode(i)
+}
+
+//END IfNode
+
+//ElseNode Implementation
+type ElseNode struct {
+	*BasicFlowNode
+	Functors []ICallable
+}
+
+func NewElseNode(data *DataSet, parentResult **Result, functors ...ICallable) *ElseNode {
+	return &ElseNode{BasicFlowNode: NewBasicFlowNode(data, parentResult, ElseNodeType), Functors: functors}
+}
+
+func (e *ElseNode) ImplTask() *Result {
+	if result := e.runEach(e.Functors); result != nil {
+		return result
+	}
+	return e.GetParentResult()
+}
+
+func (e *ElseNode) GetFunctorCount() int {
+	return len(e.Functors)
+}
+
+func (e *ElseNode) Run() {
+	e.run(e.ImplTask)
+}
+
+func (e *ElseNode) String() string {
+	return describeNode(e)
+}
+
+//END ElseNode
+
+// ElseIfNode Implementation
+
+// ElseIfNode uses CheckedCondition instead of Condition if it's set, like IfNode.
+type ElseIfNode struct {
+	*BasicFlowNode
+	Condition        IBoolFunc
+	CheckedCondition ICheckedBoolFunc
+	Functors         []ICallable
+}
+
+func NewElseIfNode(data *DataSet, parentResult **Result, condition IBoolFunc, functors ...ICallable) *ElseIfNode {
+	return &ElseIfNode{
+		BasicFlowNode: NewBasicFlowNode(data, parentResult, ElseIfNodeType),
+		Condition:     condition,
+		Functors:      functors,
+	}
+}
+
+func (e *ElseIfNode) ImplTask() *Result {
+	if e.Condition == nil && e.CheckedCondition == nil {
+		return &Result{
+			Err:        NewConditionNotFoundErrorFor(e.Note),
+			StatusCode: 0,
+			StatusMsg:  "",
+		}
+	}
+
+	matched := false
+	if e.CheckedCondition != nil {
+		var failure *Result
+		if matched, failure = e.checkCondition(e.CheckedCondition); failure != nil {
+			return failure
+		}
+	} else {
+		matched = e.Condition(e.Data)
+	}
+	e.setMatched(matched)
+	if matched {
+		if result := e.runEach(e.Functors); result != nil {
+			return result
+		}
+		e.skipBranches(true)
+	}
+
+	return e.GetParentResult()
+}
+
+func (e *ElseIfNode) GetFunctorCount() int {
+	return len(e.Functors)
+}
+
+func (e *ElseIfNode) Run() {
+	e.run(e.ImplTask)
+}
+
+func (e *ElseIfNode) String() string {
+	return describeNode(e)
+}
+
+//END ElseIfNode
+
+//NormalNode Implementation
+
+// NormalNode stops at the first functor which fails, unless RunAll is set, in which case all the functors run, even
+// after one has panicked, and the result is the first failure. If Return is set, the flow ends after the node once all
+// the functors have succeeded, as if the last one had returned ReturnEarly. If Provider is set, the functors are the ones
+// it gives each time the node runs instead. Dynamic tells the node was made by DoDynamic, even with a nil Provider.
+type NormalNode struct {
+	*BasicFlowNode
+	Functors []ICallable
+	RunAll   bool
+	Return   bool
+	Provider IFunctorProvider
+	Dynamic  bool
+}
+
+func NewNormalNode(data *DataSet, parentResult **Result, functors ...ICallable) *NormalNode {
+	return &NormalNode{BasicFlowNode: NewBasicFlowNode(data, parentResult, NormalNodeType), Functors: functors}
+}
+
+func (n *NormalNode) ImplTask() *Result {
+	result := n.runFunctors()
+	if n.Return && !n.isFailure(result) {
+		return ReturnEarly()
+	}
+	return result
+}
+
+func (n *NormalNode) runFunctors() *Result {
+	if n.RunAll {
+		return n.runAll()
+	}
+	if result := n.runEach(n.functors()); result != nil {
+		return result
+	}
+	return n.GetParentResult()
+}
+
+func (n *NormalNode) runAll() *Result {
+	var failure, request *Result
+	for _, functor := range n.functors() {
+		if functor == nil {
+			continue
+		}
+		f := functor
+		result := n.recoverTask(func() *Result {
+			return f(n.Data)
+		})
+		if isFlowRequest(result) {
+			if request == nil {
+				request = result
+			}
+		} else if failure == nil && n.isFailure(result) {
+			failure = result
+		}
+	}
+	if failure != nil {
+		return failure
+	}
+	if request != nil {
+		return request
+	}
+	return n.GetParentResult()
+}
+
+func (n *NormalNode) functors() []ICallable {
+	if n.Provider != nil {
+		return n.Provider(n.Data)
+	}
+	return n.Functors
+}
+
+func (n *NormalNode) GetFunctorCount() int {
+	return len(n.Functors)
+}
+
+func (n *NormalNode) Run() {
+	n.run(n.ImplTask)
+}
+
+func (n *NormalNode) String() string {
+	return describeNode(n)
+}
+
+//END NormalNode
+
+//PrevNode Implementation
+
+// PrevNode is like NormalNode, but each functor gets the result so far along with the data.
+type PrevNode struct {
+	*BasicFlowNode
+	Functors []IPrevCallable
+}
+
+func NewPrevNode(data *DataSet, parentResult **Result, functors ...IPrevCallable) *PrevNode {
+	return &PrevNode{BasicFlowNode: NewBasicFlowNode(data, parentResult, PrevNodeType), Functors: functors}
+}
+
+func (p *PrevNode) ImplTask() *Result {
+	for _, functor := range p.Functors {
+		if functor == nil {
+			continue
+		}
+		result := functor(p.Data, p.GetParentResult())
+		if p.isFailure(result) {
+			return result
+		}
+	}
+	return p.GetParentResult()
+}
+
+func (p *PrevNode) GetFunctorCount() int {
+	return len(p.Functors)
+}
+
+func (p *PrevNode) Run() {
+	p.run(p.ImplTask)
+}
+
+func (p *PrevNode) String() string {
+	return describeNode(p)
+}
+
+//END PrevNode
+
+//TapNode Implementation
+
+// TapNode only looks at the data and the result so far, the functors get a copy of the result so the flow goes on with
+// the same one.
+type TapNode struct {
+	*BasicFlowNode
+	Functors []ITapFunc
+}
+
+func NewTapNode(data *DataSet, parentResult **Result, functors ...ITapFunc) *TapNode {
+	return &TapNode{BasicFlowNode: NewBasicFlowNode(data, parentResult, TapNodeType), Functors: functors}
+}
+
+func (t *TapNode) ImplTask() *Result {
+	for _, functor := range t.Functors {
+		if functor == nil {
+			continue
+		}
+		var result *Result
+		if current := t.GetParentResult(); current != nil {
+			snapshot := *current
+			result = &snapshot
+		}
+		functor(t.Data, result)
+	}
+	return t.GetParentResult()
+}
+
+func (t *TapNode) GetFunctorCount() int {
+	return len(t.Functors)
+}
+
+func (t *TapNode) Run() {
+	t.run(t.ImplTask)
+}
+
+func (t *TapNode) String() string {
+	return describeNode(t)
+}
+
+//END TapNode
+
+//FallbackNode Implementation
+
+// FallbackNode only runs when the flow has failed. It clears the failure first, so the flow goes on if the functors
+// succeed.
+type FallbackNode struct {
+	*BasicFlowNode
+	Functors []ICallable
+}
+
+func NewFallbackNode(data *DataSet, parentResult **Result, functors ...ICallable) *FallbackNode {
+	node := &FallbackNode{BasicFlowNode: NewBasicFlowNode(data, parentResult, FallbackNodeType), Functors: functors}
+	node.RunMode = RunOnFailure
+	return node
+}
+
+func (f *FallbackNode) ImplTask() *Result {
+	f.SetParentResult(f.emptyResult())
+	if result := f.runEach(f.Functors); result != nil {
+		return result
+	}
+	return f.GetParentResult()
+}
+
+func (f *FallbackNode) GetFunctorCount() int {
+	return len(f.Functors)
+}
+
+func (f *FallbackNode) Run() {
+	f.run(f.ImplTask)
+}
+
+func (f *FallbackNode) String() string {
+	return describeNode(f)
+}
+
+//END FallbackNode
+
+//RouteNode Implementation
+
+// RouteNode runs the functors of the route for the StatusCode of the result so far, or the default route if there is no
+// such route, even if the code means failure. The result is cleared before a route runs, so the route decides how the
+// flow goes on. A result with Err is not routed and left as it is.
+type RouteNode struct {
+	*BasicFlowNode
+	Routes       map[int64][]ICallable
+	DefaultRoute []ICallable
+}
+
+func NewRouteNode(data *DataSet, parentResult **Result, routes map[int64][]ICallable, defaultRoute []ICallable) *RouteNode {
+	node := &RouteNode{
+		BasicFlowNode: NewBasicFlowNode(data, parentResult, RouteNodeType),
+		Routes:        routes,
+		DefaultRoute:  defaultRoute,
+	}
+	node.RunMode = RunAlways
+	return node
+}
+
+func (r *RouteNode) ImplTask() *Result {
+	parent := r.GetParentResult()
+	if parent != nil && parent.Err != nil {
+		return parent
+	}
+	var code int64
+	if parent != nil {
+		code = parent.StatusCode
+	}
+	functors, ok := r.Routes[code]
+	if !ok {
+		if r.DefaultRoute == nil {
+			return parent
+		}
+		functors = r.DefaultRoute
+	}
+
+	r.SetParentResult(r.emptyResult())
+	if result := r.runEach(functors); result != nil {
+		return result
+	}
+	return r.GetParentResult()
+}
+
+func (r *RouteNode) GetFunctorCount() int {
+	count := len(r.DefaultRoute)
+	for _, functors := range r.Routes {
+		count += len(functors)
+	}
+	return count
+}
+
+func (r *RouteNode) Run() {
+	r.run(r.ImplTask)
+}
+
+func (r *RouteNode) String() string {
+	return describeNode(r)
+}
+
+//END RouteNode
+
+//SplitNode Implementation
+
+type WeightedBranch struct {
+	Weight   int
+	Functors []ICallable
+}
+
+// SplitNode runs one of the branches, chosen at random by their weights each time it runs, and Chosen is the index of
+// the branch of the last run. Rand is the global source if it's nil; a Rand given is not safe to share between flows
+// running at the same time. The branches whose weight isn't positive are never chosen.
+type SplitNode struct {
+	*BasicFlowNode
+	Rand     *rand.Rand
+	Branches []WeightedBranch
+	Chosen   int
+}
+
+func NewSplitNode(data *DataSet, parentResult **Result, rng *rand.Rand, branches []WeightedBranch) *SplitNode {
+	return &SplitNode{
+		BasicFlowNode: NewBasicFlowNode(data, parentResult, SplitNodeType),
+		Rand:          rng,
+		Branches:      branches,
+		Chosen:        -1,
+	}
+}
+
+func (s *SplitNode) ImplTask() *Result {
+	s.Chosen = s.choose()
+	if s.Chosen < 0 {
+		return s.GetParentResult()
+	}
+	if result := s.runEach(s.Branches[s.Chosen].Functors); result != nil {
+		return result
+	}
+	return s.GetParentResult()
+}
+
+func (s *SplitNode) choose() int {
+	total := s.TotalWeight()
+	if total <= 0 {
+		return -1
+	}
+	var pick int
+	if s.Rand != nil {
+		pick = s.Rand.Intn(total)
+	} else {
+		pick = rand.Intn(total)
+	}
+	for i, branch := range s.Branches {
+		if branch.Weight <= 0 {
+			continue
+		}
+		if pick < branch.Weight {
+			return i
+		}
+		pick -= branch.Weight
+	}
+	return -1
+}
+
+// TotalWeight is the sum of the positive weights.
+func (s *SplitNode) TotalWeight() int {
+	total := 0
+	for _, branch := range s.Branches {
+		if branch.Weight > 0 {
+			total += branch.Weight
+		}
+	}
+	return total
+}
+
+func (s *SplitNode) GetFunctorCount() int {
+	count := 0
+	for _, branch := range s.Branches {
+		count += len(branch.Functors)
+	}
+	return count
+}
+
+func (s *SplitNode) Run() {
+	s.run(s.ImplTask)
+}
+
+func (s *SplitNode) String() string {
+	return describeNode(s)
+}
+
+//END SplitNode
+
+//BreakerNode Implementation
+
+// BreakerNode runs the functors through the CircuitBreaker with the name, which fails the node with CircuitOpenError
+// without running them while it's open. A failure of the functors, a panic included, counts against the breaker.
+type BreakerNode struct {
+	*BasicFlowNode
+	Name     string
+	Breaker  *CircuitBreaker
+	Functors []ICallable
+}
+
+func NewBreakerNode(data *DataSet, parentResult **Result, name string, config BreakerConfig, functors ...ICallable) *BreakerNode {
+	return &BreakerNode{
+		BasicFlowNode: NewBasicFlowNode(data, parentResult, BreakerNodeType),
+		Name:          name,
+		Breaker:       breakerFor(name, config),
+		Functors:      functors,
+	}
+}
+
+func (b *BreakerNode) ImplTask() *Result {
+	if !b.Breaker.allow() {
+		return &Result{
+			Err:        NewCircuitOpenError(b.Note, b.Name),
+			StatusCode: 0,
+			StatusMsg:  "",
+		}
+	}
+	result := b.recoverTask(func() *Result {
+		return b.runEach(b.Functors)
+	})
+	b.Breaker.record(b.isFailure(result) && !isFlowRequest(result))
+	if result != nil {
+		return result
+	}
+	return b.GetParentResult()
+}
+
+func (b *BreakerNode) GetFunctorCount() int {
+	return len(b.Functors)
+}
+
+func (b *BreakerNode) Run() {
+	b.run(b.ImplTask)
+}
+
+func (b *BreakerNode) String() string {
+	return describeNode(b)
+}
+
+//END BreakerNode
+
+//RateLimitedNode Implementation
+
+// RateLimitedNode waits on the limiter before it runs the functors, with the Ctx of the data, or the one given to
+// WaitContext if the data has none. It fails with CancelledError if the Ctx is done while waiting, and with the error of
+// the limiter if it refuses otherwise.
+type RateLimitedNode struct {
+	*BasicFlowNode
+	Limiter  ILimiter
+	Functors []ICallable
+}
+
+func NewRateLimitedNode(data *DataSet, parentResult **Result, limiter ILimiter, functors ...ICallable) *RateLimitedNode {
+	return &RateLimitedNode{
+		BasicFlowNode: NewBasicFlowNode(data, parentResult, RateLimitedNodeType),
+		Limiter:       limiter,
+		Functors:      functors,
+	}
+}
+
+func (r *RateLimitedNode) ImplTask() *Result {
+	if r.Limiter != nil {
+		if err := r.Limiter.Wait(r.context()); err != nil {
+			if result := r.checkCancelled(); result != nil {
+				return result
+			}
+			return &Result{
+				Err:        err,
+				StatusCode: 0,
+				StatusMsg:  "",
+			}
+		}
+	}
+	if result := r.runEach(r.Functors); result != nil {
+		return result
+	}
+	return r.GetParentResult()
+}
+
+func (r *RateLimitedNode) context() context.Context {
+	if r.Data != nil && r.Data.Ctx != nil {
+		return r.Data.Ctx
+	}
+	if r.engine != nil && r.engine.ctx != nil {
+		return r.engine.ctx
+	}
+	return context.Background()
+}
+
+func (r *RateLimitedNode) GetFunctorCount() int {
+	return len(r.Functors)
+}
+
+func (r *RateLimitedNode) Run() {
+	r.run(r.ImplTask)
+}
+
+func (r *RateLimitedNode) String() string {
+	return describeNode(r)
+}
+
+//END RateLimitedNode
+
+//AssertNode Implementation
+
+// AssertNode fails with AssertionFailedError if Check doesn't hold for the data and the result so far, and does nothing
+// otherwise.
+type AssertNode struct {
+	*BasicFlowNode
+	Name  string
+	Check IAssertFunc
+}
+
+func NewAssertNode(data *DataSet, parentResult **Result, name string, check IAssertFunc) *AssertNode {
+	return &AssertNode{
+		BasicFlowNode: NewBasicFlowNode(data, parentResult, AssertNodeType),
+		Name:          name,
+		Check:         check,
+	}
+}
+
+func (a *AssertNode) ImplTask() *Result {
+	if a.Check == nil {
+		return &Result{
+			Err:        NewConditionNotFoundErrorFor(a.Note),
+			StatusCode: 0,
+			StatusMsg:  "",
+		}
+	}
+	if !a.Check(a.Data, a.GetParentResult()) {
+		return &Result{
+			Err:        NewAssertionFailedError(a.Note, a.Name),
+			StatusCode: 0,
+			StatusMsg:  "",
+		}
+	}
+	return a.GetParentResult()
+}
+
+func (a *AssertNode) GetFunctorCount() int {
+	return 0
+}
+
+func (a *AssertNode) Run() {
+	a.run(a.ImplTask)
+}
+
+func (a *AssertNode) String() string {
+	return describeNode(a)
+}
+
+//END AssertNode
+
+//CompensableNode Implementation
+
+// CompensableNode runs Action, and if it succeeds, Compensate is kept by the flow to undo it in case a later node fails.
+type CompensableNode struct {
+	*BasicFlowNode
+	Action     ICallable
+	Compensate ICallable
+}
+
+func NewCompensableNode(data *DataSet, parentResult **Result, action ICallable, compensate ICallable) *CompensableNode {
+	return &CompensableNode{
+		BasicFlowNode: NewBasicFlowNode(data, parentResult, CompensableNodeType),
+		Action:        action,
+		Compensate:    compensate,
+	}
+}
+
+func (c *CompensableNode) ImplTask() *Result {
+	result := callFunctor(c.Action, c.Data)
+	if c.isFailure(result) && !isFlowRequest(result) {
+		return result
+	}
+	if c.Compensate != nil && c.engine != nil {
+		c.outside(func() {
+			c.engine.compensations = append(c.engine.compensations, c.Compensate)
+		})
+	}
+	if isFlowRequest(result) {
+		return result
+	}
+	return c.GetParentResult()
+}
+
+func (c *CompensableNode) GetFunctorCount() int {
+	if c.Compensate != nil {
+		return 2
+	}
+	return 1
+}
+
+func (c *CompensableNode) Run() {
+	c.run(c.ImplTask)
+}
+
+func (c *CompensableNode) String() string {
+	return describeNode(c)
+}
+
+//END CompensableNode
+
+//CombineNode Implementation
+
+type ICombineFunc = func(results []*Result) *Result
+
+// CombineNode merges the results of the nodes with the notes, which must have run earlier in the same run.
+type CombineNode struct {
+	*BasicFlowNode
+	Notes []string
+	Merge ICombineFunc
+}
+
+func NewCombineNode(data *DataSet, parentResult **Result, notes []string, merge ICombineFunc) *CombineNode {
+	return &CombineNode{
+		BasicFlowNode: NewBasicFlowNode(data, parentResult, CombineNodeType),
+		Notes:         notes,
+		Merge:         merge,
+	}
+}
+
+func (c *CombineNode) ImplTask() *Result {
+	results := make([]*Result, 0, len(c.Notes))
+	for _, note := range c.Notes {
+		var result *Result
+		ok := false
+		if c.engine != nil {
+			result, ok = c.engine.ResultByNote(note)
+		}
+		if !ok {
+			return &Result{
+				Err:        NewNodeNotRunError(c.Note, note),
+				StatusCode: 0,
+				StatusMsg:  "",
+			}
+		}
+		results = append(results, result)
+	}
+	if c.Merge == nil {
+		return c.GetParentResult()
+	}
+	return c.Merge(results)
+}
+
+func (c *CombineNode) GetFunctorCount() int {
+	if c.Merge != nil {
+		return 1
+	}
+	return 0
+}
+
+func (c *CombineNode) Run() {
+	c.run(c.ImplTask)
+}
+
+func (c *CombineNode) String() string {
+	return describeNode(c)
+}
+
+//END CombineNode
+
+//TimeoutFallbackNode Implementation
+
+// TimeoutFallbackNode runs Primary, and Fallback instead if Primary fails or takes longer than PrimaryTimeout. The
+// result of the one which is used becomes the result of the node even if it succeeds. Primary runs on a copy of the data
+// made like for SetTimeout, which is only copied back if it's done in time, so once it's left running in the background
+// it can't get in the way of Fallback and the nodes after it. There's no timeout if PrimaryTimeout isn't positive.
+type TimeoutFallbackNode struct {
+	*BasicFlowNode
+	PrimaryTimeout time.Duration
+	Primary        ICallable
+	Fallback       ICallable
+}
+
+func NewTimeoutFallbackNode(data *DataSet, parentResult **Result, timeout time.Duration, primary ICallable, fallback ICallable) *TimeoutFallbackNode {
+	return &TimeoutFallbackNode{
+		BasicFlowNode:  NewBasicFlowNode(data, parentResult, TimeoutFallbackNodeType),
+		PrimaryTimeout: timeout,
+		Primary:        primary,
+		Fallback:       fallback,
+	}
+}
+
+func (t *TimeoutFallbackNode) ImplTask() *Result {
+	result := t.runPrimary()
+	if t.isFailure(result) && !isFlowRequest(result) {
+		result = callFunctor(t.Fallback, t.Data)
+	}
+	if result == nil {
+		return t.GetParentResult()
+	}
+	return result
+}
+
+func (t *TimeoutFallbackNode) runPrimary() *Result {
+	if t.PrimaryTimeout <= 0 {
+		return t.recoverTask(func() *Result {
+			return callFunctor(t.Primary, t.Data)
+		})
+	}
+	data := t.copyData()
+	resultChan := make(chan *Result, 1)
+	go func() {
+		resultChan <- t.recoverTask(func() *Result {
+			return callFunctor(t.Primary, data)
+		})
+	}()
+	select {
+	case result := <-resultChan:
+		if data != nil {
+			*t.Data = *data
+		}
+		return result
+	case <-Clock.After(t.PrimaryTimeout):
+		return &Result{
+			Err:        NewNodeTimeoutError(t.Note, t.PrimaryTimeout),
+			StatusCode: 0,
+			StatusMsg:  "",
+		}
+	}
+}
+
+func (t *TimeoutFallbackNode) GetFunctorCount() int {
+	return 2
+}
+
+func (t *TimeoutFallbackNode) Run() {
+	t.run(t.ImplTask)
+}
+
+func (t *TimeoutFallbackNode) String() string {
+	return describeNode(t)
+}
+
+//END TimeoutFallbackNode
+
+//GotoNode Implementation
+
+// GotoNode jumps to the first node with the note Target if the condition holds, even if the flow has failed, and the
+// failure is cleared so that the nodes jumped to can run again. The flow fails once it has jumped more than the
+// limit set by SetMaxJumps.
+type GotoNode struct {
+	*BasicFlowNode
+	Target    string
+	Condition IBoolFunc
+}
+
+const DefaultMaxJumps = 100
+
+func NewGotoNode(data *DataSet, parentResult **Result, target string, condition IBoolFunc) *GotoNode {
+	node := &GotoNode{
+		BasicFlowNode: NewBasicFlowNode(data, parentResult, GotoNodeType),
+		Target:        target,
+		Condition:     condition,
+	}
+	node.RunMode = RunAlways
+	return node
+}
+
+func (g *GotoNode) ImplTask() *Result {
+	if g.Condition == nil {
+		return &Result{
+			Err:        NewConditionNotFoundErrorFor(g.Note),
+			StatusCode: 0,
+			StatusMsg:  "",
+		}
+	}
+	if !g.Condition(g.Data) || g.engine == nil {
+		return g.GetParentResult()
+	}
+	var result *Result
+	g.outside(func() {
+		result = g.engine.jump(g.Note, g.Target)
+	})
+	if result != nil {
+		return result
+	}
+	return g.emptyResult()
+}
+
+func (g *GotoNode) GetFunctorCount() int {
+	return 0
+}
+
+func (g *GotoNode) Run() {
+	g.run(g.ImplTask)
+}
+
+func (g *GotoNode) String() string {
+	return describeNode(g)
+}
+
+//END GotoNode
+
+//RaceNode Implementation
+
+// RaceNode runs the functors concurrently and takes the first clean result, or the last failure if they all fail.
+// Each functor gets a shallow copy of the data whose Ctx is cancelled once there's a winner, so the others know to
+// stop, and only the copy of the winner is copied back into the data, with the original Ctx.
+type RaceNode struct {
+	*BasicFlowNode
+	Functors []ICallable
+}
+
+func NewRaceNode(data *DataSet, parentResult **Result, functors ...ICallable) *RaceNode {
+	return &RaceNode{BasicFlowNode: NewBasicFlowNode(data, parentResult, RaceNodeType), Functors: functors}
+}
+
+type raceOutcome struct {
+	result *Result
+	data   *DataSet
+}
+
+func (r *RaceNode) ImplTask() *Result {
+	functors := make([]ICallable, 0, len(r.Functors))
+	for _, functor := range r.Functors {
+		if functor != nil {
+			functors = append(functors, functor)
+		}
+	}
+	if len(functors) == 0 {
+		return r.GetParentResult()
+	}
+	parent := context.Background()
+	if r.Data != nil && r.Data.Ctx != nil {
+		parent = r.Data.Ctx
+	}
+	ctx, cancel := context.WithCancel(parent)
+	defer cancel()
+
+	outcomes := make(chan raceOutcome, len(functors))
+	for _, functor := range functors {
+		data := &DataSet{}
+		if r.Data != nil {
+			data = ShallowCloneData(r.Data)
+		}
+		data.Ctx = ctx
+		go func(f ICallable, data *DataSet) {
+			defer func() {
+				if a := recover(); a != nil {
+					outcomes <- raceOutcome{result: r.panicked(a, debug.Stack())}
+				}
+			}()
+			outcomes <- raceOutcome{result: f(data), data: data}
+		}(functor, data)
+	}
+
+	var last *Result
+	for range functors {
+		select {
+		case outcome := <-outcomes:
+			if r.isFailure(outcome.result) {
+				last = outcome.result
+				continue
+			}
+			cancel()
+			if r.Data != nil {
+				original := r.Data.Ctx
+				*r.Data = *outcome.data
+				r.Data.Ctx = original
+			}
+			if outcome.result == nil {
+				return r.GetParentResult()
+			}
+			return outcome.result
+		case <-parent.Done():
+			return r.checkCancelled()
+		case <-r.flowDone():
+			return r.checkCancelled()
+		}
+	}
+	return last
+}
+
+func (r *RaceNode) GetFunctorCount() int {
+	return len(r.Functors)
+}
+
+func (r *RaceNode) Run() {
+	r.run(r.ImplTask)
+}
+
+func (r *RaceNode) String() string {
+	return describeNode(r)
+}
+
+//END RaceNode
+
+//ForNode Implementation
+
+// ForNode keeps the result of each iteration of the last run in Iterations, which is the result of the last functor, or
+// the failure which has ended the loop.
+type ForNode struct {
+	*BasicFlowNode
+	Times      int
+	Functors   []ICallable
+	Iterations []*Result
+}
+
+func NewForNode(times int, data *DataSet, parentResult **Result, functors ...ICallable) *ForNode {
+	return &ForNode{
+		BasicFlowNode: NewBasicFlowNode(data, parentResult, ForNodeType),
+		Times:         times,
+		Functors:      functors,
+	}
+}
+
+func (f *ForNode) ImplTask() *Result {
+	f.Iterations = make([]*Result, 0, f.Times)
+	for i := 0; i < f.Times; i++ {
+		if result := f.checkCancelled(); result != nil {
+			return result
+		}
+		var last *Result
+		for _, functor := range f.Functors {
+			if functor == nil {
+				continue
+			}
+			last = functor(f.Data)
+			if f.isFailure(last) {
+				f.Iterations = append(f.Iterations, last)
+				return last
+			}
+		}
+		f.Iterations = append(f.Iterations, last)
+	}
+	return f.GetParentResult()
+}
+
+func (f *ForNode) IterationResults() []*Result {
+	return f.Iterations
+}
+
+func (f *ForNode) GetFunctorCount() int {
+	return len(f.Functors)
+}
+
+func (f *ForNode) Run() {
+	f.run(f.ImplTask)
+}
+
+func (f *ForNode) String() string {
+	return describeNode(f)
+}
+
+//END NormalNode
+
+//ForEachNode Implementation
+
+// ForEachNode runs the body once for each of the items got from the data when the node runs, and stops at the first
+// failure. If MaxWorkers is positive, the items are run by that many goroutines with the same Data, so the body must not
+// mutate it, a panic only fails its own item, and once an item has failed or the flow is cancelled no more items are
+// started, the result is the first failure.
+type ForEachNode struct {
+	*BasicFlowNode
+	Items      IItemsFunc
+	Body       IItemCallable
+	MaxWorkers int
+}
+
+func NewForEachNode(data *DataSet, parentResult **Result, items IItemsFunc, body IItemCallable) *ForEachNode {
+	return &ForEachNode{
+		BasicFlowNode: NewBasicFlowNode(data, parentResult, ForEachNodeType),
+		Items:         items,
+		Body:          body,
+	}
+}
+
+func (f *ForEachNode) ImplTask() *Result {
+	if f.Items == nil || f.Body == nil {
+		return f.GetParentResult()
+	}
+	if f.MaxWorkers > 0 && !f.deterministic() {
+		return f.runParallel(f.Items(f.Data))
+	}
+	for _, item := range f.Items(f.Data) {
+		if result := f.checkCancelled(); result != nil {
+			return result
+		}
+		result := f.Body(f.Data, item)
+		if f.isFailure(result) {
+			return result
+		}
+	}
+	return f.GetParentResult()
+}
+
+func (f *ForEachNode) runParallel(items []interface{}) *Result {
+	indexes := make(chan int, len(items))
+	for i := range items {
+		indexes <- i
+	}
+	close(indexes)
+
+	var mutex sync.Mutex
+	var failure *Result
+	failed := func() bool {
+		mutex.Lock()
+		defer mutex.Unlock()
+		return failure != nil
+	}
+
+	workers := f.MaxWorkers
+	if workers > len(items) {
+		workers = len(items)
+	}
+	wg := sync.WaitGroup{}
+	wg.Add(workers)
+	for w := 0; w < workers; w++ {
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				if failed() {
+					return
+				}
+				item := items[i]
+				result := f.checkCancelled()
+				if result == nil {
+					result = f.recoverTask(func() *Result {
+						return f.Body(f.Data, item)
+					})
+				}
+				if f.isFailure(result) {
+					mutex.Lock()
+					if failure == nil {
+						failure = result
+					}
+					mutex.Unlock()
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	if failure != nil {
+		return failure
+	}
+	return f.GetParentResult()
+}
+
+func (f *ForEachNode) GetFunctorCount() int {
+	return 1
+}
+
+func (f *ForEachNode) Run() {
+	f.run(f.ImplTask)
+}
+
+func (f *ForEachNode) String() string {
+	return describeNode(f)
+}
+
+//END ForEachNode
+
+//ParallelNode Implementation
+
+// CloneMode tells when the functors of a Parallel node get their own copies of the data. By default it's only when there
+// is a merger, so the flows which don't ask for it never copy anything. CloneAlways gives the functors a snapshot even if
+// it's not merged back, that is, what they write to the data is lost. CloneNever shares the data anyway.
+type CloneMode int64
+
+const (
+	CloneAuto CloneMode = iota
+	CloneAlways
+	CloneNever
+)
+
+// ShallowCloneData is the default IDataCloneFunc used by an isolated ParallelNode. The fields are copied by value, so
+// pointers, maps and slices are still shared with the origin.
+func ShallowCloneData(_data *DataSet) *DataSet {
+	clone := *_data
+	return &clone
+}
+
+// ParallelNode runs all the functors concurrently with the same Data, so the functors must not mutate Data unless the
+// node is isolated by a Merger. When Merger is set, each functor gets its own copy made by Cloner and all the copies are
+// merged back into Data in the order of the functors after all of them finish. The flow may also give a Merger and a
+// Cloner to all its Parallel nodes, see CloneMode.
+// Results keeps the results of all the functors of the last run in the order they finished, while the node result
+// is still the first failure. Durations keeps how long each functor that ran took, in the order of the functors.
+// A Conditional node starts no functor unless Condition holds. If Gather is set, Gathered keeps the results of the last
+// run in the order of the functors, nil for the ones a guard has left out.
+// At most MaxConcurrency functors run at the same time, and there is no limit if it's not positive.
+// If Guards is set, it has a condition for each functor, and only the functors whose condition holds are run.
+// If Reducer is set, the node result is every result folded by it in the order they finished, from the result so far.
+// Errors keeps the Err of the results of the last run by the index of the functor, for the ones which have one.
+type ParallelNode struct {
+	*BasicFlowNode
+	Times          int
+	Functors       []ICallable
+	Guards         []IBoolFunc
+	Cloner         IDataCloneFunc
+	Merger         IDataMergeFunc
+	Results        []*Result
+	Durations      []time.Duration
+	MaxConcurrency int
+	Conditional    bool
+	Condition      IBoolFunc
+	Gather         bool
+	Gathered       []*Result
+	Reducer        IResultReduceFunc
+	Errors         map[int]error
+}
+
+type ConditionalBranch struct {
+	Condition IBoolFunc
+	Functor   ICallable
+}
+
+func NewParallelNode(data *DataSet, parentResult **Result, functors ...ICallable) *ParallelNode {
+	return &ParallelNode{
+		BasicFlowNode: NewBasicFlowNode(data, parentResult, ParallelNodeType),
+		Functors:      functors,
+	}
+}
+
+func (p *ParallelNode) ImplTask() *Result {
+	if p.Conditional {
+		if p.Condition == nil {
+			return &Result{
+				Err:        NewConditionNotFoundErrorFor(p.Note),
+				StatusCode: 0,
+				StatusMsg:  "",
+			}
+		}
+		if !p.Condition(p.Data) {
+			p.Results, p.Durations, p.Gathered, p.Errors = nil, nil, nil, nil
+			return p.GetParentResult()
+		}
+	}
+
+	functors, positions := make([]ICallable, 0, len(p.Functors)), make([]int, 0, len(p.Functors))
+	for i, functor := range p.Functors {
+		if p.Guards != nil && p.Guards[i] == nil {
+			return &Result{
+				Err:        NewConditionNotFoundErrorFor(p.Note),
+				StatusCode: 0,
+				StatusMsg:  "",
+			}
+		}
+		if functor == nil || p.Guards != nil && !p.Guards[i](p.Data) {
+			continue
+		}
+		functors = append(functors, functor)
+		positions = append(positions, i)
+	}
+
+	resultChan := make(chan *Result, len(functors))
+
+	wg := sync.WaitGroup{}
+	wg.Add(len(functors))
+
+	go func(wg *sync.WaitGroup) {
+		wg.Wait()
+		close(resultChan)
+	}(&wg)
+
+	merger, cloner, clone := p.isolation()
+	var dataList []*DataSet
+	if clone {
+		dataList = make([]*DataSet, len(functors))
+		for i := range functors {
+			dataList[i] = cloner(p.Data)
+		}
+	}
+
+	var semaphore chan struct{}
+	if p.deterministic() {
+		// Each functor starts once the one before it has finished
+		semaphore = make(chan struct{}, 1)
+	} else if p.MaxConcurrency > 0 {
+		semaphore = make(chan struct{}, p.MaxConcurrency)
+	}
+
+	// Once the Ctx of the data or the ctx of the flow is done, no more functors are started
+	var dataCtx, flowCtx context.Context
+	if p.Data != nil {
+		dataCtx = p.Data.Ctx
+	}
+	if p.engine != nil {
+		flowCtx = p.engine.ctx
+	}
+	done, flowDone := ctxDone(dataCtx), ctxDone(flowCtx)
+	cancelled := func() *Result {
+		for _, ctx := range []context.Context{dataCtx, flowCtx} {
+			if ctx != nil && ctx.Err() != nil {
+				return &Result{
+					Err:        NewCancelledError(p.Note, ctx.Err()),
+					StatusCode: 0,
+					StatusMsg:  "",
+				}
+			}
+		}
+		return nil
+	}
+
+	durations := make([]time.Duration, len(functors))
+	gathered := make([]*Result, len(p.Functors))
+	started := 0
+	for i, functor := range functors {
+		if cancelled() != nil {
+			break
+		}
+		if semaphore != nil {
+			select {
+			case semaphore <- struct{}{}:
+			case <-done:
+			case <-flowDone:
+			}
+			if cancelled() != nil {
+				break
+			}
+		}
+		started++
+		go func(wg *sync.WaitGroup, f ICallable, data *DataSet, duration *time.Duration, slot **Result) {
+			start := Clock.Now()
+			defer func() {
+				if a := recover(); a != nil {
+					*slot = p.panicked(a, debug.Stack())
+					resultChan <- *slot
+				}
+				*duration = Clock.Now().Sub(start)
+				if semaphore != nil {
+					<-semaphore
+				}
+				wg.Done()
+			}()
+			if result := cancelled(); result != nil {
+				*slot = result
+			} else {
+				*slot = f(data)
+			}
+			resultChan <- *slot
+		}(&wg, functor, p.branchData(dataList, i), &durations[i], &gathered[positions[i]])
+	}
+	for i := started; i < len(functors); i++ {
+		wg.Done()
+	}
+
+	p.Results = make([]*Result, 0, len(functors))
+	result := p.GetParentResult()
+	for draining := true; draining; {
+		select {
+		case item, ok := <-resultChan:
+			if !ok {
+				draining = false
+				break
+			}
+			p.Results = append(p.Results, item)
+			if p.Reducer != nil {
+				result = p.Reducer(result, item)
+				continue
+			}
+			if p.isFailure(result) {
+				continue
+			}
+			result = item
+		case <-done:
+			// The functors still running are left behind, and their copies of the data are not merged.
+			p.Durations, p.Gathered, p.Errors = nil, nil, nil
+			return p.checkCancelled()
+		case <-flowDone:
+			p.Durations, p.Gathered, p.Errors = nil, nil, nil
+			return p.checkCancelled()
+		}
+	}
+	p.Durations = durations
+	if p.Gather {
+		p.Gathered = gathered
+	}
+	p.Errors = make(map[int]error)
+	for i, item := range gathered {
+		if item != nil && item.Err != nil {
+			p.Errors[i] = item.Err
+		}
+	}
+
+	if clone && merger != nil {
+		for _, data := range dataList {
+			merger(p.Data, data)
+		}
+	}
+
+	return result
+}
+
+// isolation tells whether the functors get their own copies of the data, and how the copies are made and merged back.
+// The merger and the cloner of the node come first, and then the ones of the flow.
+func (p *ParallelNode) isolation() (IDataMergeFunc, IDataCloneFunc, bool) {
+	merger, cloner, mode := p.Merger, p.Cloner, CloneAuto
+	if p.engine != nil {
+		if merger == nil {
+			merger = p.engine.dataMerger
+		}
+		if cloner == nil {
+			cloner = p.engine.dataCloner
+		}
+		mode = p.engine.cloneMode
+	}
+	if cloner == nil {
+		cloner = ShallowCloneData
+	}
+	switch mode {
+	case CloneAlways:
+		return merger, cloner, true
+	case CloneNever:
+		return merger, cloner, false
+	default:
+		return merger, cloner, merger != nil
+	}
+}
+
+func (p *ParallelNode) branchData(dataList []*DataSet, index int) *DataSet {
+	if dataList == nil {
+		return p.Data
+	}
+	return dataList[index]
+}
+
+func (p *ParallelNode) GetResults() []*Result {
+	return p.Results
+}
+
+func (p *ParallelNode) GetGathered() []*Result {
+	return p.Gathered
+}
+
+func (p *ParallelNode) GetErrors() map[int]error {
+	return p.Errors
+}
+
+func (p *ParallelNode) SetIsolation(merger IDataMergeFunc, cloner IDataCloneFunc) {
+	p.Merger = merger
+	p.Cloner = cloner
+}
+
+func (p *ParallelNode) GetFunctorCount() int {
+	return len(p.Functors)
+}
+
+func (p *ParallelNode) Run() {
+	p.run(p.ImplTask)
+}
+
+func (p *ParallelNode) String() string {
+	return describeNode(p)
+}
+
+//END NormalNode
+
+//PrepareNode Implementation
+
+// PrepareNode is InBranch when it's between an If or ElseIf and the branch following it, it's skipped with the branches
+// once a condition has held, so that it only prepares for the conditions after it.
+type PrepareNode struct {
+	*BasicFlowNode
+	Functors []IPrepareFunc
+	Input    InputParam
+	InBranch bool
+}
+
+func NewPrepareNode(data *DataSet, parentResult **Result, input InputParam, functors ...IPrepareFunc) *PrepareNode {
+	return &PrepareNode{
+		BasicFlowNode: NewBasicFlowNode(data, parentResult, PrepareNodeType),
+		Functors:      functors,
+		Input:         input,
+	}
+}
+
+func (p *PrepareNode) ImplTask() *Result {
+	for _, functor := range p.Functors {
+		if functor == nil {
+			continue
+		}
+		result := functor(p.Data, p.Input)
+		if p.isFailure(result) {
+			return result
+		}
+	}
+	return p.GetParentResult()
+}
+
+func (p *PrepareNode) GetFunctorCount() int {
+	return len(p.Functors)
+}
+
+func (p *PrepareNode) Run() {
+	p.run(p.ImplTask)
+}
+
+func (p *PrepareNode) String() string {
+	return describeNode(p)
+}
+
+//END PrepareNode
+
+//PollNode Implementation
+
+// PollNode runs the functors again and again, Interval apart, until Until holds after a pass. It fails at the first
+// failure of a functor, when the flow is cancelled, or with NodeTimeoutError once MaxDuration has passed, which is not
+// checked if it's not positive.
+type PollNode struct {
+	*BasicFlowNode
+	Interval    time.Duration
+	MaxDuration time.Duration
+	Until       IBoolFunc
+	Functors    []ICallable
+}
+
+func NewPollNode(interval, maxDuration time.Duration, data *DataSet, parentResult **Result, until IBoolFunc, functors ...ICallable) *PollNode {
+	return &PollNode{
+		BasicFlowNode: NewBasicFlowNode(data, parentResult, PollNodeType),
+		Interval:      interval,
+		MaxDuration:   maxDuration,
+		Until:         until,
+		Functors:      functors,
+	}
+}
+
+func (p *PollNode) ImplTask() *Result {
+	if p.Until == nil {
+		return &Result{
+			Err:        NewConditionNotFoundErrorFor(p.Note),
+			StatusCode: 0,
+			StatusMsg:  "",
+		}
+	}
+	start := Clock.Now()
+	for {
+		if result := p.runEach(p.Functors); result != nil {
+			return result
+		}
+		if p.Until(p.Data) {
+			return p.GetParentResult()
+		}
+		if p.MaxDuration > 0 && Clock.Now().Sub(start) >= p.MaxDuration {
+			return &Result{
+				Err:        NewNodeTimeoutError(p.Note, p.MaxDuration),
+				StatusCode: 0,
+				StatusMsg:  "",
+			}
+		}
+		if result := p.wait(); result != nil {
+			return result
+		}
+	}
+}
+
+// wait returns early with a failed result if the flow is cancelled while waiting.
+func (p *PollNode) wait() *Result {
+	var done <-chan struct{}
+	if p.Data != nil && p.Data.Ctx != nil {
+		done = p.Data.Ctx.Done()
+	}
+	select {
+	case <-Clock.After(p.Interval):
+	case <-done:
+	case <-p.flowDone():
+	}
+	return p.checkCancelled()
+}
+
+func (p *PollNode) GetFunctorCount() int {
+	return len(p.Functors)
+}
+
+func (p *PollNode) Run() {
+	p.run(p.ImplTask)
+}
+
+func (p *PollNode) String() string {
+	return describeNode(p)
+}
+
+//END PollNode
+
+//RetryNode Implementation
+
+// RetryNode runs all the functors again if one of them fails, until they all succeed or Attempts runs out. It waits
+// Backoff before the second attempt, and the wait doubles each time after that.
+// BeforeRetry is called between the attempts, not before the first one, to refresh the data. If it returns another
+// pointer, the content is copied into the shared data so that the other nodes can see it.
+// If Version is set, the node retries only on a conflict: the version is taken before each attempt, and the failure is
+// checked by Conflict, or by DefaultConflict if it's nil. If ShouldRetry is set, the node retries only on the failures
+// it tells, and the others are returned at once.
+type RetryNode struct {
+	*BasicFlowNode
+	Attempts    int
+	Backoff     time.Duration
+	BeforeRetry IBeforeRetryFunc
+	Version     IVersionFunc
+	Conflict    IConflictFunc
+	ShouldRetry IRetryFunc
+	Functors    []ICallable
+}
+
+const DefaultVersionCheckAttempts = 3
+
+func NewRetryNode(attempts int, backoff time.Duration, data *DataSet, parentResult **Result, functors ...ICallable) *RetryNode {
+	return &RetryNode{
+		BasicFlowNode: NewBasicFlowNode(data, parentResult, RetryNodeType),
+		Attempts:      attempts,
+		Backoff:       backoff,
+		Functors:      functors,
+	}
+}
+
+func (r *RetryNode) ImplTask() *Result {
+	var result *Result
+	for attempt := 0; attempt == 0 || attempt < r.Attempts; attempt++ {
+		if attempt != 0 {
+			if cancelled := r.wait(r.Backoff << uint(attempt-1)); cancelled != nil {
+				return cancelled
+			}
+			if r.BeforeRetry != nil {
+				if data := r.BeforeRetry(r.Data); data != nil && data != r.Data {
+					*r.Data = *data
+				}
+			}
+		}
+		expected := 0
+		if r.Version != nil {
+			expected = r.Version(r.Data)
+		}
+		result = r.runOnce()
+		if result == nil {
+			return r.GetParentResult()
+		}
+		if isFlowRequest(result) {
+			return result
+		}
+		if r.Version != nil && !r.isConflict(expected, result) {
+			return result
+		}
+		if r.ShouldRetry != nil && !r.ShouldRetry(result) {
+			return result
+		}
+	}
+	return result
+}
+
+// wait returns early with a failed result if the context of the data is done while waiting.
+func (r *RetryNode) wait(backoff time.Duration) *Result {
+	var done <-chan struct{}
+	if r.Data != nil && r.Data.Ctx != nil {
+		done = r.Data.Ctx.Done()
+	}
+	select {
+	case <-Clock.After(backoff):
+	case <-done:
+	case <-r.flowDone():
+	}
+	return r.checkCancelled()
+}
+
+func (r *RetryNode) isConflict(expected int, result *Result) bool {
+	if r.Conflict != nil {
+		return r.Conflict(expected, r.Data, result)
+	}
+	return r.DefaultConflict(expected, r.Data, result)
+}
+
+// DefaultConflict treats a failure as a conflict if the version has changed since the attempt started.
+func (r *RetryNode) DefaultConflict(expected int, _data *DataSet, _result *Result) bool {
+	return r.Version(_data) != expected
+}
+
+func (r *RetryNode) runOnce() *Result {
+	return r.runEach(r.Functors)
+}
+
+func (r *RetryNode) GetFunctorCount() int {
+	return len(r.Functors)
+}
+
+func (r *RetryNode) Run() {
+	r.run(r.ImplTask)
+}
+
+func (r *RetryNode) String() string {
+	return describeNode(r)
+}
+
+//END RetryNode
+
+//FlowEngine Implementation
+
+type FlowEngine struct {
+	data          *DataSet
+	nodes         []IBasicFlowNode
+	result        **Result
+	onFailFunc    IOnFailFunc
+	onSuccessFunc IOnSuccessFunc
+	alwaysFunc    IAlwaysFunc
+	name          string
+	executionID   string
+	startTime     time.Time
+	duration      time.Duration
+	traces        []NodeTrace
+	compensations []ICallable
+	beginLogger   INodeBeginLogger
+	endLogger     INodeEndLogger
+	beginIDLogger INodeBeginIDLogger
+	endIDLogger   INodeEndIDLogger
+	logger        FlowLogger
+	nodeSeq       int
+	tracer        ITracer
+	metrics       FlowMetrics
+	deferred      []deferredCall
+	maxJumps      int
+	jumps         int
+	jumpTo        int
+	anchors       map[string]*anchorPoint
+	position      int
+	restored      bool
+	buildErrors   []error
+	strict        bool
+	maxNodes      int
+	deterministic bool
+	runOnly       map[string]bool
+
+	deadline    time.Time
+	flowTimeout time.Duration
+	ctx         context.Context
+
+	dataDiffLogger IDataDiffLogger
+	beforeHook     INodeBeforeHook
+
+	failurePredicate IFailurePredicate
+	startResult      *Result
+	returned         bool
+	finished         bool
+	resultMerger     IResultMergeFunc
+
+	resultSink     IResultSinkFunc
+	sinkBufferSize int
+	sinkPolicy     SinkPolicy
+	sinkRun        *sinkRun
+
+	callbackTimeout time.Duration
+	onPanicFunc     IOnPanicFunc
+	dataMerger      IDataMergeFunc
+	dataCloner      IDataCloneFunc
+	cloneMode       CloneMode
+
+	spec              *FlowSpec
+	dataMarshaler     IDataMarshalFunc
+	checkpointHandler ICheckpointFunc
+}
+
+func NewFlowEngine() *FlowEngine {
+	res := &FlowEngine{
+		nodes:    make([]IBasicFlowNode, 0, 10),
+		maxJumps: DefaultMaxJumps,
+		logger:   NopFlowLogger{},
+	}
+	res.data = new(DataSet)
+
+	tempResult := new(Result)
+	res.result, res.startResult = &tempResult, tempResult
+	return res
+}
+
+// appendNode leaves the node out once the flow has run, the nodes would meet the result of the last run, or once the
+// flow has as many nodes as SetMaxNodes allows, and the problem is reported by Validate. Reset allows adding nodes again
+// after a run.
+func (f *FlowEngine) appendNode(node IBasicFlowNode) {
+	if f.finished {
+		f.addBuildError(fmt.Errorf("%s added after Wait is left out", node.GetNodeType()))
+		return
+	}
+	if f.maxNodes > 0 && len(f.nodes) >= f.maxNodes {
+		f.addBuildError(fmt.Errorf("%s is left out, the flow can't have more than %d nodes", node.GetNodeType(), f.maxNodes))
+		return
+	}
+	if len(f.nodes) != 0 {
+		f.nodes[len(f.nodes)-1].SetNext(node)
+	}
+	node.attach(f, len(f.nodes))
+	f.nodes = append(f.nodes, node)
+	if f.strict {
+		f.checkStrict(len(f.nodes) - 1)
+	}
+}
+
+// Prepare runs the functions with the input when the flow gets to it, like any other node, so it can be anywhere in the
+// flow and the nodes after it see what it has set in the data.
+func (f *FlowEngine) Prepare(input InputParam, prepareFunc ...IPrepareFunc) *FlowEngine {
+	node := NewPrepareNode(f.data, f.result, input, prepareFunc...)
+	f.appendNode(node)
+	return f
+}
+
+func (f *FlowEngine) Do(functors ...ICallable) *FlowEngine {
+	node := NewNormalNode(f.data, f.result, functors...)
+	f.appendNode(node)
+	return f
+}
+
+// DoWithPrev is Do for the functors which need the result so far, the one the flow would end with if it stopped here.
+func (f *FlowEngine) DoWithPrev(functors ...IPrevCallable) *FlowEngine {
+	node := NewPrevNode(f.data, f.result, functors...)
+	f.appendNode(node)
+	return f
+}
+
+// Tap runs the functors for their side effects, such as logging, and the result so far is left as it is.
+func (f *FlowEngine) Tap(functors ...ITapFunc) *FlowEngine {
+	node := NewTapNode(f.data, f.result, functors...)
+	f.appendNode(node)
+	return f
+}
+
+// Return is Do, and then the flow ends successfully without running the nodes after it, unless a functor fails.
+func (f *FlowEngine) Return(functors ...ICallable) *FlowEngine {
+	node := NewNormalNode(f.data, f.result, functors...)
+	node.Return = true
+	f.appendNode(node)
+	return f
+}
+
+// DoDynamic runs the functors given by the provider from the data when the node runs, in order until one fails like Do.
+func (f *FlowEngine) DoDynamic(provider IFunctorProvider) *FlowEngine {
+	node := NewNormalNode(f.data, f.result)
+	node.Provider, node.Dynamic = provider, true
+	f.appendNode(node)
+	return f
+}
+
+// DoAll runs all the functors even if some of them fail, and the flow fails with the first failure after that.
+func (f *FlowEngine) DoAll(functors ...ICallable) *FlowEngine {
+	node := NewNormalNode(f.data, f.result, functors...)
+	node.RunAll = true
+	f.appendNode(node)
+	return f
+}
+
+func (f *FlowEngine) For(times int, functors ...ICallable) *FlowEngine {
+	node := NewForNode(times, f.data, f.result, functors...)
+	f.appendNode(node)
+	return f
+}
+
+// ForEach runs the body for each of the items, which are got from the data when the node runs rather than when it's
+// built.
+func (f *FlowEngine) ForEach(items IItemsFunc, body IItemCallable) *FlowEngine {
+	node := NewForEachNode(f.data, f.result, items, body)
+	f.appendNode(node)
+	return f
+}
+
+// ParallelForEach is ForEach with the items run concurrently by at most max goroutines, see ForEachNode.
+func (f *FlowEngine) ParallelForEach(max int, items IItemsFunc, body IItemCallable) *FlowEngine {
+	node := NewForEachNode(f.data, f.result, items, body)
+	node.MaxWorkers = max
+	f.appendNode(node)
+	return f
+}
+
+// Parallel runs the functors concurrently and always waits for all of them, a failed functor never stops the others.
+// The first failure is the result of the node, and the results of every functor are kept in GetResults. So it suits
+// side effects which must all be done, such as notifying every subscriber, at the cost of waiting for the slowest
+// functor even when the node has already failed. Only the cancellation of the flow stops the waiting, and Race is for
+// the functors which should stop each other.
+func (f *FlowEngine) Parallel(functors ...ICallable) *FlowEngine {
+	node := NewParallelNode(f.data, f.result, functors...)
+	f.appendNode(node)
+	return f
+}
+
+// Poll runs the functors every interval until the condition holds after they are done, for at most maxDuration.
+func (f *FlowEngine) Poll(interval, maxDuration time.Duration, until IBoolFunc, functors ...ICallable) *FlowEngine {
+	node := NewPollNode(interval, maxDuration, f.data, f.result, until, functors...)
+	f.appendNode(node)
+	return f
+}
+
+// Retry runs the functors up to attempts times until they all succeed, waiting backoff before the second attempt and
+// twice as long before each one after.
+func (f *FlowEngine) Retry(attempts int, backoff time.Duration, functors ...ICallable) *FlowEngine {
+	node := NewRetryNode(attempts, backoff, f.data, f.result, functors...)
+	f.appendNode(node)
+	return f
+}
+
+// RetryWithRefresh is the same as Retry except that beforeRetry is called between the attempts to refresh the data.
+func (f *FlowEngine) RetryWithRefresh(attempts int, backoff time.Duration, beforeRetry IBeforeRetryFunc, functors ...ICallable) *FlowEngine {
+	node := NewRetryNode(attempts, backoff, f.data, f.result, functors...)
+	node.BeforeRetry = beforeRetry
+	f.appendNode(node)
+	return f
+}
+
+// RetryIf is the same as Retry except that only the failures for which shouldRetry holds are retried, like the
+// transient ones, and the others fail the node at once.
+func (f *FlowEngine) RetryIf(attempts int, backoff time.Duration, shouldRetry IRetryFunc, functors ...ICallable) *FlowEngine {
+	node := NewRetryNode(attempts, backoff, f.data, f.result, functors...)
+	node.ShouldRetry = shouldRetry
+	f.appendNode(node)
+	return f
+}
+
+// ParallelWithLimit is the same as Parallel except that at most maxConcurrency functors run at the same time.
+func (f *FlowEngine) ParallelWithLimit(maxConcurrency int, functors ...ICallable) *FlowEngine {
+	node := NewParallelNode(f.data, f.result, functors...)
+	node.MaxConcurrency = maxConcurrency
+	f.appendNode(node)
+	return f
+}
+
+// ParallelConditional runs the functors of the branches whose condition holds concurrently. All the conditions are
+// checked before any functor starts.
+func (f *FlowEngine) ParallelConditional(branches []ConditionalBranch) *FlowEngine {
+	functors := make([]ICallable, 0, len(branches))
+	guards := make([]IBoolFunc, 0, len(branches))
+	for _, branch := range branches {
+		functors = append(functors, branch.Functor)
+		guards = append(guards, branch.Condition)
+	}
+	node := NewParallelNode(f.data, f.result, functors...)
+	node.Guards = guards
+	f.appendNode(node)
+	return f
+}
+
+// Race runs the functors concurrently and goes on with the first clean result, the Ctx of the data they get is
+// cancelled then to stop the others. The flow fails with the last failure if none of them succeeds.
+func (f *FlowEngine) Race(functors ...ICallable) *FlowEngine {
+	node := NewRaceNode(f.data, f.result, functors...)
+	f.appendNode(node)
+	return f
+}
+
+// ParallelGather runs the functors concurrently like Parallel, for the results to be read by GatheredResults in the
+// order of the functors rather than the order they finished, failures included.
+func (f *FlowEngine) ParallelGather(functors ...ICallable) *FlowEngine {
+	node := NewParallelNode(f.data, f.result, functors...)
+	node.Gather = true
+	f.appendNode(node)
+	return f
+}
+
+// ParallelReduce runs the functors concurrently like Parallel, and the result is made by reduce from the result so far
+// and the results of the functors, in the order they finish, rather than being the first failure.
+func (f *FlowEngine) ParallelReduce(reduce IResultReduceFunc, functors ...ICallable) *FlowEngine {
+	node := NewParallelNode(f.data, f.result, functors...)
+	node.Reducer = reduce
+	f.appendNode(node)
+	return f
+}
+
+// ParallelIsolated is Parallel with each functor given its own ShallowCloneData copy of the data, which keeps the Ctx,
+// and the copies merged back into the data by merge in the order of the functors once they all finish.
+func (f *FlowEngine) ParallelIsolated(merge IDataMergeFunc, functors ...ICallable) *FlowEngine {
+	node := NewParallelNode(f.data, f.result, functors...)
+	node.SetIsolation(merge, nil)
+	f.appendNode(node)
+	return f
+}
+
+// ParallelIf runs the functors concurrently like Parallel if the condition holds, otherwise the flow goes on without
+// starting any of them. A nil condition fails the flow with ConditionNotFoundError.
+func (f *FlowEngine) ParallelIf(condition IBoolFunc, functors ...ICallable) *FlowEngine {
+	node := NewParallelNode(f.data, f.result, functors...)
+	node.Conditional, node.Condition = true, condition
+	f.appendNode(node)
+	return f
+}
+
+// DoWithVersionCheck runs the functors again, up to DefaultVersionCheckAttempts times, as long as they fail because the
+// version of the data changed underneath them. Use SetConflictPredicate to tell a conflict in another way and
+// SetBeforeRetry to reload the data before the next attempt.
+func (f *FlowEngine) DoWithVersionCheck(version IVersionFunc, functors ...ICallable) *FlowEngine {
+	node := NewRetryNode(DefaultVersionCheckAttempts, 0, f.data, f.result, functors...)
+	node.Version = version
+	f.appendNode(node)
+	return f
+}
+
+// Fallback runs the functors only if the flow has failed, and the flow goes on as if it hadn't if they succeed.
+func (f *FlowEngine) Fallback(functors ...ICallable) *FlowEngine {
+	node := NewFallbackNode(f.data, f.result, functors...)
+	f.appendNode(node)
+	return f
+}
+
+// RouteByCode runs the route for the StatusCode left by the previous nodes, or defaultRoute if there is no such route.
+func (f *FlowEngine) RouteByCode(routes map[int64][]ICallable, defaultRoute []ICallable) *FlowEngine {
+	node := NewRouteNode(f.data, f.result, routes, defaultRoute)
+	f.appendNode(node)
+	return f
+}
+
+// Split runs one of the branches chosen at random by weight, as for an experiment. Give rng a fixed seed for a test.
+func (f *FlowEngine) Split(rng *rand.Rand, branches []WeightedBranch) *FlowEngine {
+	node := NewSplitNode(f.data, f.result, rng, branches)
+	f.appendNode(node)
+	return f
+}
+
+// Breaker runs the functors through the circuit breaker with the name, which is shared by every flow, so that a flaky
+// downstream isn't called again and again while it's failing. See CircuitBreaker. The config is that of the first node
+// made with the name, another config is reported by Validate, and the node runs with the breaker as it is.
+// ResetBreaker lets the name be made again with another config.
+func (f *FlowEngine) Breaker(name string, config BreakerConfig, functors ...ICallable) *FlowEngine {
+	node := NewBreakerNode(f.data, f.result, name, config, functors...)
+	if err := node.Breaker.conflict(name, config); err != nil {
+		f.addBuildError(err)
+	}
+	f.appendNode(node)
+	return f
+}
+
+// RateLimited runs the functors once the limiter allows, a limiter shared by flows caps how often they all run them.
+func (f *FlowEngine) RateLimited(limiter ILimiter, functors ...ICallable) *FlowEngine {
+	node := NewRateLimitedNode(f.data, f.result, limiter, functors...)
+	f.appendNode(node)
+	return f
+}
+
+// Assert fails the flow with AssertionFailedError with the name if check doesn't hold, the nodes after it don't run.
+func (f *FlowEngine) Assert(name string, check IAssertFunc) *FlowEngine {
+	node := NewAssertNode(f.data, f.result, name, check)
+	f.appendNode(node)
+	return f
+}
+
+// DoWithCompensation runs action, and if it succeeds but a later node fails, compensate is run during Wait to undo it.
+// The compensations run in the reverse order of the actions.
+func (f *FlowEngine) DoWithCompensation(action ICallable, compensate ICallable) *FlowEngine {
+	node := NewCompensableNode(f.data, f.result, action, compensate)
+	f.appendNode(node)
+	return f
+}
+
+// Combine merges the results of the earlier nodes with the notes. The flow fails if any of them hasn't run.
+func (f *FlowEngine) Combine(notes []string, merge ICombineFunc) *FlowEngine {
+	node := NewCombineNode(f.data, f.result, notes, merge)
+	f.appendNode(node)
+	return f
+}
+
+// DoWithFallback runs primary, and fallback instead if primary fails or takes longer than timeout. The result of the
+// one which is used is kept, even if it succeeds. Primary runs on a copy of the data, see TimeoutFallbackNode.
+func (f *FlowEngine) DoWithFallback(timeout time.Duration, primary ICallable, fallback ICallable) *FlowEngine {
+	node := NewTimeoutFallbackNode(f.data, f.result, timeout, primary, fallback)
+	f.appendNode(node)
+	return f
+}
+
+// If runs the functors if the condition holds, otherwise the ElseIf or Else which follows. A nil condition fails the flow
+// with ConditionNotFoundError, which stops the nodes after it and calls OnFail like any other failure.
+func (f *FlowEngine) If(condition IBoolFunc, functors ...ICallable) *ElseFlowEngine {
+	node := NewIfNode(f.data, f.result, condition, functors...)
+	f.appendNode(node)
+	return NewElseFlowEngine(&f.data, f, f.result, &f.nodes)
+}
+
+// IfStatus is an If whose condition is that the status code of the result so far is code, it runs even after a failure
+// so that it can handle the status, which is cleared once the functors succeed. The ElseIf and Else after it run as
+// usual, which is only when the flow hasn't failed.
+func (f *FlowEngine) IfStatus(code int64, functors ...ICallable) *ElseFlowEngine {
+	node := NewIfNode(f.data, f.result, nil, functors...)
+	node.ByStatus, node.StatusCode = true, code
+	node.RunMode = RunAlways
+	f.appendNode(node)
+	return NewElseFlowEngine(&f.data, f, f.result, &f.nodes)
+}
+
+// Reset makes the flow ready to run again from the first node: the result is a fresh one, no node is skipped, a Restore
+// is forgotten and nodes can be added again. The data is not reset, it's for the caller or a Prepare to refill.
+func (f *FlowEngine) Reset() *FlowEngine {
+	f.startResult = new(Result)
+	*f.result = f.startResult
+	for _, node := range f.nodes {
+		node.SetShouldSkip(false)
+	}
+	f.position, f.restored, f.finished = 0, false, false
+	return f
+}
+
+// WaitContext runs the flow like Wait, and it's cancelled once ctx is done, just as if it were the Ctx of the data: the
+// nodes left fail with CancelledError, Parallel, Race and Retry stop waiting, and Parallel starts none of the functors
+// left. The ctx isn't put in the data, so a functor already running only stops if it watches the Ctx of the data.
+func (f *FlowEngine) WaitContext(ctx context.Context) *Result {
+	f.ctx = ctx
+	defer func() {
+		f.ctx = nil
+	}()
+	return f.Wait()
+}
+
+// RunOnly runs the flow like Wait, but only the nodes with the notes, the others are skipped as if ShouldSkip were set,
+// including the ones without a note. It's for finding which node makes a flow fail, the nodes usually depend on the ones
+// before them.
+func (f *FlowEngine) RunOnly(notes ...string) *Result {
+	f.runOnly = noteSet(notes)
+	defer func() {
+		f.runOnly = nil
+	}()
+	return f.Wait()
+}
+
+func noteSet(notes []string) map[string]bool {
+	set := make(map[string]bool, len(notes))
+	for _, note := range notes {
+		if note != "" {
+			set[note] = true
+		}
+	}
+	return set
+}
+
+// IfErr is an If whose condition can fail the flow, as when it has to look something up.
+func (f *FlowEngine) IfErr(condition ICheckedBoolFunc, functors ...ICallable) *ElseFlowEngine {
+	node := NewIfNode(f.data, f.result, nil, functors...)
+	node.CheckedCondition = condition
+	f.appendNode(node)
+	return NewElseFlowEngine(&f.data, f, f.result, &f.nodes)
+}
+
+func (f *FlowEngine) Wait() *Result {
+	result, _ := f.WaitWithTrace()
+	return result
+}
+
+// WaitWithTrace runs the flow like Wait, and also returns what each node left behind in the order they ran, including
+// the ones skipped.
+func (f *FlowEngine) WaitWithTrace() (*Result, []NodeTrace) {
+	result := f.wait(f.onSuccessFunc, f.onFailFunc, f.alwaysFunc)
+	return result, append([]NodeTrace(nil), f.traces...)
+}
+
+// Run runs the flow like Wait, and returns the error of the result if it's a failure, or a StatusError if it only has a
+// status code.
+func (f *FlowEngine) Run() error {
+	return f.resultError(f.Wait())
+}
+
+func (f *FlowEngine) resultError(result *Result) error {
+	if !f.isFailure(result) {
+		return nil
+	}
+	if result.Err != nil {
+		return result.Err
+	}
+	return NewStatusError(result.StatusCode, result.StatusMsg)
+}
+
+// DefaultFailure is how a result fails the flow unless SetFailurePredicate says otherwise, which is having an error or
+// a non-zero status code.
+func DefaultFailure(_result *Result) bool {
+	return _result != nil && (_result.Err != nil || _result.StatusCode != 0)
+}
+
+// isFailure never takes the empty result the flow starts with for a failure, whatever the predicate, as no node has
+// produced a result yet.
+func (f *FlowEngine) isFailure(result *Result) bool {
+	if result == nil || result == f.startResult {
+		return false
+	}
+	if f.failurePredicate != nil {
+		return f.failurePredicate(result)
+	}
+	return DefaultFailure(result)
+}
+
+func (f *FlowEngine) wait(onSuccessFunc IOnSuccessFunc, onFailFunc IOnFailFunc, alwaysFunc IAlwaysFunc) *Result {
+	start := 0
+	if f.restored {
+		start, f.restored = f.position, false
+	} else {
+		f.executionID = NewExecutionID()
+		f.traces = make([]NodeTrace, 0, len(f.nodes))
+		f.jumps = 0
+	}
+	f.startTime = Clock.Now()
+	f.compensations = nil
+	f.jumpTo = -1
+	f.returned = false
+	f.sinkRun = nil
+	if f.resultSink != nil {
+		f.sinkRun = newSinkRun(f.name, f.resultSink, f.sinkBufferSize, f.sinkPolicy)
+	}
+	deadline := f.runDeadline()
+	releaseDeadline := f.withDeadline(deadline)
+	for i := start; i < len(f.nodes); i++ {
+		if f.deadlinePassed(deadline, f.nodes[i].GetNote()) {
+			break
+		}
+		f.position = i
+		f.nodes[i].Run()
+		if f.returned {
+			break
+		}
+		if f.jumpTo >= 0 {
+			i, f.jumpTo = f.jumpTo-1, -1
+		}
+		f.checkpoint(i + 1)
+	}
+	releaseDeadline()
+	f.position = len(f.nodes)
+	if f.sinkRun != nil {
+		close(f.sinkRun.buffer)
+	}
+	if f.isFailure(*f.result) {
+		f.compensate()
+	}
+	for i := len(f.deferred) - 1; i >= 0; i-- {
+		f.runDeferred(f.deferred[i])
+	}
+	f.duration = Clock.Now().Sub(f.startTime)
+	f.finished = true
+	if alwaysFunc != nil {
+		defer f.runCallback("Always", func() { alwaysFunc(f.data, *f.result) })
+	}
+	if onSuccessFunc != nil {
+		if !f.isFailure(*f.result) {
+			f.runCallback("OnSuccess", func() { onSuccessFunc(f.data, *f.result) })
+		}
+	}
+	if onFailFunc != nil {
+		if f.isFailure(*f.result) {
+			f.runCallback("OnFail", func() { onFailFunc(f.data, *f.result) })
+		}
+	}
+	return *f.result
+}
+
+// runDeadline is the earlier of the deadline and the flow timeout from now, zero if there's neither.
+func (f *FlowEngine) runDeadline() time.Time {
+	deadline := f.deadline
+	if f.flowTimeout > 0 {
+		byTimeout := f.startTime.Add(f.flowTimeout)
+		if deadline.IsZero() || byTimeout.Before(deadline) {
+			deadline = byTimeout
+		}
+	}
+	return deadline
+}
+
+// deadlinePassed fails the flow with FlowDeadlineError once the deadline has passed, unless it has failed already.
+func (f *FlowEngine) deadlinePassed(deadline time.Time, note string) bool {
+	if deadline.IsZero() || Clock.Now().Before(deadline) {
+		return false
+	}
+	if !f.isFailure(*f.result) || errors.Is((*f.result).Err, context.DeadlineExceeded) {
+		*f.result = &Result{
+			Err:        NewFlowDeadlineError(note, deadline),
+			StatusCode: 0,
+			StatusMsg:  "",
+		}
+	}
+	return true
+}
+
+// withDeadline makes the ctx of the engine end by the deadline, the one given to WaitContext if there's one, so that
+// the nodes stop waiting in time. The Ctx of the data is left as it is, since the functors given up on may still read
+// it. The function returned puts the ctx back, and turns a cancellation by the deadline into FlowDeadlineError.
+func (f *FlowEngine) withDeadline(deadline time.Time) func() {
+	if deadline.IsZero() {
+		return func() {}
+	}
+	outer := f.ctx
+	parent := outer
+	if parent == nil {
+		parent = context.Background()
+	}
+	ctx, cancel := context.WithDeadline(parent, deadline)
+	f.ctx = ctx
+	return func() {
+		if (*f.result).Err != nil && ctx.Err() == context.DeadlineExceeded {
+			f.deadlinePassed(deadline, "")
+		}
+		cancel()
+		f.ctx = outer
+	}
+}
+
+// runCallback stops waiting for the callback once it takes longer than the callback timeout, and tells whether it's
+// done. The callback is left running in the background, so it must not expect the data to stay untouched after Wait
+// returns. A panic in the callback is logged, with or without the timeout, so that the callbacks after it still run.
+func (f *FlowEngine) runCallback(name string, callback func()) bool {
+	if f.callbackTimeout <= 0 {
+		func() {
+			defer f.logCallbackPanic(name)
+			callback()
+		}()
+		return true
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		defer f.logCallbackPanic(name)
+		callback()
+	}()
+	select {
+	case <-done:
+		return true
+	case <-Clock.After(f.callbackTimeout):
+		log.Printf("[WARNING] goflow: %s of flow %q is still running after %v, stop waiting for it", name, f.name, f.callbackTimeout)
+		return false
+	}
+}
+
+func (f *FlowEngine) logCallbackPanic(name string) {
+	if recovered := recover(); recovered != nil {
+		log.Printf("[WARNING] goflow: %s of flow %q panicked: %v\n%s", name, f.name, recovered, debug.Stack())
+	}
+}
+
+// OnPanic sets the handler of the panics in the functors. The flow fails with PanicHappened after the handler returns.
+// The functors of Parallel may panic at the same time, so the handler must be safe to be called concurrently.
+func (f *FlowEngine) OnPanic(functor IOnPanicFunc) *FlowEngine {
+	f.onPanicFunc = functor
+	return f
+}
+
+// SetDataIsolation isolates all the Parallel nodes of the flow which are not isolated by SetIsolation.
+func (f *FlowEngine) SetDataIsolation(merger IDataMergeFunc, cloner IDataCloneFunc) *FlowEngine {
+	f.dataMerger = merger
+	f.dataCloner = cloner
+	return f
+}
+
+// SetCloneMode overrides when the functors of the Parallel nodes get their own copies of the data.
+func (f *FlowEngine) SetCloneMode(mode CloneMode) *FlowEngine {
+	f.cloneMode = mode
+	return f
+}
+
+// SetCallbackTimeout limits how long Wait waits for each compensation, each deferred function, OnSuccess, OnFail and
+// Always.
+func (f *FlowEngine) SetCallbackTimeout(timeout time.Duration) *FlowEngine {
+	f.callbackTimeout = timeout
+	return f
+}
+
+// ParallelResults returns the results of all the functors of the first Parallel node with the note in the last run.
+func (f *FlowEngine) ParallelResults(note string) []*Result {
+	for _, node := range f.nodes {
+		if parallel, ok := node.(*ParallelNode); ok && parallel.GetNote() == note {
+			return parallel.GetResults()
+		}
+	}
+	return nil
+}
+
+// GatheredResults returns the results of the ParallelGather node with the note in the order of its functors, nil for
+// the other Parallel nodes.
+func (f *FlowEngine) GatheredResults(note string) []*Result {
+	for _, node := range f.nodes {
+		if parallel, ok := node.(*ParallelNode); ok && parallel.GetNote() == note {
+			return parallel.GetGathered()
+		}
+	}
+	return nil
+}
+
+// IterationResults returns the result of each iteration of the For node with the note in the last run.
+func (f *FlowEngine) IterationResults(note string) []*Result {
+	for _, node := range f.nodes {
+		if loop, ok := node.(*ForNode); ok && loop.GetNote() == note {
+			return loop.IterationResults()
+		}
+	}
+	return nil
+}
+
+// ParallelErrors returns the errors of the functors of the Parallel node with the note by their index, a functor which
+// has panicked is there with the error the panic has been turned into.
+func (f *FlowEngine) ParallelErrors(note string) map[int]error {
+	for _, node := range f.nodes {
+		if parallel, ok := node.(*ParallelNode); ok && parallel.GetNote() == note {
+			return parallel.GetErrors()
+		}
+	}
+	return nil
+}
+
+// compensate undoes the nodes added by DoWithCompensation which have succeeded, the last one first. The results of the
+// compensations are ignored, the flow is failed anyway.
+func (f *FlowEngine) compensate() {
+	for i := len(f.compensations) - 1; i >= 0; i-- {
+		compensation := f.compensations[i]
+		f.runCallback("Compensation", func() { compensation(f.data) })
+	}
+	f.compensations = nil
+}
+
+// Nodes returns the nodes in order, the slice is a copy but the nodes are the ones of the flow.
+func (f *FlowEngine) Nodes() []IBasicFlowNode {
+	return append([]IBasicFlowNode(nil), f.nodes...)
+}
+
+// CountByType tells how many nodes of the type the flow has.
+func (f *FlowEngine) CountByType(nodeType NodeType) int {
+	count := 0
+	for _, node := range f.nodes {
+		if node.GetNodeType() == nodeType {
+			count++
+		}
+	}
+	return count
+}
+
+// Walk visits the nodes in order without running them, until the visitor returns false.
+func (f *FlowEngine) Walk(visitor func(index int, node IBasicFlowNode) bool) {
+	for i, node := range f.nodes {
+		if !visitor(i, node) {
+			return
+		}
+	}
+}
+
+// SetName names the flow in the ExecutionReport.
+func (f *FlowEngine) SetName(name string) *FlowEngine {
+	f.name = name
+	return f
+}
+
+func (f *FlowEngine) SetNote(note string) *FlowEngine {
+	if len(f.nodes) != 0 {
+		f.nodes[len(f.nodes)-1].SetNote(note)
+	}
+	return f
+}
+
+func (f *FlowEngine) SetBeginLogger(logger INodeBeginLogger) *FlowEngine {
+	if len(f.nodes) != 0 {
+		f.nodes[len(f.nodes)-1].SetBeginLogger(logger)
+	}
+	return f
+}
+
+func (f *FlowEngine) SetEndLogger(logger INodeEndLogger) *FlowEngine {
+	if len(f.nodes) != 0 {
+		f.nodes[len(f.nodes)-1].SetEndLogger(logger)
+	}
+	return f
+}
+
+// SetTimeout limits how long the most recently added node can run. For Parallel, it's the time of all the functors.
+// The node runs on copies of itself, the data and the result, so whatever it does once it's timed out is dropped.
+func (f *FlowEngine) SetTimeout(timeout time.Duration) *FlowEngine {
+	if len(f.nodes) != 0 {
+		f.nodes[len(f.nodes)-1].SetTimeout(timeout)
+	}
+	return f
+}
+
+// SetPanicMapper sets how a panic in the most recently added node turns into its result. A nil result from the mapper
+// means the default, which is a PanicHappened.
+func (f *FlowEngine) SetPanicMapper(mapper IPanicMapFunc) *FlowEngine {
+	if len(f.nodes) != 0 {
+		f.nodes[len(f.nodes)-1].SetPanicMapper(mapper)
+	}
+	return f
+}
+
+// SkipIf skips the most recently added node whenever the predicate holds for the result so far when the flow gets to
+// it. It's checked after the failure short-circuit, along with the skip of the node, and before the before hook.
+func (f *FlowEngine) SkipIf(predicate ISkipFunc) *FlowEngine {
+	if len(f.nodes) != 0 {
+		f.nodes[len(f.nodes)-1].SetSkipIf(predicate)
+	}
+	return f
+}
+
+// WithMeta sets the metadata of the most recently added node, see SetMeta.
+func (f *FlowEngine) WithMeta(meta map[string]string) *FlowEngine {
+	if len(f.nodes) != 0 {
+		for key, value := range meta {
+			f.nodes[len(f.nodes)-1].SetMeta(key, value)
+		}
+	}
+	return f
+}
+
+// SetBeforeRetry sets the function called between the attempts of the most recently added retrying node.
+func (f *FlowEngine) SetBeforeRetry(beforeRetry IBeforeRetryFunc) *FlowEngine {
+	if len(f.nodes) != 0 {
+		if node, ok := f.nodes[len(f.nodes)-1].(*RetryNode); ok {
+			node.BeforeRetry = beforeRetry
+		}
+	}
+	return f
+}
+
+// SetConflictPredicate sets how the most recently added DoWithVersionCheck node tells a conflict.
+func (f *FlowEngine) SetConflictPredicate(conflict IConflictFunc) *FlowEngine {
+	if len(f.nodes) != 0 {
+		if node, ok := f.nodes[len(f.nodes)-1].(*RetryNode); ok {
+			node.Conflict = conflict
+		}
+	}
+	return f
+}
+
+// SetIsolation makes the most recently added Parallel node give each functor its own copy of Data and merge all the
+// copies back with merger when they are done. A nil cloner means ShallowCloneData.
+func (f *FlowEngine) SetIsolation(merger IDataMergeFunc, cloner IDataCloneFunc) *FlowEngine {
+	if len(f.nodes) != 0 {
+		if node, ok := f.nodes[len(f.nodes)-1].(*ParallelNode); ok {
+			node.SetIsolation(merger, cloner)
+		}
+	}
+	return f
+}
+
+// SetGlobalBeginLogger sets the logger for all the nodes without their own, including the ones added later.
+func (f *FlowEngine) SetGlobalBeginLogger(logger INodeBeginLogger) *FlowEngine {
+	f.beginLogger = logger
+	return f
+}
+
+// SetGlobalEndLogger sets the logger for all the nodes without their own, including the ones added later.
+func (f *FlowEngine) SetGlobalEndLogger(logger INodeEndLogger) *FlowEngine {
+	f.endLogger = logger
+	return f
+}
+
+// SetGlobalBeginIDLogger sets the logger called with the ID of each node when it starts, after the begin logger.
+func (f *FlowEngine) SetGlobalBeginIDLogger(logger INodeBeginIDLogger) *FlowEngine {
+	f.beginIDLogger = logger
+	return f
+}
+
+// SetGlobalEndIDLogger sets the logger called with the ID of each node when it ends, after the end logger.
+func (f *FlowEngine) SetGlobalEndIDLogger(logger INodeEndIDLogger) *FlowEngine {
+	f.endIDLogger = logger
+	return f
+}
+
+// SetMaxNodes limits the number of nodes of the flow, the nodes beyond it are left out and reported by Validate, or
+// panic in strict mode. There's no limit if n isn't positive, which is the default.
+func (f *FlowEngine) SetMaxNodes(n int) *FlowEngine {
+	f.maxNodes = n
+	return f
+}
+
+// SetDeterministic makes the Parallel and ParallelForEach nodes run one functor or item at a time in their order, so that
+// a test sees the same order every time, the results are put together the same way. It's for tests only.
+func (f *FlowEngine) SetDeterministic(deterministic bool) *FlowEngine {
+	f.deterministic = deterministic
+	return f
+}
+
+// SetLogger sets the logger told about all the nodes, including the ones added later. A nil logger means NopFlowLogger.
+func (f *FlowEngine) SetLogger(logger FlowLogger) *FlowEngine {
+	if logger == nil {
+		logger = NopFlowLogger{}
+	}
+	f.logger = logger
+	return f
+}
+
+// SetTracer sets the tracer called for each node which runs.
+func (f *FlowEngine) SetTracer(tracer ITracer) *FlowEngine {
+	f.tracer = tracer
+	return f
+}
+
+// SetDeadline stops the flow once the time has passed: the nodes left don't run, Parallel, Race and Retry stop waiting,
+// and the flow fails with FlowDeadlineError. It's kept by the flow like the ctx of WaitContext, and the Ctx of the data
+// is left as it is, so a functor which has to give up by the deadline has to be given it in the Ctx by the caller.
+func (f *FlowEngine) SetDeadline(deadline time.Time) *FlowEngine {
+	f.deadline = deadline
+	return f
+}
+
+// SetFlowTimeout is SetDeadline from the start of each Wait. The earlier one is used if both are set.
+func (f *FlowEngine) SetFlowTimeout(timeout time.Duration) *FlowEngine {
+	f.flowTimeout = timeout
+	return f
+}
+
+// Goto jumps back or forth to the first node with the note if the condition holds. It runs even if the flow has failed,
+// and clears the failure when it jumps, so it can be used to start again from an earlier node.
+func (f *FlowEngine) Goto(note string, condition IBoolFunc) *FlowEngine {
+	node := NewGotoNode(f.data, f.result, note, condition)
+	f.appendNode(node)
+	return f
+}
+
+// SetMaxJumps limits how many times Goto and JumpTo can jump in a run, DefaultMaxJumps by default.
+func (f *FlowEngine) SetMaxJumps(maxJumps int) *FlowEngine {
+	f.maxJumps = maxJumps
+	return f
+}
+
+// jump makes the flow go on from the first node with the note target once the current node is done. It returns the
+// failed result if there's no such node or the flow has jumped too many times, otherwise nil.
+func (f *FlowEngine) jump(note string, target string) *Result {
+	index := f.indexByNote(target)
+	if index < 0 {
+		return &Result{
+			Err:        NewNodeNotFoundError(note, target),
+			StatusCode: 0,
+			StatusMsg:  "",
+		}
+	}
+	if f.jumps >= f.maxJumps {
+		return &Result{
+			Err:        NewTooManyJumpsError(note, f.maxJumps),
+			StatusCode: 0,
+			StatusMsg:  "",
+		}
+	}
+	f.jumps++
+	f.jumpTo = index
+	return nil
+}
+
+func (f *FlowEngine) indexByNote(note string) int {
+	for i, node := range f.nodes {
+		if node.GetNote() == note {
+			return i
+		}
+	}
+	return -1
+}
+
+// DeferWithResult adds a function called with the final result once all the nodes are done, whether the flow succeeds
+// or not. The deferred functions run in the reverse order they are added, after the compensations and before OnSuccess
+// and OnFail.
+func (f *FlowEngine) DeferWithResult(functor IDeferFunc) *FlowEngine {
+	f.deferred = append(f.deferred, deferredCall{withResult: functor})
 	return f
 }
 
-func (f *FlowEngine) Parallel(functors ...ICallable) *FlowEngine {
-	node := NewParallelNode(f.data, f.result, functors...)
-	if len(f.nodes) != 0 {
-		f.nodes[len(f.nodes)-1].SetNext(node)
-	}
-	f.nodes = append(f.nodes, node)
+// Defer adds functors run once all the nodes are done, whether the flow succeeds or not, with the deferred functions of
+// DeferWithResult, in the reverse order they are added. All of them run, and the first failure fails the flow if it has
+// succeeded, but doesn't replace the failure of the flow.
+func (f *FlowEngine) Defer(functors ...ICallable) *FlowEngine {
+	f.deferred = append(f.deferred, deferredCall{functors: functors})
 	return f
 }
 
-func (f *FlowEngine) If(condition IBoolFunc, functors ...ICallable) *ElseFlowEngine {
-	node := NewIfNode(f.data, f.result, condition, functors...)
-	if len(f.nodes) != 0 {
-		f.nodes[len(f.nodes)-1].SetNext(node)
-	}
-	f.nodes = append(f.nodes, node)
-	return NewElseFlowEngine(&f.data, f, f.result, &f.nodes)
+// deferredCall is added by DeferWithResult with withResult, or by Defer with functors.
+type deferredCall struct {
+	withResult IDeferFunc
+	functors   []ICallable
 }
 
-func (f *FlowEngine) Wait() *Result {
-	for _, node := range f.nodes {
-		node.Run()
-	}
-	if f.onSuccessFunc != nil {
-		if (*f.result).Err == nil && (*f.result).StatusCode == 0 {
-			f.onSuccessFunc(f.data, *f.result)
-		}
+// runDeferred runs the deferred call like a callback, so the failure of a Defer given up on by the callback timeout is
+// not taken.
+func (f *FlowEngine) runDeferred(call deferredCall) {
+	if call.withResult != nil {
+		result := *f.result
+		f.runCallback("Defer", func() { call.withResult(f.data, result) })
+		return
 	}
-	if f.onFailFunc != nil {
-		if (*f.result).Err != nil || (*f.result).StatusCode != 0 {
-			f.onFailFunc(f.data, *f.result)
+	var failure *Result
+	done := f.runCallback("Defer", func() {
+		for _, functor := range call.functors {
+			if functor == nil {
+				continue
+			}
+			if result := functor(f.data); failure == nil && f.isFailure(result) {
+				failure = result
+			}
 		}
+	})
+	if done && failure != nil && !f.isFailure(*f.result) {
+		*f.result = failure
 	}
-	return *f.result
 }
 
-func (f *FlowEngine) SetNote(note string) *FlowEngine {
-	if len(f.nodes) != 0 {
-		f.nodes[len(f.nodes)-1].SetNote(note)
-	}
+// SetDataDiffLogger logs the fields of the data changed by each node, with the old and the new values. The node
+// which changes nothing isn't logged. The data is copied before each node runs, so it's only for debugging.
+func (f *FlowEngine) SetDataDiffLogger(logger IDataDiffLogger) *FlowEngine {
+	f.dataDiffLogger = logger
 	return f
 }
 
-func (f *FlowEngine) SetBeginLogger(logger INodeBeginLogger) *FlowEngine {
-	if len(f.nodes) != 0 {
-		f.nodes[len(f.nodes)-1].SetBeginLogger(logger)
-	}
+// SetFailurePredicate changes what a failure is, for the services whose successful status code isn't 0. It's used by
+// the nodes to tell whether to stop, and by the flow to choose between OnSuccess and OnFail. The empty result the flow starts with, and goes back to once a
+// Fallback, Route or Goto clears a failure, is never given to the predicate, so that it can fail a zero status code. A
+// nil predicate restores DefaultFailure.
+func (f *FlowEngine) SetFailurePredicate(predicate IFailurePredicate) *FlowEngine {
+	f.failurePredicate = predicate
 	return f
 }
 
-func (f *FlowEngine) SetEndLogger(logger INodeEndLogger) *FlowEngine {
-	if len(f.nodes) != 0 {
-		f.nodes[len(f.nodes)-1].SetEndLogger(logger)
-	}
+// SetResultMerger makes each node fold its result into the result so far instead of replacing it, such as to keep the
+// highest status code or to join the messages. It's only called when the node returns a result other than the one so
+// far, which is when a functor has failed for most of the nodes, and a nil from the merger means the result of the node.
+func (f *FlowEngine) SetResultMerger(merger IResultMergeFunc) *FlowEngine {
+	f.resultMerger = merger
 	return f
 }
 
-func (f *FlowEngine) SetGlobalBeginLogger(logger INodeBeginLogger) *FlowEngine {
-	for _, note := range f.nodes {
-		if note.GetBeginLogger() == nil {
-			note.SetBeginLogger(logger)
-		}
-	}
+// SetBeforeHook sets the hook called before each node which is going to run, once the failure short-circuit, the skip
+// and SkipIf have let it, so the hook isn't called for the nodes skipped. The skip set by the hook stays until Reset
+// clears it, so the node is skipped by the later runs as well.
+func (f *FlowEngine) SetBeforeHook(hook INodeBeforeHook) *FlowEngine {
+	f.beforeHook = hook
 	return f
 }
 
-func (f *FlowEngine) SetGlobalEndLogger(logger INodeEndLogger) *FlowEngine {
-	for _, note := range f.nodes {
-		if note.GetEndLogger() == nil {
-			note.SetEndLogger(logger)
-		}
-	}
+// WithMetrics sets the collector told about each node, whether it runs or is skipped.
+func (f *FlowEngine) WithMetrics(metrics FlowMetrics) *FlowEngine {
+	f.metrics = metrics
 	return f
 }
 
@@ -671,11 +3989,18 @@ func (f *FlowEngine) OnFail(functor IOnFailFunc) *FlowEngine {
 	return f
 }
 
-func (f *FlowEngine) OnSuccess(functor IOnFailFunc) *FlowEngine {
+func (f *FlowEngine) OnSuccess(functor IOnSuccessFunc) *FlowEngine {
 	f.onSuccessFunc = functor
 	return f
 }
 
+// Always sets the function called at the end of each Wait whether the flow has succeeded or not, after OnSuccess or
+// OnFail, even if it panics, since the panic is logged rather than let through.
+func (f *FlowEngine) Always(functor IAlwaysFunc) *FlowEngine {
+	f.alwaysFunc = functor
+	return f
+}
+
 //END FlowEngine
 
 //ElseFlowEngine implementation
@@ -687,6 +4012,7 @@ type ElseFlowEngine struct {
 	invoker       *FlowEngine
 	onFailFunc    IOnFailFunc
 	onSuccessFunc IOnSuccessFunc
+	alwaysFunc    IAlwaysFunc
 }
 
 func NewElseFlowEngine(data **DataSet, invoker *FlowEngine, result **Result, nodes *[]IBasicFlowNode) *ElseFlowEngine {
@@ -699,80 +4025,302 @@ func NewElseFlowEngine(data **DataSet, invoker *FlowEngine, result **Result, nod
 	return res
 }
 
-func (e *ElseFlowEngine) Prepare(input InputParam, prepareFunc ...IPrepareFunc) *FlowEngine {
+// Prepare keeps the If open, so that ElseIf or Else can follow, and then the node only runs if no condition before it
+// has held.
+func (e *ElseFlowEngine) Prepare(input InputParam, prepareFunc ...IPrepareFunc) *ElseFlowEngine {
 	node := NewPrepareNode(*e.data, e.result, input, prepareFunc...)
-	if len(*e.nodes) != 0 {
-		(*e.nodes)[len(*e.nodes)-1].SetNext(node)
-	}
-	*e.nodes = append(*e.nodes, node)
-	return e.invoker
+	e.invoker.appendNode(node)
+	return e
 }
 
 func (e *ElseFlowEngine) Do(functors ...ICallable) *FlowEngine {
 	node := NewNormalNode(*e.data, e.result, functors...)
-	if len(*e.nodes) != 0 {
-		(*e.nodes)[len(*e.nodes)-1].SetNext(node)
-	}
-	*e.nodes = append(*e.nodes, node)
+	e.invoker.appendNode(node)
 	return e.invoker
 }
 
+func (e *ElseFlowEngine) DoAll(functors ...ICallable) *FlowEngine {
+	return e.invoker.DoAll(functors...)
+}
+
+func (e *ElseFlowEngine) DoDynamic(provider IFunctorProvider) *FlowEngine {
+	return e.invoker.DoDynamic(provider)
+}
+
+func (e *ElseFlowEngine) Return(functors ...ICallable) *FlowEngine {
+	return e.invoker.Return(functors...)
+}
+
+func (e *ElseFlowEngine) DoWithPrev(functors ...IPrevCallable) *FlowEngine {
+	return e.invoker.DoWithPrev(functors...)
+}
+
+func (e *ElseFlowEngine) Tap(functors ...ITapFunc) *FlowEngine {
+	return e.invoker.Tap(functors...)
+}
+
+func (e *ElseFlowEngine) Poll(interval, maxDuration time.Duration, until IBoolFunc, functors ...ICallable) *FlowEngine {
+	return e.invoker.Poll(interval, maxDuration, until, functors...)
+}
+
+func (e *ElseFlowEngine) ForEach(items IItemsFunc, body IItemCallable) *FlowEngine {
+	return e.invoker.ForEach(items, body)
+}
+
+func (e *ElseFlowEngine) ParallelForEach(max int, items IItemsFunc, body IItemCallable) *FlowEngine {
+	return e.invoker.ParallelForEach(max, items, body)
+}
+
 func (e *ElseFlowEngine) For(times int, functors ...ICallable) *FlowEngine {
 	node := NewForNode(times, *e.data, e.result, functors...)
-	if len(*e.nodes) != 0 {
-		(*e.nodes)[len(*e.nodes)-1].SetNext(node)
-	}
-	*e.nodes = append(*e.nodes, node)
+	e.invoker.appendNode(node)
 	return e.invoker
 }
 
 func (e *ElseFlowEngine) Parallel(functors ...ICallable) *FlowEngine {
 	node := NewParallelNode(*e.data, e.result, functors...)
-	if len(*e.nodes) != 0 {
-		(*e.nodes)[len(*e.nodes)-1].SetNext(node)
-	}
-	*e.nodes = append(*e.nodes, node)
+	e.invoker.appendNode(node)
 	return e.invoker
 }
 
+func (e *ElseFlowEngine) Retry(attempts int, backoff time.Duration, functors ...ICallable) *FlowEngine {
+	return e.invoker.Retry(attempts, backoff, functors...)
+}
+
+func (e *ElseFlowEngine) RetryWithRefresh(attempts int, backoff time.Duration, beforeRetry IBeforeRetryFunc, functors ...ICallable) *FlowEngine {
+	return e.invoker.RetryWithRefresh(attempts, backoff, beforeRetry, functors...)
+}
+
+func (e *ElseFlowEngine) RetryIf(attempts int, backoff time.Duration, shouldRetry IRetryFunc, functors ...ICallable) *FlowEngine {
+	return e.invoker.RetryIf(attempts, backoff, shouldRetry, functors...)
+}
+
+func (e *ElseFlowEngine) ParallelWithLimit(maxConcurrency int, functors ...ICallable) *FlowEngine {
+	return e.invoker.ParallelWithLimit(maxConcurrency, functors...)
+}
+
+func (e *ElseFlowEngine) ParallelConditional(branches []ConditionalBranch) *FlowEngine {
+	return e.invoker.ParallelConditional(branches)
+}
+
+func (e *ElseFlowEngine) Race(functors ...ICallable) *FlowEngine {
+	return e.invoker.Race(functors...)
+}
+
+func (e *ElseFlowEngine) ParallelGather(functors ...ICallable) *FlowEngine {
+	return e.invoker.ParallelGather(functors...)
+}
+
+func (e *ElseFlowEngine) ParallelIf(condition IBoolFunc, functors ...ICallable) *FlowEngine {
+	return e.invoker.ParallelIf(condition, functors...)
+}
+
+func (e *ElseFlowEngine) ParallelReduce(reduce IResultReduceFunc, functors ...ICallable) *FlowEngine {
+	return e.invoker.ParallelReduce(reduce, functors...)
+}
+
+func (e *ElseFlowEngine) ParallelIsolated(merge IDataMergeFunc, functors ...ICallable) *FlowEngine {
+	return e.invoker.ParallelIsolated(merge, functors...)
+}
+
+func (e *ElseFlowEngine) DoWithVersionCheck(version IVersionFunc, functors ...ICallable) *FlowEngine {
+	return e.invoker.DoWithVersionCheck(version, functors...)
+}
+
+func (e *ElseFlowEngine) Fallback(functors ...ICallable) *FlowEngine {
+	return e.invoker.Fallback(functors...)
+}
+
+func (e *ElseFlowEngine) RouteByCode(routes map[int64][]ICallable, defaultRoute []ICallable) *FlowEngine {
+	return e.invoker.RouteByCode(routes, defaultRoute)
+}
+
+func (e *ElseFlowEngine) Breaker(name string, config BreakerConfig, functors ...ICallable) *FlowEngine {
+	return e.invoker.Breaker(name, config, functors...)
+}
+
+func (e *ElseFlowEngine) RateLimited(limiter ILimiter, functors ...ICallable) *FlowEngine {
+	return e.invoker.RateLimited(limiter, functors...)
+}
+
+func (e *ElseFlowEngine) Assert(name string, check IAssertFunc) *FlowEngine {
+	return e.invoker.Assert(name, check)
+}
+
+func (e *ElseFlowEngine) Split(rng *rand.Rand, branches []WeightedBranch) *FlowEngine {
+	return e.invoker.Split(rng, branches)
+}
+
+func (e *ElseFlowEngine) DoWithCompensation(action ICallable, compensate ICallable) *FlowEngine {
+	return e.invoker.DoWithCompensation(action, compensate)
+}
+
+func (e *ElseFlowEngine) Combine(notes []string, merge ICombineFunc) *FlowEngine {
+	return e.invoker.Combine(notes, merge)
+}
+
+func (e *ElseFlowEngine) DoWithFallback(timeout time.Duration, primary ICallable, fallback ICallable) *FlowEngine {
+	return e.invoker.DoWithFallback(timeout, primary, fallback)
+}
+
 func (e *ElseFlowEngine) If(condition IBoolFunc, functors ...ICallable) *ElseFlowEngine {
 	node := NewIfNode(*e.data, e.result, condition, functors...)
-	if len(*e.nodes) != 0 {
-		(*e.nodes)[len(*e.nodes)-1].SetNext(node)
+	e.invoker.appendNode(node)
+	return e
+}
+
+func (e *ElseFlowEngine) IfStatus(code int64, functors ...ICallable) *ElseFlowEngine {
+	node := NewIfNode(*e.data, e.result, nil, functors...)
+	node.ByStatus, node.StatusCode = true, code
+	node.RunMode = RunAlways
+	e.invoker.appendNode(node)
+	return e
+}
+
+func (e *ElseFlowEngine) IfErr(condition ICheckedBoolFunc, functors ...ICallable) *ElseFlowEngine {
+	node := NewIfNode(*e.data, e.result, nil, functors...)
+	node.CheckedCondition = condition
+	e.invoker.appendNode(node)
+	return e
+}
+
+// ElseIfErr is an ElseIf whose condition can fail the flow, like the one of IfErr.
+func (e *ElseFlowEngine) ElseIfErr(condition ICheckedBoolFunc, functors ...ICallable) *ElseFlowEngine {
+	if e.checkBranch(ElseIfNodeType) {
+		node := NewElseIfNode(*e.data, e.result, nil, functors...)
+		node.CheckedCondition = condition
+		e.invoker.appendNode(node)
 	}
-	*e.nodes = append(*e.nodes, node)
 	return e
 }
 
+// ElseIf fails the flow with ConditionNotFoundError as well if the condition is nil.
 func (e *ElseFlowEngine) ElseIf(condition IBoolFunc, functors ...ICallable) *ElseFlowEngine {
-	node := NewElseIfNode(*e.data, e.result, condition, functors...)
-	(*e.nodes)[len(*e.nodes)-1].SetNext(node)
-	*e.nodes = append(*e.nodes, node)
+	if e.checkBranch(ElseIfNodeType) {
+		node := NewElseIfNode(*e.data, e.result, condition, functors...)
+		e.invoker.appendNode(node)
+	}
 	return e
 }
 
 func (e *ElseFlowEngine) Else(functors ...ICallable) *FlowEngine {
-	node := NewElseNode(*e.data, e.result, functors...)
-	(*e.nodes)[len(*e.nodes)-1].SetNext(node)
-	*e.nodes = append(*e.nodes, node)
+	if e.checkBranch(ElseNodeType) {
+		node := NewElseNode(*e.data, e.result, functors...)
+		e.invoker.appendNode(node)
+	}
 	return e.invoker
 }
 
-func (e *ElseFlowEngine) Wait() *Result {
-	for _, node := range *e.nodes {
-		node.Run()
-	}
-	if e.onSuccessFunc != nil {
-		if (*e.result).Err == nil && (*e.result).StatusCode == 0 {
-			e.onSuccessFunc(*e.data, *e.result)
+// checkBranch tells whether the most recently added node is an If or ElseIf, which a branch must follow, or a Prepare
+// after one, which is then made part of the branches. Otherwise the branch is left out, and the problem is reported by
+// Validate.
+func (e *ElseFlowEngine) checkBranch(nodeType NodeType) bool {
+	nodes := *e.nodes
+	if condition := conditionBefore(nodes, len(nodes)); condition >= 0 {
+		for _, node := range nodes[condition+1:] {
+			node.(*PrepareNode).InBranch = true
 		}
+		return true
 	}
-	if e.onFailFunc != nil {
-		if (*e.result).Err != nil || (*e.result).StatusCode != 0 {
-			e.onFailFunc(*e.data, *e.result)
-		}
+	err := fmt.Errorf("%s at the start of the flow is left out, it must follow If or ElseIf", nodeType)
+	if len(nodes) != 0 {
+		last := len(nodes) - 1
+		err = fmt.Errorf("%s after %s is left out, it must follow If or ElseIf", nodeType, nodeName(last, nodes[last]))
 	}
-	return *e.result
+	e.invoker.addBuildError(err)
+	return false
+}
+
+func (e *ElseFlowEngine) Wait() *Result {
+	result, _ := e.WaitWithTrace()
+	return result
+}
+
+func (e *ElseFlowEngine) WaitWithTrace() (*Result, []NodeTrace) {
+	result := e.invoker.wait(e.onSuccessFunc, e.onFailFunc, e.alwaysFunc)
+	return result, append([]NodeTrace(nil), e.invoker.traces...)
+}
+
+func (e *ElseFlowEngine) Reset() *ElseFlowEngine {
+	e.invoker.Reset()
+	return e
+}
+
+func (e *ElseFlowEngine) WaitContext(ctx context.Context) *Result {
+	e.invoker.ctx = ctx
+	defer func() {
+		e.invoker.ctx = nil
+	}()
+	return e.Wait()
+}
+
+func (e *ElseFlowEngine) RunOnly(notes ...string) *Result {
+	e.invoker.runOnly = noteSet(notes)
+	defer func() {
+		e.invoker.runOnly = nil
+	}()
+	return e.Wait()
+}
+
+func (e *ElseFlowEngine) Run() error {
+	return e.invoker.resultError(e.Wait())
+}
+
+func (e *ElseFlowEngine) SetName(name string) *ElseFlowEngine {
+	e.invoker.SetName(name)
+	return e
+}
+
+func (e *ElseFlowEngine) ParallelResults(note string) []*Result {
+	return e.invoker.ParallelResults(note)
+}
+
+func (e *ElseFlowEngine) GatheredResults(note string) []*Result {
+	return e.invoker.GatheredResults(note)
+}
+
+func (e *ElseFlowEngine) IterationResults(note string) []*Result {
+	return e.invoker.IterationResults(note)
+}
+
+func (e *ElseFlowEngine) ParallelErrors(note string) map[int]error {
+	return e.invoker.ParallelErrors(note)
+}
+
+func (e *ElseFlowEngine) OnPanic(functor IOnPanicFunc) *ElseFlowEngine {
+	e.invoker.OnPanic(functor)
+	return e
+}
+
+func (e *ElseFlowEngine) SetDataIsolation(merger IDataMergeFunc, cloner IDataCloneFunc) *ElseFlowEngine {
+	e.invoker.SetDataIsolation(merger, cloner)
+	return e
+}
+
+func (e *ElseFlowEngine) SetCloneMode(mode CloneMode) *ElseFlowEngine {
+	e.invoker.SetCloneMode(mode)
+	return e
+}
+
+func (e *ElseFlowEngine) SetCallbackTimeout(timeout time.Duration) *ElseFlowEngine {
+	e.invoker.SetCallbackTimeout(timeout)
+	return e
+}
+
+func (e *ElseFlowEngine) Walk(visitor func(index int, node IBasicFlowNode) bool) {
+	e.invoker.Walk(visitor)
+}
+
+func (e *ElseFlowEngine) Nodes() []IBasicFlowNode {
+	return e.invoker.Nodes()
+}
+
+func (e *ElseFlowEngine) CountByType(nodeType NodeType) int {
+	return e.invoker.CountByType(nodeType)
+}
+
+func (e *ElseFlowEngine) Report() ExecutionReport {
+	return e.invoker.Report()
 }
 
 func (e *ElseFlowEngine) SetNote(note string) *ElseFlowEngine {
@@ -796,32 +4344,162 @@ func (e *ElseFlowEngine) SetEndLogger(logger INodeEndLogger) *ElseFlowEngine {
 	return e
 }
 
-func (e *ElseFlowEngine) SetGlobalBeginLogger(logger INodeBeginLogger) *ElseFlowEngine {
-	for _, note := range *e.nodes {
-		if note.GetBeginLogger() == nil {
-			note.SetBeginLogger(logger)
+func (e *ElseFlowEngine) SetTimeout(timeout time.Duration) *ElseFlowEngine {
+	if len(*e.nodes) != 0 {
+		(*e.nodes)[len(*e.nodes)-1].SetTimeout(timeout)
+	}
+	return e
+}
+
+func (e *ElseFlowEngine) SetPanicMapper(mapper IPanicMapFunc) *ElseFlowEngine {
+	if len(*e.nodes) != 0 {
+		(*e.nodes)[len(*e.nodes)-1].SetPanicMapper(mapper)
+	}
+	return e
+}
+
+func (e *ElseFlowEngine) SkipIf(predicate ISkipFunc) *ElseFlowEngine {
+	if len(*e.nodes) != 0 {
+		(*e.nodes)[len(*e.nodes)-1].SetSkipIf(predicate)
+	}
+	return e
+}
+
+func (e *ElseFlowEngine) WithMeta(meta map[string]string) *ElseFlowEngine {
+	if len(*e.nodes) != 0 {
+		for key, value := range meta {
+			(*e.nodes)[len(*e.nodes)-1].SetMeta(key, value)
 		}
 	}
 	return e
 }
 
-func (e *ElseFlowEngine) SetGlobalEndLogger(logger INodeEndLogger) *ElseFlowEngine {
-	for _, note := range *e.nodes {
-		if note.GetEndLogger() == nil {
-			note.SetEndLogger(logger)
+func (e *ElseFlowEngine) SetBeforeRetry(beforeRetry IBeforeRetryFunc) *ElseFlowEngine {
+	e.invoker.SetBeforeRetry(beforeRetry)
+	return e
+}
+
+func (e *ElseFlowEngine) SetConflictPredicate(conflict IConflictFunc) *ElseFlowEngine {
+	e.invoker.SetConflictPredicate(conflict)
+	return e
+}
+
+func (e *ElseFlowEngine) SetIsolation(merger IDataMergeFunc, cloner IDataCloneFunc) *ElseFlowEngine {
+	if len(*e.nodes) != 0 {
+		if node, ok := (*e.nodes)[len(*e.nodes)-1].(*ParallelNode); ok {
+			node.SetIsolation(merger, cloner)
 		}
 	}
 	return e
 }
 
+func (e *ElseFlowEngine) SetGlobalBeginLogger(logger INodeBeginLogger) *ElseFlowEngine {
+	e.invoker.SetGlobalBeginLogger(logger)
+	return e
+}
+
+func (e *ElseFlowEngine) SetGlobalEndLogger(logger INodeEndLogger) *ElseFlowEngine {
+	e.invoker.SetGlobalEndLogger(logger)
+	return e
+}
+
+func (e *ElseFlowEngine) SetMaxNodes(n int) *ElseFlowEngine {
+	e.invoker.SetMaxNodes(n)
+	return e
+}
+
+func (e *ElseFlowEngine) SetDeterministic(deterministic bool) *ElseFlowEngine {
+	e.invoker.SetDeterministic(deterministic)
+	return e
+}
+
+func (e *ElseFlowEngine) SetLogger(logger FlowLogger) *ElseFlowEngine {
+	e.invoker.SetLogger(logger)
+	return e
+}
+
+func (e *ElseFlowEngine) SetGlobalBeginIDLogger(logger INodeBeginIDLogger) *ElseFlowEngine {
+	e.invoker.SetGlobalBeginIDLogger(logger)
+	return e
+}
+
+func (e *ElseFlowEngine) SetGlobalEndIDLogger(logger INodeEndIDLogger) *ElseFlowEngine {
+	e.invoker.SetGlobalEndIDLogger(logger)
+	return e
+}
+
+func (e *ElseFlowEngine) SetTracer(tracer ITracer) *ElseFlowEngine {
+	e.invoker.SetTracer(tracer)
+	return e
+}
+
+func (e *ElseFlowEngine) SetDeadline(deadline time.Time) *ElseFlowEngine {
+	e.invoker.SetDeadline(deadline)
+	return e
+}
+
+func (e *ElseFlowEngine) SetFlowTimeout(timeout time.Duration) *ElseFlowEngine {
+	e.invoker.SetFlowTimeout(timeout)
+	return e
+}
+
+func (e *ElseFlowEngine) Goto(note string, condition IBoolFunc) *FlowEngine {
+	return e.invoker.Goto(note, condition)
+}
+
+func (e *ElseFlowEngine) SetMaxJumps(maxJumps int) *ElseFlowEngine {
+	e.invoker.SetMaxJumps(maxJumps)
+	return e
+}
+
+func (e *ElseFlowEngine) Defer(functors ...ICallable) *ElseFlowEngine {
+	e.invoker.Defer(functors...)
+	return e
+}
+
+func (e *ElseFlowEngine) DeferWithResult(functor IDeferFunc) *ElseFlowEngine {
+	e.invoker.DeferWithResult(functor)
+	return e
+}
+
+func (e *ElseFlowEngine) SetDataDiffLogger(logger IDataDiffLogger) *ElseFlowEngine {
+	e.invoker.SetDataDiffLogger(logger)
+	return e
+}
+
+func (e *ElseFlowEngine) SetFailurePredicate(predicate IFailurePredicate) *ElseFlowEngine {
+	e.invoker.SetFailurePredicate(predicate)
+	return e
+}
+
+func (e *ElseFlowEngine) SetResultMerger(merger IResultMergeFunc) *ElseFlowEngine {
+	e.invoker.SetResultMerger(merger)
+	return e
+}
+
+func (e *ElseFlowEngine) SetBeforeHook(hook INodeBeforeHook) *ElseFlowEngine {
+	e.invoker.SetBeforeHook(hook)
+	return e
+}
+
+func (e *ElseFlowEngine) WithMetrics(metrics FlowMetrics) *ElseFlowEngine {
+	e.invoker.WithMetrics(metrics)
+	return e
+}
+
 func (e *ElseFlowEngine) OnFail(functor IOnFailFunc) *ElseFlowEngine {
 	e.onFailFunc = functor
 	return e
 }
 
-func (e *ElseFlowEngine) OnSuccess(functor IOnFailFunc) *ElseFlowEngine {
+func (e *ElseFlowEngine) OnSuccess(functor IOnSuccessFunc) *ElseFlowEngine {
 	e.onSuccessFunc = functor
 	return e
 }
 
+func (e *ElseFlowEngine) Always(functor IAlwaysFunc) *ElseFlowEngine {
+	e.alwaysFunc = functor
+	return e
+}
+
 //END ElseFlowEngine
@@ -0,0 +1,127 @@
+package goflow
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+type BreakerState int64
+
+const (
+	BreakerClosed BreakerState = iota
+	BreakerOpen
+	BreakerHalfOpen
+)
+
+// BreakerConfig tells a breaker to open after FailureThreshold failures in a row, at least 1, and to let one run through
+// to probe the downstream once Cooldown has passed.
+type BreakerConfig struct {
+	FailureThreshold int
+	Cooldown         time.Duration
+}
+
+func (c BreakerConfig) normalized() BreakerConfig {
+	if c.FailureThreshold < 1 {
+		c.FailureThreshold = 1
+	}
+	return c
+}
+
+// CircuitBreaker is shared by all the Breaker nodes with its name, in every flow. When it's open, the runs are refused
+// until the cooldown has passed, then it's half-open and lets a single run probe: it closes if the probe succeeds and
+// opens again if it fails.
+type CircuitBreaker struct {
+	mutex    sync.Mutex
+	config   BreakerConfig
+	state    BreakerState
+	failures int
+	openedAt time.Time
+	probing  bool
+}
+
+var breakers = struct {
+	sync.Mutex
+	named map[string]*CircuitBreaker
+}{named: make(map[string]*CircuitBreaker)}
+
+// breakerFor returns the breaker with the name, the config is that of the first node made with the name.
+func breakerFor(name string, config BreakerConfig) *CircuitBreaker {
+	breakers.Lock()
+	defer breakers.Unlock()
+	if breaker, ok := breakers.named[name]; ok {
+		return breaker
+	}
+	breaker := &CircuitBreaker{config: config.normalized()}
+	breakers.named[name] = breaker
+	return breaker
+}
+
+// GetBreaker returns the breaker with the name, nil if no Breaker node has been made with it.
+func GetBreaker(name string) *CircuitBreaker {
+	breakers.Lock()
+	defer breakers.Unlock()
+	return breakers.named[name]
+}
+
+// ResetBreaker forgets the breaker with the name, and the next Breaker node with the name makes a new one with its own
+// config. The nodes made before keep the old breaker.
+func ResetBreaker(name string) {
+	breakers.Lock()
+	defer breakers.Unlock()
+	delete(breakers.named, name)
+}
+
+// conflict tells whether the config isn't the one the breaker was made with.
+func (c *CircuitBreaker) conflict(name string, config BreakerConfig) error {
+	if config = config.normalized(); config != c.config {
+		return fmt.Errorf("breaker %q is made with %+v, not %+v", name, c.config, config)
+	}
+	return nil
+}
+
+func (c *CircuitBreaker) State() BreakerState {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.state
+}
+
+// Reset closes the breaker and forgets the failures.
+func (c *CircuitBreaker) Reset() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.state, c.failures, c.probing = BreakerClosed, 0, false
+}
+
+// allow tells whether a run can go through, which makes it the probe if the breaker is half-open.
+func (c *CircuitBreaker) allow() bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.state == BreakerOpen && Clock.Now().Sub(c.openedAt) >= c.config.Cooldown {
+		c.state = BreakerHalfOpen
+	}
+	switch c.state {
+	case BreakerOpen:
+		return false
+	case BreakerHalfOpen:
+		if c.probing {
+			return false
+		}
+		c.probing = true
+	}
+	return true
+}
+
+func (c *CircuitBreaker) record(failed bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.probing = false
+	if !failed {
+		c.state, c.failures = BreakerClosed, 0
+		return
+	}
+	c.failures++
+	if c.state == BreakerHalfOpen || c.failures >= c.config.FailureThreshold {
+		c.state, c.openedAt = BreakerOpen, Clock.Now()
+	}
+}
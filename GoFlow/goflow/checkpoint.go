@@ -0,0 +1,101 @@
+package goflow
+
+import (
+	"encoding/json"
+	"errors"
+)
+
+type IDataMarshalFunc = func(_data *_Data) ([]byte, error)
+
+type IDataUnmarshalFunc = func(bytes []byte, _data *_Data) error
+
+// ICheckpointFunc is called with the checkpoint taken after each node, or the error if it couldn't be taken.
+type ICheckpointFunc = func(state []byte, err error)
+
+// flowCheckpoint is a snapshot with what's needed to build the flow again.
+type flowCheckpoint struct {
+	Spec     FlowSpec
+	Snapshot json.RawMessage
+	Data     []byte `json:",omitempty"`
+}
+
+// Checkpoint saves the flow so that Resume can go on with it after a restart: the spec it was built from, the snapshot
+// and the data marshaled by the marshaler set with SetDataMarshaler, the data is left out if there's none. Only a flow
+// built by BuildFromSpec can be saved, since the functors are found by name again. Taken while a node runs, like in a
+// logger, that node runs again after Resume, use OnCheckpoint to save the flow between the nodes.
+func (f *FlowEngine) Checkpoint() ([]byte, error) {
+	if f.spec == nil {
+		return nil, errors.New("only a flow built by BuildFromSpec can be checkpointed")
+	}
+	snapshot, err := f.Snapshot()
+	if err != nil {
+		return nil, err
+	}
+	checkpoint := flowCheckpoint{Spec: *f.spec, Snapshot: snapshot}
+	if f.dataMarshaler != nil {
+		if checkpoint.Data, err = f.dataMarshaler(f.data); err != nil {
+			return nil, err
+		}
+	}
+	return json.Marshal(checkpoint)
+}
+
+// Resume builds the flow saved by Checkpoint with the functors and the conditions in the registries, and the next Wait
+// goes on from where it was. The data is unmarshaled by unmarshal, it's left empty if unmarshal is nil or the data wasn't
+// saved. The flow is all but the functors, so the loggers, the callbacks and the marshaler have to be set again.
+func Resume(state []byte, registry map[string]ICallable, conds map[string]IBoolFunc, unmarshal IDataUnmarshalFunc) (*FlowEngine, error) {
+	var checkpoint flowCheckpoint
+	if err := json.Unmarshal(state, &checkpoint); err != nil {
+		return nil, err
+	}
+	flow, err := BuildFromSpec(checkpoint.Spec, registry, conds)
+	if err != nil {
+		return nil, err
+	}
+	if err := flow.Restore(checkpoint.Snapshot); err != nil {
+		return nil, err
+	}
+	if unmarshal != nil && checkpoint.Data != nil {
+		if err := unmarshal(checkpoint.Data, flow.data); err != nil {
+			return nil, err
+		}
+	}
+	return flow, nil
+}
+
+// SetDataMarshaler sets how Checkpoint saves the data.
+func (f *FlowEngine) SetDataMarshaler(marshal IDataMarshalFunc) *FlowEngine {
+	f.dataMarshaler = marshal
+	return f
+}
+
+// OnCheckpoint calls the handler with a checkpoint after each node which comes to an end without ending the flow, and
+// Resume from it starts with the node which would have run next. There's none once a node has failed, so the last one
+// is from before the failure, to try the failed node again after Resume.
+func (f *FlowEngine) OnCheckpoint(handler ICheckpointFunc) *FlowEngine {
+	f.checkpointHandler = handler
+	return f
+}
+
+// checkpoint calls the handler with the flow saved at position, the node to run next.
+func (f *FlowEngine) checkpoint(position int) {
+	if f.checkpointHandler == nil || f.isFailure(*f.result) {
+		return
+	}
+	f.position = position
+	f.checkpointHandler(f.Checkpoint())
+}
+
+func (e *ElseFlowEngine) Checkpoint() ([]byte, error) {
+	return e.invoker.Checkpoint()
+}
+
+func (e *ElseFlowEngine) SetDataMarshaler(marshal IDataMarshalFunc) *ElseFlowEngine {
+	e.invoker.SetDataMarshaler(marshal)
+	return e
+}
+
+func (e *ElseFlowEngine) OnCheckpoint(handler ICheckpointFunc) *ElseFlowEngine {
+	e.invoker.OnCheckpoint(handler)
+	return e
+}
@@ -0,0 +1,91 @@
+package goflow
+
+import (
+	"reflect"
+	"time"
+)
+
+// Clone copies the flow with its own data and result, so that it can run at the same time as the original. The
+// handlers, loggers and settings are shared, while what is left of the last run is not. The functors of the nodes are
+// the same functions, so they must not keep state of their own.
+func (f *FlowEngine) Clone() *FlowEngine {
+	clone := *f
+	clone.data = new(_Data)
+	result := new(_Result)
+	clone.result, clone.startResult = &result, result
+	clone.executionID, clone.traces, clone.compensations, clone.sinkRun = "", nil, nil, nil
+	clone.position, clone.restored, clone.finished = 0, false, false
+	clone.ctx = nil
+	clone.deferred = append([]deferredCall(nil), f.deferred...)
+	clone.buildErrors = append([]error(nil), f.buildErrors...)
+
+	clone.nodes = make([]IBasicFlowNode, 0, len(f.nodes))
+	clones := make(map[IBasicFlowNode]IBasicFlowNode, len(f.nodes))
+	for _, node := range f.nodes {
+		copied := cloneNode(node, clone.data, clone.result)
+		clones[node] = copied
+		clone.appendNode(copied)
+	}
+	if f.anchors != nil {
+		clone.anchors = make(map[string]*anchorPoint, len(f.anchors))
+		for name, point := range f.anchors {
+			clone.anchors[name] = &anchorPoint{last: clones[point.last]}
+		}
+	}
+	return &clone
+}
+
+// Append adds copies of the nodes of other after the nodes of the flow, so that a fragment built on its own runs as a
+// part of the flow, with its data and result. The copies get new IDs, since those of other may be taken in the flow.
+// Nothing else of other is taken but the problems found when it was built, and other is left as it is.
+func (f *FlowEngine) Append(other *FlowEngine) *FlowEngine {
+	f.buildErrors = append(f.buildErrors, other.buildErrors...)
+	for _, node := range append([]IBasicFlowNode(nil), other.nodes...) {
+		copied := cloneNode(node, f.data, f.result)
+		basicNode(copied).id = ""
+		f.appendNode(copied)
+	}
+	return f
+}
+
+func (e *ElseFlowEngine) Append(other *FlowEngine) *FlowEngine {
+	return e.invoker.Append(other)
+}
+
+func (e *ElseFlowEngine) Clone() *ElseFlowEngine {
+	invoker := e.invoker.Clone()
+	clone := NewElseFlowEngine(&invoker.data, invoker, invoker.result, &invoker.nodes)
+	clone.onSuccessFunc, clone.onFailFunc, clone.alwaysFunc = e.onSuccessFunc, e.onFailFunc, e.alwaysFunc
+	return clone
+}
+
+func copyMeta(meta map[string]string) map[string]string {
+	if meta == nil {
+		return nil
+	}
+	copied := make(map[string]string, len(meta))
+	for key, value := range meta {
+		copied[key] = value
+	}
+	return copied
+}
+
+// basicNode is the BasicFlowNode embedded by the node.
+func basicNode(node IBasicFlowNode) *BasicFlowNode {
+	return reflect.ValueOf(node).Elem().FieldByName("BasicFlowNode").Interface().(*BasicFlowNode)
+}
+
+// cloneNode copies the node and its BasicFlowNode, every node embeds one.
+func cloneNode(node IBasicFlowNode, data *_Data, result **_Result) IBasicFlowNode {
+	value := reflect.ValueOf(node).Elem()
+	copied := reflect.New(value.Type())
+	copied.Elem().Set(value)
+
+	field := copied.Elem().FieldByName("BasicFlowNode")
+	basic := *field.Interface().(*BasicFlowNode)
+	basic.Data, basic.parentResult, basic.Next, basic.matched = data, result, nil, nil
+	basic.Meta = copyMeta(basic.Meta)
+	basic.runCount, basic.lastRun, basic.sandbox = 0, time.Time{}, nil
+	field.Set(reflect.ValueOf(&basic))
+	return copied.Interface().(IBasicFlowNode)
+}
@@ -0,0 +1,100 @@
+package goflow
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+)
+
+// ExportDOT describes the nodes of the flow in the Graphviz format, it doesn't run anything. The edges follow GetNext,
+// the edge from an If or ElseIf node to the next branch is labeled "else", and the one to the node after the branches
+// is labeled "then", and the one from a Goto node to where it jumps is labeled "goto". The metadata of a node is listed
+// in its label.
+func (f *FlowEngine) ExportDOT() string {
+	indexes := make(map[IBasicFlowNode]int, len(f.nodes))
+	for i, node := range f.nodes {
+		indexes[node] = i
+	}
+
+	buf := new(bytes.Buffer)
+	buf.WriteString("digraph ")
+	buf.WriteString(dotQuote(f.name))
+	buf.WriteString(" {\n")
+	for i, node := range f.nodes {
+		label := node.GetNodeType().String()
+		if node.GetNote() != "" {
+			label = node.GetNote() + "\n" + label
+		}
+		for _, key := range sortedNames(node.metadata()) {
+			label += "\n" + key + "=" + node.metadata()[key]
+		}
+		buf.WriteString("\tn" + strconv.Itoa(i) + " [label=" + dotQuote(label) + "];\n")
+	}
+	for i, node := range f.nodes {
+		if jump, ok := node.(*GotoNode); ok {
+			if target := f.indexByNote(jump.Target); target >= 0 {
+				writeDotEdge(buf, i, target, "goto")
+			}
+		}
+		next := node.GetNext()
+		if next == nil {
+			continue
+		}
+		if !isConditionNode(node) {
+			writeDotEdge(buf, i, indexes[next], "")
+			continue
+		}
+		if isBranchNode(next) {
+			writeDotEdge(buf, i, indexes[next], "else")
+		}
+		for next != nil && isBranchNode(next) {
+			next = next.GetNext()
+		}
+		if next != nil {
+			writeDotEdge(buf, i, indexes[next], "then")
+		}
+	}
+	buf.WriteString("}\n")
+	return buf.String()
+}
+
+func (e *ElseFlowEngine) ExportDOT() string {
+	return e.invoker.ExportDOT()
+}
+
+func isConditionNode(node IBasicFlowNode) bool {
+	return node.GetNodeType() == IfNodeType || node.GetNodeType() == ElseIfNodeType
+}
+
+func isBranchNode(node IBasicFlowNode) bool {
+	if prepare, ok := node.(*PrepareNode); ok {
+		return prepare.InBranch
+	}
+	return node.GetNodeType() == ElseIfNodeType || node.GetNodeType() == ElseNodeType
+}
+
+// conditionBefore is the index of the If or ElseIf which the node at index follows, with nothing but Prepare nodes in
+// between, -1 if there is none.
+func conditionBefore(nodes []IBasicFlowNode, index int) int {
+	for i := index - 1; i >= 0; i-- {
+		if isConditionNode(nodes[i]) {
+			return i
+		}
+		if _, ok := nodes[i].(*PrepareNode); !ok {
+			break
+		}
+	}
+	return -1
+}
+
+func writeDotEdge(buf *bytes.Buffer, from, to int, label string) {
+	buf.WriteString("\tn" + strconv.Itoa(from) + " -> n" + strconv.Itoa(to))
+	if label != "" {
+		buf.WriteString(" [label=" + dotQuote(label) + "]")
+	}
+	buf.WriteString(";\n")
+}
+
+func dotQuote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s) + `"`
+}
@@ -1,5 +1,6 @@
 import argparse
 import glob
+import os
 
 
 def main():
@@ -27,19 +28,18 @@ def main():
         return
 
     # Find all the files
-    for name in ['go_flow', 'structure']:
-        file = glob.glob(args.source + f"/{name}.go")
-        if file:
-            with open(f'{args.output}/{name}.go', 'w') as output:
-                with open(file[0], 'r') as source:
-                    lines = []
-                    for line in source.readlines():
-                        line = line.replace("_Data", args.data).replace("_Result", args.result).replace("_PrepareInput",
-                                                                                                     args.prepare)
-                        if args.package is not None:
-                            line = line.replace("package goflow",f"package {args.package}")
-                        lines.append(line)
-                    output.writelines(lines)
+    for file in glob.glob(args.source + "/*.go"):
+        name = os.path.basename(file)
+        with open(f'{args.output}/{name}', 'w') as output:
+            with open(file, 'r') as source:
+                lines = []
+                for line in source.readlines():
+                    line = line.replace("_Data", args.data).replace("_Result", args.result).replace("_PrepareInput",
+                                                                                                 args.prepare)
+                    if args.package is not None:
+                        line = line.replace("package goflow",f"package {args.package}")
+                    lines.append(line)
+                output.writelines(lines)
 
     # Print the message
     print("[SUCCESS]")
@@ -0,0 +1,121 @@
+package goflow
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"time"
+)
+
+// NodeTrace is what a node leaves behind each time it runs. Matched is only set for If and ElseIf, telling whether the
+// condition held. Result is a copy of the result after the node ran, and Error is the text of its Err, since most of the
+// errors cannot be marshaled into JSON. Status is the name of its status code, see RegisterStatus. Branches is how long
+// each functor of a Parallel node took in that run, see ParallelNode.Durations.
+type NodeTrace struct {
+	Index    int
+	Note     string
+	NodeType NodeType
+	Skipped  bool
+	Matched  *bool `json:",omitempty"`
+	Start    time.Time
+	End      time.Time
+	Duration time.Duration
+	Result   *_Result
+	Error    string            `json:",omitempty"`
+	Status   string            `json:",omitempty"`
+	Meta     map[string]string `json:",omitempty"`
+	Branches []time.Duration   `json:",omitempty"`
+}
+
+func NewNodeTrace(node *BasicFlowNode, start time.Time, skipped bool) NodeTrace {
+	trace := NodeTrace{
+		Index:    node.index,
+		Note:     node.Note,
+		NodeType: node.NodeType,
+		Skipped:  skipped,
+		Matched:  node.matched,
+		Start:    start,
+		End:      Clock.Now(),
+		Meta:     copyMeta(node.Meta),
+	}
+	trace.Duration = trace.End.Sub(start)
+	if parallel, ok := node.outer().(*ParallelNode); ok && !skipped && len(parallel.Durations) != 0 {
+		trace.Branches = append([]time.Duration(nil), parallel.Durations...)
+	}
+	if result := node.GetParentResult(); result != nil {
+		snapshot := *result
+		trace.Result = &snapshot
+		if result.Err != nil {
+			trace.Error = result.Err.Error()
+		}
+		if result.StatusCode != 0 {
+			trace.Status = StatusName(result.StatusCode)
+		}
+	}
+	return trace
+}
+
+// ExecutionReport sums up the last run of a flow. FailedNode is the node which made the flow fail, nil if it succeeded.
+type ExecutionReport struct {
+	FlowName    string
+	ExecutionID string
+	Start       time.Time
+	Duration    time.Duration
+	Nodes       []NodeTrace
+	Skipped     []NodeTrace
+	FailedNode  *NodeTrace `json:",omitempty"`
+	Result      *_Result
+	Error       string `json:",omitempty"`
+}
+
+func NewExecutionID() string {
+	buf := make([]byte, 8)
+	_, _ = rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
+
+// Report returns the ExecutionReport of the last Wait.
+func (f *FlowEngine) Report() ExecutionReport {
+	report := ExecutionReport{
+		FlowName:    f.name,
+		ExecutionID: f.executionID,
+		Start:       f.startTime,
+		Duration:    f.duration,
+		Nodes:       append([]NodeTrace(nil), f.traces...),
+		Skipped:     make([]NodeTrace, 0),
+	}
+	for i, trace := range report.Nodes {
+		if trace.Skipped {
+			report.Skipped = append(report.Skipped, trace)
+			continue
+		}
+		// A failure can be recovered by a later node, so only the one the final failure starts from counts.
+		if !f.isFailure(trace.Result) {
+			report.FailedNode = nil
+		} else if report.FailedNode == nil {
+			report.FailedNode = &report.Nodes[i]
+		}
+	}
+	if result := *f.result; result != nil {
+		snapshot := *result
+		report.Result = &snapshot
+		if result.Err != nil {
+			report.Error = result.Err.Error()
+		}
+	}
+	return report
+}
+
+// ResultByNote returns the result right after the first node with the note ran in the current or the last run. It's
+// false if there is no such node or it was skipped.
+func (f *FlowEngine) ResultByNote(note string) (*_Result, bool) {
+	for _, trace := range f.traces {
+		if trace.Note == note && !trace.Skipped {
+			return trace.Result, true
+		}
+	}
+	return nil, false
+}
+
+func (e *ElseFlowEngine) ResultByNote(note string) (*_Result, bool) {
+	return e.invoker.ResultByNote(note)
+}
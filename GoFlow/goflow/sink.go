@@ -0,0 +1,121 @@
+package goflow
+
+import (
+	"log"
+	"runtime/debug"
+	"sync/atomic"
+)
+
+type IResultSinkFunc = func(note string, nodeType NodeType, _result *_Result)
+
+// SinkPolicy tells what to do with a result when the buffer of the sink is full.
+type SinkPolicy int
+
+const (
+	// SinkBlock waits for room in the buffer, so no result is lost but the flow is held up by the sink.
+	SinkBlock SinkPolicy = iota
+	// SinkDropOldest drops the oldest result in the buffer to make room.
+	SinkDropOldest
+	// SinkDropNewest drops the result which doesn't fit.
+	SinkDropNewest
+)
+
+type sinkItem struct {
+	note     string
+	nodeType NodeType
+	result   *_Result
+}
+
+// sinkRun delivers the results of a run to the sink in the background.
+type sinkRun struct {
+	flow    string
+	sink    IResultSinkFunc
+	policy  SinkPolicy
+	buffer  chan sinkItem
+	done    chan struct{}
+	dropped int64
+}
+
+func newSinkRun(flow string, sink IResultSinkFunc, bufferSize int, policy SinkPolicy) *sinkRun {
+	if bufferSize < 1 {
+		bufferSize = 1
+	}
+	run := &sinkRun{
+		flow:   flow,
+		sink:   sink,
+		policy: policy,
+		buffer: make(chan sinkItem, bufferSize),
+		done:   make(chan struct{}),
+	}
+	go func() {
+		defer close(run.done)
+		for item := range run.buffer {
+			run.deliver(item)
+		}
+	}()
+	return run
+}
+
+// deliver counts the result as dropped if the sink panics on it, and the sink goes on with the next ones.
+func (s *sinkRun) deliver(item sinkItem) {
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			atomic.AddInt64(&s.dropped, 1)
+			log.Printf("[WARNING] goflow: result sink of flow %q panicked on %q: %v\n%s", s.flow, item.note, recovered, debug.Stack())
+		}
+	}()
+	s.sink(item.note, item.nodeType, item.result)
+}
+
+func (s *sinkRun) push(item sinkItem) {
+	switch s.policy {
+	case SinkDropNewest:
+		select {
+		case s.buffer <- item:
+		default:
+			atomic.AddInt64(&s.dropped, 1)
+		}
+	case SinkDropOldest:
+		for {
+			select {
+			case s.buffer <- item:
+				return
+			default:
+			}
+			select {
+			case <-s.buffer:
+				atomic.AddInt64(&s.dropped, 1)
+			default:
+			}
+		}
+	default:
+		s.buffer <- item
+	}
+}
+
+// SetAsyncResultSink hands the result of each node which runs to the sink from another goroutine, so a slow sink
+// doesn't hold up the flow. Up to bufferSize results wait for the sink, at least one, and policy tells what to do
+// beyond that. The sink may still be busy after Wait returns, FlushResultSink waits for it. A panic in the sink is logged
+// and the result counted as dropped.
+func (f *FlowEngine) SetAsyncResultSink(sink IResultSinkFunc, bufferSize int, policy SinkPolicy) *FlowEngine {
+	f.resultSink, f.sinkBufferSize, f.sinkPolicy = sink, bufferSize, policy
+	return f
+}
+
+// FlushResultSink waits until the sink has got all the results of the last run, and returns how many were dropped.
+func (f *FlowEngine) FlushResultSink() int {
+	if f.sinkRun == nil {
+		return 0
+	}
+	<-f.sinkRun.done
+	return int(atomic.LoadInt64(&f.sinkRun.dropped))
+}
+
+func (e *ElseFlowEngine) SetAsyncResultSink(sink IResultSinkFunc, bufferSize int, policy SinkPolicy) *ElseFlowEngine {
+	e.invoker.SetAsyncResultSink(sink, bufferSize, policy)
+	return e
+}
+
+func (e *ElseFlowEngine) FlushResultSink() int {
+	return e.invoker.FlushResultSink()
+}
@@ -5,6 +5,7 @@ import "context"
 //************************DEFINE YOUR STRUCTURE BELOW****************************//
 // The name starts with underscore means replaceable.
 // [IMPORTANT] Notice that even though _Result can be replace with other type, the Err, StatusCode and StatusMsg must be provided
+// [IMPORTANT] The Ctx of _Data must be provided as well, the flow stops once it's done
 
 type _Data struct {
 	Ctx context.Context
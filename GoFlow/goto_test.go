@@ -0,0 +1,117 @@
+package main
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestGotoRetriesFromACheckpoint(t *testing.T) {
+	c := newCalls()
+	attempts := 0
+	flaky := func(*DataSet) *Result {
+		attempts++
+		c.record("charge")
+		if attempts < 3 {
+			return withStatus(503)
+		}
+		return nil
+	}
+	result := NewFlow().
+		Do(c.fn("load", nil)).
+		Do(c.fn("checkpoint", nil)).SetNote("checkpoint").
+		Do(flaky).
+		Goto("checkpoint", func(*DataSet) bool { return attempts < 3 }).
+		Do(c.fn("ship", nil)).
+		Wait()
+	if result.StatusCode != 0 || result.Err != nil {
+		t.Fatalf("got %+v", result)
+	}
+	want := []string{"load", "checkpoint", "charge", "checkpoint", "charge", "checkpoint", "charge", "ship"}
+	if got := c.sequence(); !reflect.DeepEqual(got, want) {
+		t.Errorf("calls %v", got)
+	}
+}
+
+func TestGotoStopsAfterTheMaxJumps(t *testing.T) {
+	loops := 0
+	result := NewFlow().SetMaxJumps(4).
+		Do(func(*DataSet) *Result {
+			loops++
+			return nil
+		}).SetNote("start").
+		Goto("start", func(*DataSet) bool { return true }).
+		Wait()
+	if !errors.Is(result.Err, ErrTooManyJumps) || loops != 5 {
+		t.Errorf("%d loops end with %v", loops, result.Err)
+	}
+}
+
+func TestGotoAnUnknownNote(t *testing.T) {
+	result := NewFlow().Do(ok).Goto("nowhere", func(*DataSet) bool { return true }).Wait()
+	if !errors.Is(result.Err, ErrNodeNotFound) {
+		t.Errorf("got %v", result.Err)
+	}
+}
+
+func TestJumpToSkipsAhead(t *testing.T) {
+	c := newCalls()
+	result := NewFlow().
+		Do(c.fn("start", nil)).
+		Do(func(*DataSet) *Result { return JumpTo("end") }).
+		Do(c.fn("skipped", nil)).
+		Do(c.fn("end", nil)).SetNote("end").
+		Wait()
+	if result.Err != nil {
+		t.Fatalf("got %v", result.Err)
+	}
+	if got := c.sequence(); !reflect.DeepEqual(got, []string{"start", "end"}) {
+		t.Errorf("calls %v", got)
+	}
+}
+
+func TestJumpToBackwardsStopsAfterTheMaxJumps(t *testing.T) {
+	loops := 0
+	result := NewFlow().SetMaxJumps(3).
+		Do(func(*DataSet) *Result {
+			loops++
+			return nil
+		}).SetNote("start").
+		Do(func(*DataSet) *Result { return JumpTo("start") }).
+		Wait()
+	if !errors.Is(result.Err, ErrTooManyJumps) || loops != 4 {
+		t.Errorf("%d loops end with %v", loops, result.Err)
+	}
+}
+
+func TestJumpToIsNotAFailure(t *testing.T) {
+	breaker := "jump-" + t.Name()
+	for name, build := range map[string]func(flow *FlowEngine, jump ICallable) *FlowEngine{
+		"Retry": func(flow *FlowEngine, jump ICallable) *FlowEngine { return flow.Retry(3, time.Millisecond, jump) },
+		"DoAll": func(flow *FlowEngine, jump ICallable) *FlowEngine { return flow.DoAll(jump, ok) },
+		"DoWithFallback": func(flow *FlowEngine, jump ICallable) *FlowEngine {
+			return flow.DoWithFallback(time.Second, jump, fail)
+		},
+		"Breaker": func(flow *FlowEngine, jump ICallable) *FlowEngine {
+			return flow.Breaker(breaker, BreakerConfig{FailureThreshold: 1, Cooldown: time.Hour}, jump)
+		},
+		"DoWithCompensation": func(flow *FlowEngine, jump ICallable) *FlowEngine { return flow.DoWithCompensation(jump, ok) },
+	} {
+		c := newCalls()
+		jump := func(*DataSet) *Result {
+			c.record("jump")
+			return JumpTo("end")
+		}
+		flow := build(NewFlow(), jump).Do(c.fn("skipped", nil)).Do(c.fn("end", nil)).SetNote("end")
+		if result := flow.Wait(); result.Err != nil {
+			t.Errorf("%s: got %v", name, result.Err)
+		}
+		if got := c.sequence(); !reflect.DeepEqual(got, []string{"jump", "end"}) {
+			t.Errorf("%s: calls %v", name, got)
+		}
+	}
+	if state := GetBreaker(breaker).State(); state != BreakerClosed {
+		t.Errorf("the jump opens the breaker: %v", state)
+	}
+}
@@ -0,0 +1,247 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"log"
+	"os"
+	"sync"
+	"testing"
+	"time"
+)
+
+var errTest = errors.New("test failure")
+
+func ok(*DataSet) *Result {
+	return nil
+}
+
+func fail(*DataSet) *Result {
+	return &Result{Err: errTest, StatusCode: 0, StatusMsg: ""}
+}
+
+func status(code int64) ICallable {
+	return func(*DataSet) *Result {
+		return withStatus(code)
+	}
+}
+
+func withStatus(code int64) *Result {
+	return &Result{Err: nil, StatusCode: code, StatusMsg: ""}
+}
+
+func setName(name string) ICallable {
+	return func(data *DataSet) *Result {
+		data.Name = name
+		return nil
+	}
+}
+
+func holds(*DataSet) bool {
+	return true
+}
+
+func fails(*DataSet) bool {
+	return false
+}
+
+// calls counts the calls of each functor made by fn, it's safe to use from the goroutines of Parallel.
+type calls struct {
+	mu     sync.Mutex
+	counts map[string]int
+	order  []string
+}
+
+func newCalls() *calls {
+	return &calls{counts: make(map[string]int)}
+}
+
+func (c *calls) fn(name string, result *Result) ICallable {
+	return func(*DataSet) *Result {
+		c.record(name)
+		return result
+	}
+}
+
+func (c *calls) record(name string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.counts[name]++
+	c.order = append(c.order, name)
+}
+
+func (c *calls) count(name string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.counts[name]
+}
+
+func (c *calls) sequence() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]string(nil), c.order...)
+}
+
+func failed(err error) *Result {
+	return &Result{Err: err, StatusCode: 0, StatusMsg: ""}
+}
+
+// fakeClock never waits: After moves the time forward and fires at once, and it keeps what it was asked to wait.
+type fakeClock struct {
+	mu     sync.Mutex
+	now    time.Time
+	waited []time.Duration
+}
+
+// testClock is the Clock of all the tests, so that a test can fake it without writing to the Clock read by the
+// goroutines which an earlier test has left behind.
+type testClock struct {
+	mu    sync.Mutex
+	clock IClock
+}
+
+var clocks = &testClock{clock: SystemClock{}}
+
+func TestMain(m *testing.M) {
+	Clock = clocks
+	os.Exit(m.Run())
+}
+
+func (c *testClock) use(clock IClock) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.clock = clock
+}
+
+func (c *testClock) current() IClock {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.clock
+}
+
+func (c *testClock) Now() time.Time {
+	return c.current().Now()
+}
+
+func (c *testClock) After(d time.Duration) <-chan time.Time {
+	return c.current().After(d)
+}
+
+func useFakeClock(t *testing.T) *fakeClock {
+	clock := &fakeClock{now: time.Unix(1000, 0)}
+	clocks.use(clock)
+	t.Cleanup(func() {
+		clocks.use(SystemClock{})
+	})
+	return clock
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) After(d time.Duration) <-chan time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+	c.waited = append(c.waited, d)
+	fired := make(chan time.Time, 1)
+	fired <- c.now
+	return fired
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+func (c *fakeClock) Waited() []time.Duration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]time.Duration(nil), c.waited...)
+}
+
+// logBuffer keeps what is logged by the log package during a test.
+type logBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func captureLog(t *testing.T) *logBuffer {
+	buffer := new(logBuffer)
+	log.SetOutput(buffer)
+	t.Cleanup(func() {
+		log.SetOutput(os.Stderr)
+	})
+	return buffer
+}
+
+func (l *logBuffer) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.buf.Write(p)
+}
+
+func (l *logBuffer) String() string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.buf.String()
+}
+
+// eventually waits a second at most for the condition to hold.
+func eventually(condition func() bool) bool {
+	for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+		if condition() {
+			return true
+		}
+	}
+	return condition()
+}
+
+// manualClock only fires what it's asked to wait for when the test says so.
+type manualClock struct {
+	mu      sync.Mutex
+	now     time.Time
+	pending []chan time.Time
+}
+
+func useManualClock(t *testing.T) *manualClock {
+	clock := &manualClock{now: time.Unix(1000, 0)}
+	clocks.use(clock)
+	t.Cleanup(func() {
+		clocks.use(SystemClock{})
+	})
+	return clock
+}
+
+func (c *manualClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *manualClock) After(d time.Duration) <-chan time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	fired := make(chan time.Time, 1)
+	c.pending = append(c.pending, fired)
+	return fired
+}
+
+// fire waits for something to wait for, and fires all that is waited for so far.
+func (c *manualClock) fire() {
+	eventually(func() bool {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		return len(c.pending) != 0
+	})
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, fired := range c.pending {
+		fired <- c.now
+	}
+	c.pending = nil
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestBeforeHookSkipsTheLoops(t *testing.T) {
+	c := newCalls()
+	hook := func(data *DataSet, node IBasicFlowNode) error {
+		if node.GetNodeType() == ForNodeType {
+			node.SetShouldSkip(true)
+		}
+		return nil
+	}
+	flow := NewFlow().SetBeforeHook(hook).
+		Do(c.fn("before", nil)).
+		For(3, c.fn("body", nil)).SetNote("loop").
+		Do(c.fn("after", nil))
+	if result := flow.Wait(); result.Err != nil {
+		t.Fatal(result.Err)
+	}
+	if got := c.sequence(); !reflect.DeepEqual(got, []string{"before", "after"}) {
+		t.Errorf("calls %v", got)
+	}
+	if report := flow.Report(); len(report.Skipped) != 1 || report.Skipped[0].Note != "loop" {
+		t.Errorf("skipped %+v", report.Skipped)
+	}
+}
+
+func TestBeforeHookAbortsTheFlow(t *testing.T) {
+	c := newCalls()
+	hook := func(data *DataSet, node IBasicFlowNode) error {
+		if node.GetNote() == "forbidden" {
+			return errTest
+		}
+		return nil
+	}
+	result := NewFlow().SetBeforeHook(hook).
+		Do(c.fn("allowed", nil)).
+		Do(c.fn("forbidden", nil)).SetNote("forbidden").
+		Do(c.fn("after", nil)).
+		Wait()
+	if result.Err != errTest {
+		t.Fatalf("got %v", result.Err)
+	}
+	if got := c.sequence(); !reflect.DeepEqual(got, []string{"allowed"}) {
+		t.Errorf("calls %v", got)
+	}
+}
+
+func TestBeforeHookIsNotCalledForSkippedNodes(t *testing.T) {
+	var hooked []string
+	hook := func(data *DataSet, node IBasicFlowNode) error {
+		hooked = append(hooked, node.GetNote())
+		return nil
+	}
+	NewFlow().SetBeforeHook(hook).
+		If(holds, ok).SetNote("then").
+		Else(ok).SetNote("else").
+		Do(ok).SetNote("skipped").SkipIf(func(*Result) bool { return true }).
+		Do(fail).SetNote("failing").
+		Do(ok).SetNote("after the failure").
+		Wait()
+	if !reflect.DeepEqual(hooked, []string{"then", "failing"}) {
+		t.Errorf("hooked %v", hooked)
+	}
+}
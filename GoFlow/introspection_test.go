@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestWalkCountsFunctorsPerNode(t *testing.T) {
+	flow := NewFlow().Do(ok, ok).SetNote("load").
+		Parallel(ok, ok, ok).
+		If(holds, ok).Else(ok, ok, ok, ok)
+	counts := make(map[string]int)
+	flow.Walk(func(index int, node IBasicFlowNode) bool {
+		counts[node.GetNodeType().String()+":"+node.GetNote()] += node.GetFunctorCount()
+		return true
+	})
+	want := map[string]int{"Normal:load": 2, "Parallel:": 3, "If:": 1, "Else:": 4}
+	if !reflect.DeepEqual(counts, want) {
+		t.Errorf("got %v", counts)
+	}
+}
+
+func TestWalkHaltsEarly(t *testing.T) {
+	flow := NewFlow().Do(ok).Parallel(ok).Do(ok).Do(ok)
+	var visited []int
+	flow.Walk(func(index int, node IBasicFlowNode) bool {
+		visited = append(visited, index)
+		return node.GetNodeType() != ParallelNodeType
+	})
+	if !reflect.DeepEqual(visited, []int{0, 1}) {
+		t.Errorf("visited %v", visited)
+	}
+}
+
+func TestNodesIsACopy(t *testing.T) {
+	flow := NewFlow().Do(ok).If(holds, ok).Else(ok).If(fails, ok)
+	nodes := flow.Nodes()
+	if len(nodes) != 4 || flow.CountByType(IfNodeType) != 2 || flow.CountByType(ParallelNodeType) != 0 {
+		t.Fatalf("%d nodes, %d If", len(nodes), flow.CountByType(IfNodeType))
+	}
+	nodes[0] = nil
+	if flow.Nodes()[0] == nil {
+		t.Error("the flow is changed through the slice")
+	}
+}
+
+func TestNodeString(t *testing.T) {
+	flow := NewFlow().Do(ok, ok).SetNote("load").
+		Parallel(ok).
+		If(holds, ok).Else(ok, ok, ok)
+	var got []string
+	for _, node := range flow.Nodes() {
+		stringer, ok := node.(fmt.Stringer)
+		if !ok {
+			t.Fatalf("%s has no String", node.GetNodeType())
+		}
+		got = append(got, stringer.String())
+	}
+	want := []string{`Normal "load" (2 functors)`, "Parallel (1 functors)", "If (1 functors)", "Else (3 functors)"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q", got)
+	}
+}
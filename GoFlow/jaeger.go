@@ -0,0 +1,49 @@
+package main
+
+// IJaegerSpan is the part of a span used by JaegerTracer.
+type IJaegerSpan interface {
+	SetTag(key string, value interface{})
+	Finish()
+}
+
+// IJaegerSpanStarter starts a span. A Jaeger client tracer satisfies it with a thin wrapper around its StartSpan, the
+// flow doesn't depend on the client itself.
+type IJaegerSpanStarter interface {
+	StartSpan(operationName string) IJaegerSpan
+}
+
+// JaegerTracer emits a span for each node. The operation name is the note of the node, or its type if there's no note,
+// and the status code and the error of the result are set as tags.
+type JaegerTracer struct {
+	Tracer IJaegerSpanStarter
+}
+
+func NewJaegerTracer(tracer IJaegerSpanStarter) *JaegerTracer {
+	return &JaegerTracer{Tracer: tracer}
+}
+
+// StartNode does nothing if there's no tracer.
+func (j *JaegerTracer) StartNode(note string, nodeType NodeType, _data *DataSet) func(_result *Result) {
+	if j == nil || j.Tracer == nil {
+		return func(*Result) {}
+	}
+	operation := note
+	if operation == "" {
+		operation = nodeType.String()
+	}
+	span := j.Tracer.StartSpan(operation)
+	span.SetTag("node.type", nodeType.String())
+	return func(_result *Result) {
+		if _result != nil {
+			span.SetTag("status.code", _result.StatusCode)
+			if _result.StatusCode != 0 {
+				span.SetTag("status.name", StatusName(_result.StatusCode))
+			}
+			if _result.Err != nil {
+				span.SetTag("error", true)
+				span.SetTag("error.message", _result.Err.Error())
+			}
+		}
+		span.Finish()
+	}
+}
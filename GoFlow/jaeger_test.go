@@ -0,0 +1,69 @@
+package main
+
+import (
+	"testing"
+)
+
+type mockSpan struct {
+	operation string
+	tags      map[string]interface{}
+	finished  bool
+}
+
+func (s *mockSpan) SetTag(key string, value interface{}) {
+	s.tags[key] = value
+}
+
+func (s *mockSpan) Finish() {
+	s.finished = true
+}
+
+type mockSpanRecorder struct {
+	spans []*mockSpan
+}
+
+func (r *mockSpanRecorder) StartSpan(operationName string) IJaegerSpan {
+	span := &mockSpan{operation: operationName, tags: make(map[string]interface{})}
+	r.spans = append(r.spans, span)
+	return span
+}
+
+func TestJaegerTracerEmitsASpanPerNode(t *testing.T) {
+	recorder := new(mockSpanRecorder)
+	NewFlow().SetTracer(NewJaegerTracer(recorder)).
+		Do(ok).SetNote("load").
+		Parallel(ok, ok).
+		Do(fail).SetNote("save").
+		Do(ok).SetNote("skipped").
+		Wait()
+	if len(recorder.spans) != 3 {
+		t.Fatalf("%d spans", len(recorder.spans))
+	}
+	load, parallel, save := recorder.spans[0], recorder.spans[1], recorder.spans[2]
+	if load.operation != "load" || parallel.operation != "Parallel" || save.operation != "save" {
+		t.Errorf("operations %q %q %q", load.operation, parallel.operation, save.operation)
+	}
+	if load.tags["node.type"] != "Normal" || load.tags["error"] != nil || !load.finished {
+		t.Errorf("load tags %v", load.tags)
+	}
+	if save.tags["error"] != true || save.tags["error.message"] != errTest.Error() || save.tags["status.code"] != int64(0) {
+		t.Errorf("save tags %v", save.tags)
+	}
+}
+
+func TestJaegerTracerWithoutTracerIsANoOp(t *testing.T) {
+	if result := NewFlow().SetTracer(NewJaegerTracer(nil)).Do(ok).Wait(); result.Err != nil {
+		t.Fatal(result.Err)
+	}
+	var tracer *JaegerTracer
+	tracer.StartNode("note", NormalNodeType, nil)(nil)
+}
+
+func TestJaegerTracerTagsTheStatus(t *testing.T) {
+	RegisterStatus(4242, "TEAPOT_TIMEOUT")
+	recorder := new(mockSpanRecorder)
+	NewFlow().SetTracer(NewJaegerTracer(recorder)).Do(status(4242)).Wait()
+	if tags := recorder.spans[0].tags; tags["status.code"] != int64(4242) || tags["status.name"] != "TEAPOT_TIMEOUT" {
+		t.Errorf("tags %v", tags)
+	}
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestGlobalLoggersCoverNodesAddedAfterThem(t *testing.T) {
+	var begins, ends []string
+	flow := NewFlow().
+		SetGlobalBeginLogger(func(note string, data *DataSet) { begins = append(begins, note) }).
+		SetGlobalEndLogger(func(note string, data *DataSet, result *Result) { ends = append(ends, note) }).
+		Do(ok).SetNote("one").
+		Do(ok).SetNote("two").
+		Do(ok).SetNote("three")
+	flow.Wait()
+	want := []string{"one", "two", "three"}
+	if !reflect.DeepEqual(begins, want) || !reflect.DeepEqual(ends, want) {
+		t.Errorf("logged %v and %v", begins, ends)
+	}
+}
+
+func TestNodeLoggerOverridesTheGlobalOne(t *testing.T) {
+	var global, own []string
+	NewFlow().
+		SetGlobalBeginLogger(func(note string, data *DataSet) { global = append(global, note) }).
+		Do(ok).SetNote("plain").
+		Do(ok).SetNote("custom").SetBeginLogger(func(note string, data *DataSet) { own = append(own, note) }).
+		Wait()
+	if !reflect.DeepEqual(global, []string{"plain"}) || !reflect.DeepEqual(own, []string{"custom"}) {
+		t.Errorf("global %v, own %v", global, own)
+	}
+}
+
+// eventLogger records every event as "kind:note".
+type eventLogger struct {
+	events []string
+	ids    map[string]string
+}
+
+func (l *eventLogger) record(kind string, ctx FlowLogContext) {
+	l.events = append(l.events, kind+":"+ctx.Note)
+	if l.ids == nil {
+		l.ids = make(map[string]string)
+	}
+	l.ids[ctx.Note] = ctx.ID
+}
+
+func (l *eventLogger) OnBegin(ctx FlowLogContext) { l.record("begin", ctx) }
+
+func (l *eventLogger) OnEnd(ctx FlowLogContext) { l.record("end", ctx) }
+
+func (l *eventLogger) OnSkip(ctx FlowLogContext) { l.record("skip", ctx) }
+
+func TestFlowLoggerIsToldAboutTheSkippedBranches(t *testing.T) {
+	logger := &eventLogger{}
+	flow := NewFlow().SetLogger(logger).
+		If(fails, ok).SetNote("if").
+		ElseIf(holds, ok).SetNote("else if").
+		Else(ok).SetNote("else").
+		Do(fail).SetNote("failing").
+		Do(ok).SetNote("after")
+	flow.Wait()
+	want := []string{
+		"begin:if", "end:if",
+		"begin:else if", "end:else if",
+		"skip:else",
+		"begin:failing", "end:failing",
+		"skip:after",
+	}
+	if !reflect.DeepEqual(logger.events, want) {
+		t.Errorf("events %v", logger.events)
+	}
+	if logger.ids["if"] != flow.nodes[0].GetID() || logger.ids["after"] != flow.nodes[4].GetID() {
+		t.Errorf("IDs %v", logger.ids)
+	}
+}
+
+func TestSetLoggerNilRestoresTheNopLogger(t *testing.T) {
+	logger := &eventLogger{}
+	NewFlow().SetLogger(logger).SetLogger(nil).Do(ok).Wait()
+	if len(logger.events) != 0 {
+		t.Errorf("events %v", logger.events)
+	}
+}
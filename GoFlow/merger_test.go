@@ -0,0 +1,53 @@
+package main
+
+import (
+	"testing"
+)
+
+func joinMessages(prev, next *Result) *Result {
+	code := prev.StatusCode
+	if next.StatusCode > code {
+		code = next.StatusCode
+	}
+	return &Result{Err: next.Err, StatusCode: code, StatusMsg: prev.StatusMsg + next.StatusMsg}
+}
+
+func message(code int64, msg string) ICallable {
+	return func(*DataSet) *Result {
+		return &Result{Err: nil, StatusCode: code, StatusMsg: msg}
+	}
+}
+
+func TestResultMergerAccumulatesAcrossTheChain(t *testing.T) {
+	result := NewFlow().SetResultMerger(joinMessages).
+		SetFailurePredicate(func(result *Result) bool { return result.Err != nil }).
+		Parallel(message(2, "a")).
+		Parallel(message(5, "b")).
+		Parallel(message(3, "c")).
+		Wait()
+	if result.StatusCode != 5 || result.StatusMsg != "abc" {
+		t.Errorf("got %+v", result)
+	}
+}
+
+func TestWithoutResultMergerTheResultIsReplaced(t *testing.T) {
+	result := NewFlow().
+		SetFailurePredicate(func(result *Result) bool { return result.Err != nil }).
+		Parallel(message(5, "a")).
+		Parallel(message(3, "b")).
+		Wait()
+	if result.StatusCode != 3 || result.StatusMsg != "b" {
+		t.Errorf("got %+v", result)
+	}
+}
+
+func TestResultMergerReturningNilKeepsTheNodeResult(t *testing.T) {
+	result := NewFlow().SetResultMerger(func(prev, next *Result) *Result { return nil }).
+		SetFailurePredicate(func(result *Result) bool { return result.Err != nil }).
+		Parallel(message(3, "first")).
+		Do(fail).
+		Wait()
+	if result.Err != errTest || result.StatusMsg != "" {
+		t.Errorf("got %+v", result)
+	}
+}
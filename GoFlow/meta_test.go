@@ -0,0 +1,43 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestMetaIsShownAndTracedWithoutChangingTheRun(t *testing.T) {
+	c := newCalls()
+	flow := NewFlow().
+		Do(c.fn("load", nil)).SetNote("load").WithMeta(map[string]string{"owner": "team-a", "sla": "100ms"}).
+		Do(c.fn("save", nil))
+	if value, found := flow.nodes[0].GetMeta("owner"); !found || value != "team-a" {
+		t.Errorf("got %q", value)
+	}
+	if _, found := flow.nodes[1].GetMeta("owner"); found {
+		t.Error("the metadata is on the next node")
+	}
+	if dot := flow.ExportDOT(); !strings.Contains(dot, `n0 [label="load\nNormal\nowner=team-a\nsla=100ms"];`) {
+		t.Errorf("exported %s", dot)
+	}
+	_, traces := flow.WaitWithTrace()
+	if !reflect.DeepEqual(c.sequence(), []string{"load", "save"}) {
+		t.Errorf("calls %v", c.sequence())
+	}
+	if traces[0].Meta["sla"] != "100ms" || traces[1].Meta != nil {
+		t.Errorf("traced %v and %v", traces[0].Meta, traces[1].Meta)
+	}
+}
+
+func TestMetaSurvivesAClone(t *testing.T) {
+	flow := NewFlow().Do(ok).WithMeta(map[string]string{"owner": "team-a"})
+	clone := flow.Clone()
+	clone.nodes[0].SetMeta("owner", "team-b")
+	if value, _ := flow.nodes[0].GetMeta("owner"); value != "team-a" {
+		t.Errorf("the clone shares the metadata: %q", value)
+	}
+	clone = flow.Clone()
+	if value, found := clone.nodes[0].GetMeta("owner"); !found || value != "team-a" {
+		t.Errorf("the clone has %q", value)
+	}
+}
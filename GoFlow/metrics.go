@@ -0,0 +1,66 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// FlowMetrics collects how long each node takes. RecordNode is called after a node runs, failed tells whether the
+// result is a failure after it, and RecordSkipped is called for a node which doesn't run.
+type FlowMetrics interface {
+	RecordNode(note string, nodeType NodeType, duration time.Duration, failed bool)
+	RecordSkipped(note string, nodeType NodeType)
+}
+
+type NodeMetric struct {
+	Note     string
+	NodeType NodeType
+	Duration time.Duration
+	Failed   bool
+	Skipped  bool
+}
+
+// MemoryMetrics keeps the metrics in memory, which is enough to find the slow node. It can be shared by flows running
+// at the same time.
+type MemoryMetrics struct {
+	mutex   sync.Mutex
+	records []NodeMetric
+}
+
+func NewMemoryMetrics() *MemoryMetrics {
+	return &MemoryMetrics{}
+}
+
+func (m *MemoryMetrics) RecordNode(note string, nodeType NodeType, duration time.Duration, failed bool) {
+	m.record(NodeMetric{Note: note, NodeType: nodeType, Duration: duration, Failed: failed})
+}
+
+func (m *MemoryMetrics) RecordSkipped(note string, nodeType NodeType) {
+	m.record(NodeMetric{Note: note, NodeType: nodeType, Skipped: true})
+}
+
+func (m *MemoryMetrics) record(metric NodeMetric) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.records = append(m.records, metric)
+}
+
+// Records are the metrics in the order they are recorded.
+func (m *MemoryMetrics) Records() []NodeMetric {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return append([]NodeMetric(nil), m.records...)
+}
+
+// Durations sums up the durations of the nodes which ran by note.
+func (m *MemoryMetrics) Durations() map[string]time.Duration {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	durations := make(map[string]time.Duration)
+	for _, record := range m.records {
+		if !record.Skipped {
+			durations[record.Note] += record.Duration
+		}
+	}
+	return durations
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMemoryMetricsOfAThreeNodeFlow(t *testing.T) {
+	metrics := NewMemoryMetrics()
+	slow := func(*DataSet) *Result {
+		time.Sleep(5 * time.Millisecond)
+		return nil
+	}
+	NewFlow().WithMetrics(metrics).
+		Do(ok).SetNote("load").
+		Do(slow).SetNote("charge").
+		Do(status(3)).SetNote("ship").
+		Wait()
+	records := metrics.Records()
+	if len(records) != 3 {
+		t.Fatalf("%d records", len(records))
+	}
+	for i, note := range []string{"load", "charge", "ship"} {
+		if records[i].Note != note || records[i].NodeType != NormalNodeType || records[i].Skipped {
+			t.Errorf("record %d: %+v", i, records[i])
+		}
+	}
+	if records[0].Failed || !records[2].Failed {
+		t.Errorf("records %+v", records)
+	}
+	durations := metrics.Durations()
+	if durations["charge"] < 5*time.Millisecond || durations["charge"] < durations["load"] {
+		t.Errorf("durations %v", durations)
+	}
+}
+
+func TestMemoryMetricsMarksSkippedNodes(t *testing.T) {
+	metrics := NewMemoryMetrics()
+	NewFlow().WithMetrics(metrics).
+		If(holds, ok).SetNote("then").
+		Else(ok).SetNote("else").
+		Wait()
+	records := metrics.Records()
+	if len(records) != 2 || records[0].Skipped || !records[1].Skipped || records[1].Note != "else" {
+		t.Errorf("records %+v", records)
+	}
+	if _, found := metrics.Durations()["else"]; found {
+		t.Error("a skipped node has a duration")
+	}
+}
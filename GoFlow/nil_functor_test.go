@@ -0,0 +1,126 @@
+package main
+
+import (
+	"math/rand"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestNilFunctorsAreSkipped(t *testing.T) {
+	for name, build := range map[string]func(c *calls) *FlowEngine{
+		"Do": func(c *calls) *FlowEngine { return NewFlow().Do(c.fn("first", nil), nil, c.fn("third", nil)) },
+		"If": func(c *calls) *FlowEngine {
+			return NewFlow().If(holds, c.fn("first", nil), nil, c.fn("third", nil)).Else(ok)
+		},
+		"ElseIf": func(c *calls) *FlowEngine {
+			return NewFlow().If(fails, ok).ElseIf(holds, c.fn("first", nil), nil, c.fn("third", nil)).Else(ok)
+		},
+		"Else": func(c *calls) *FlowEngine {
+			return NewFlow().If(fails, ok).Else(c.fn("first", nil), nil, c.fn("third", nil))
+		},
+		"For": func(c *calls) *FlowEngine { return NewFlow().For(1, c.fn("first", nil), nil, c.fn("third", nil)) },
+		"Parallel": func(c *calls) *FlowEngine {
+			return NewFlow().SetDeterministic(true).Parallel(c.fn("first", nil), nil, c.fn("third", nil))
+		},
+		"Retry": func(c *calls) *FlowEngine { return NewFlow().Retry(2, 0, c.fn("first", nil), nil, c.fn("third", nil)) },
+		"Fallback": func(c *calls) *FlowEngine {
+			failing := func(*DataSet) *Result { return failed(errTest) }
+			return NewFlow().Do(failing).Fallback(c.fn("first", nil), nil, c.fn("third", nil))
+		},
+		"RouteByCode": func(c *calls) *FlowEngine {
+			return NewFlow().RouteByCode(map[int64][]ICallable{0: {c.fn("first", nil), nil, c.fn("third", nil)}}, nil)
+		},
+		"Split": func(c *calls) *FlowEngine {
+			branch := WeightedBranch{Weight: 1, Functors: []ICallable{c.fn("first", nil), nil, c.fn("third", nil)}}
+			return NewFlow().Split(rand.New(rand.NewSource(1)), []WeightedBranch{branch})
+		},
+		"Breaker": func(c *calls) *FlowEngine {
+			closeBreakerAfter(t, "nil functors")
+			return NewFlow().Breaker("nil functors", BreakerConfig{}, c.fn("first", nil), nil, c.fn("third", nil))
+		},
+		"RateLimited": func(c *calls) *FlowEngine {
+			return NewFlow().RateLimited(nil, c.fn("first", nil), nil, c.fn("third", nil))
+		},
+		"Poll": func(c *calls) *FlowEngine {
+			return NewFlow().Poll(time.Millisecond, 0, holds, c.fn("first", nil), nil, c.fn("third", nil))
+		},
+		"Race": func(c *calls) *FlowEngine { return NewFlow().Race(nil, c.fn("first", nil)).Do(c.fn("third", nil)) },
+		"DoWithPrev": func(c *calls) *FlowEngine {
+			prev := func(name string) IPrevCallable {
+				return func(data *DataSet, result *Result) *Result { return c.fn(name, nil)(data) }
+			}
+			return NewFlow().DoWithPrev(prev("first"), nil, prev("third"))
+		},
+		"Tap": func(c *calls) *FlowEngine {
+			tap := func(name string) ITapFunc {
+				return func(data *DataSet, result *Result) { c.fn(name, nil)(data) }
+			}
+			return NewFlow().Tap(tap("first"), nil, tap("third"))
+		},
+		"Prepare": func(c *calls) *FlowEngine {
+			prepare := func(name string) IPrepareFunc {
+				return func(data *DataSet, input InputParam) *Result { return c.fn(name, nil)(data) }
+			}
+			return NewFlow().Prepare(InputParam{}, prepare("first"), nil, prepare("third"))
+		},
+		"DoWithCompensation": func(c *calls) *FlowEngine {
+			return NewFlow().Do(c.fn("first", nil)).DoWithCompensation(nil, nil).Do(c.fn("third", nil))
+		},
+		"DoWithFallback": func(c *calls) *FlowEngine {
+			return NewFlow().Do(c.fn("first", nil)).DoWithFallback(0, nil, nil).Do(c.fn("third", nil))
+		},
+		"ForEach": func(c *calls) *FlowEngine {
+			items := func(*DataSet) []interface{} { return []interface{}{1, 2} }
+			return NewFlow().Do(c.fn("first", nil)).ForEach(items, nil).Do(c.fn("third", nil))
+		},
+	} {
+		c := newCalls()
+		if result := build(c).Wait(); result.Err != nil {
+			t.Errorf("%s: got %v", name, result.Err)
+		}
+		if got := c.sequence(); !reflect.DeepEqual(got, []string{"first", "third"}) {
+			t.Errorf("%s: calls %v", name, got)
+		}
+	}
+}
+
+func TestStrictPanicsOnANilFunctorOfAnyNode(t *testing.T) {
+	for name, build := range map[string]func(flow *FlowEngine){
+		"If":       func(flow *FlowEngine) { flow.If(holds, ok, nil) },
+		"ElseIf":   func(flow *FlowEngine) { flow.If(holds, ok).ElseIf(holds, nil) },
+		"Else":     func(flow *FlowEngine) { flow.If(holds, ok).Else(nil) },
+		"For":      func(flow *FlowEngine) { flow.For(1, nil) },
+		"Parallel": func(flow *FlowEngine) { flow.Parallel(ok, nil) },
+		"Retry":    func(flow *FlowEngine) { flow.Retry(2, 0, nil) },
+		"Fallback": func(flow *FlowEngine) { flow.Fallback(ok, nil) },
+		"RouteByCode": func(flow *FlowEngine) {
+			flow.RouteByCode(map[int64][]ICallable{200: {nil}}, []ICallable{ok})
+		},
+		"Split": func(flow *FlowEngine) {
+			flow.Split(rand.New(rand.NewSource(1)), []WeightedBranch{{Weight: 1, Functors: []ICallable{nil}}})
+		},
+		"Breaker": func(flow *FlowEngine) {
+			closeBreakerAfter(t, "strict nil functors")
+			flow.Breaker("strict nil functors", BreakerConfig{}, nil)
+		},
+		"RateLimited":        func(flow *FlowEngine) { flow.RateLimited(nil, ok, nil) },
+		"Poll":               func(flow *FlowEngine) { flow.Poll(time.Millisecond, 0, holds, nil) },
+		"Race":               func(flow *FlowEngine) { flow.Race(ok, nil) },
+		"DoWithPrev":         func(flow *FlowEngine) { flow.DoWithPrev(nil) },
+		"Tap":                func(flow *FlowEngine) { flow.Tap(nil) },
+		"Prepare":            func(flow *FlowEngine) { flow.Prepare(InputParam{}, nil) },
+		"DoWithCompensation": func(flow *FlowEngine) { flow.DoWithCompensation(nil, nil) },
+		"DoWithFallback":     func(flow *FlowEngine) { flow.DoWithFallback(time.Second, ok, nil) },
+		"ForEach":            func(flow *FlowEngine) { flow.ForEach(func(*DataSet) []interface{} { return nil }, nil) },
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("%s doesn't panic", name)
+				}
+			}()
+			build(NewFlow().Strict())
+		}()
+	}
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNodeIDsTellApartTheSameNote(t *testing.T) {
+	var begun, ended []string
+	flow := NewFlow().
+		SetGlobalBeginIDLogger(func(id string, note string, _ *DataSet) { begun = append(begun, id+":"+note) }).
+		SetGlobalEndIDLogger(func(id string, note string, _ *DataSet, _ *Result) { ended = append(ended, id+":"+note) }).
+		Do(ok).SetNote("save").
+		Do(ok).SetNote("save")
+	flow.Wait()
+	want := []string{flow.nodes[0].GetID() + ":save", flow.nodes[1].GetID() + ":save"}
+	if want[0] == want[1] {
+		t.Fatalf("both nodes have the ID %q", flow.nodes[0].GetID())
+	}
+	if !reflect.DeepEqual(begun, want) || !reflect.DeepEqual(ended, want) {
+		t.Errorf("begun %v and ended %v", begun, ended)
+	}
+}
+
+func TestNodeIDsAreStableAcrossClone(t *testing.T) {
+	flow := NewFlow().Do(ok).If(holds, ok).Else(ok).Parallel(ok, ok)
+	clone := flow.Clone()
+	if len(clone.nodes) != len(flow.nodes) {
+		t.Fatalf("%d nodes in the clone of %d", len(clone.nodes), len(flow.nodes))
+	}
+	for i := range flow.nodes {
+		if clone.nodes[i].GetID() != flow.nodes[i].GetID() {
+			t.Errorf("node %d has the ID %q in the clone and %q in the flow", i, clone.nodes[i].GetID(), flow.nodes[i].GetID())
+		}
+	}
+}
+
+func TestNodeAddedToACloneGetsAFreshID(t *testing.T) {
+	flow := NewFlow().Do(ok).Do(ok)
+	clone := flow.Clone().Do(ok)
+	last := clone.nodes[len(clone.nodes)-1].GetID()
+	for _, node := range flow.nodes {
+		if node.GetID() == last {
+			t.Errorf("the new node reuses the ID %q", last)
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestOnPanicGetsTheStack(t *testing.T) {
+	var got interface{}
+	var stack []byte
+	c := newCalls()
+	result := NewFlow().
+		OnPanic(func(data *DataSet, recovered interface{}, s []byte) {
+			got, stack = recovered, s
+		}).
+		Do(func(*DataSet) *Result { panic("serial") }).
+		Do(c.fn("after", nil)).
+		Wait()
+	if got != "serial" || len(stack) == 0 {
+		t.Errorf("OnPanic got %v with %d bytes of stack", got, len(stack))
+	}
+	var panicked *PanicHappened
+	if !errors.As(result.Err, &panicked) || !strings.Contains(panicked.Msg, "goroutine") {
+		t.Fatalf("got %v", result.Err)
+	}
+	if c.count("after") != 0 {
+		t.Error("the flow goes on after the panic")
+	}
+}
+
+func TestOnPanicInParallel(t *testing.T) {
+	var mu sync.Mutex
+	panics := 0
+	boom := func(*DataSet) *Result { panic("parallel") }
+	result := NewFlow().
+		OnPanic(func(*DataSet, interface{}, []byte) {
+			mu.Lock()
+			panics++
+			mu.Unlock()
+		}).
+		Parallel(boom, ok, boom).
+		Wait()
+	if !errors.Is(result.Err, ErrPanicHappened) || panics != 2 {
+		t.Errorf("%d panics end with %v", panics, result.Err)
+	}
+}
+
+func TestPanicHappenedTellsWhatPanicked(t *testing.T) {
+	boom := errors.New("boom")
+	panics := func(*DataSet) *Result { panic(boom) }
+	for _, flow := range []*FlowEngine{NewFlow().Do(panics), NewFlow().Parallel(ok, panics)} {
+		result := flow.Wait()
+		var panicked *PanicHappened
+		if !errors.As(result.Err, &panicked) || !strings.Contains(panicked.Error(), "boom") {
+			t.Fatalf("got %v", result.Err)
+		}
+		if panicked.Recovered != boom || !errors.Is(result.Err, boom) {
+			t.Error("the recovered error isn't kept")
+		}
+	}
+}
+
+type quotaExceeded struct {
+	tenant string
+}
+
+func TestSetPanicMapperTurnsADomainPanicIntoAResult(t *testing.T) {
+	mapper := func(recovered interface{}, stack []byte) *Result {
+		if quota, ok := recovered.(quotaExceeded); ok {
+			return &Result{Err: errTest, StatusCode: 429, StatusMsg: quota.tenant}
+		}
+		return nil
+	}
+	panics := func(*DataSet) *Result { panic(quotaExceeded{tenant: "acme"}) }
+	result := NewFlow().Do(panics).SetPanicMapper(mapper).Wait()
+	if result.StatusCode != 429 || result.StatusMsg != "acme" || result.Err != errTest {
+		t.Errorf("got %+v", result)
+	}
+}
+
+func TestSetPanicMapperFallsBackToPanicHappened(t *testing.T) {
+	mapper := func(interface{}, []byte) *Result { return nil }
+	panics := func(*DataSet) *Result { panic("other") }
+	if result := NewFlow().Do(panics).SetPanicMapper(mapper).Wait(); !errors.Is(result.Err, ErrPanicHappened) {
+		t.Errorf("got %v", result.Err)
+	}
+}
+
+func TestPanicInASerialNodeGoesToOnFail(t *testing.T) {
+	var failedWith *Result
+	c := newCalls()
+	result := NewFlow().
+		OnFail(func(data *DataSet, result *Result) { failedWith = result }).
+		Do(c.fn("before", nil)).
+		Do(func(*DataSet) *Result { panic("x") }).
+		Do(c.fn("after", nil)).
+		Wait()
+	if !errors.Is(result.Err, ErrPanicHappened) || failedWith != result {
+		t.Errorf("got %v, OnFail got %v", result.Err, failedWith)
+	}
+	if c.count("before") != 1 || c.count("after") != 0 {
+		t.Errorf("calls %v", c.sequence())
+	}
+}
+
+func TestPanicInEachKindOfSerialNode(t *testing.T) {
+	panics := func(*DataSet) *Result { panic("x") }
+	for name, flow := range map[string]*FlowEngine{
+		"If":     NewFlow().If(holds, panics).Else(ok),
+		"Else":   NewFlow().If(fails, ok).Else(panics),
+		"For":    NewFlow().For(2, panics),
+		"Retry":  NewFlow().Retry(1, 0, panics),
+		"Prev":   NewFlow().DoWithPrev(func(*DataSet, *Result) *Result { panic("x") }),
+		"Assert": NewFlow().Assert("positive", func(*DataSet, *Result) bool { panic("x") }),
+	} {
+		if result := flow.Wait(); !errors.Is(result.Err, ErrPanicHappened) {
+			t.Errorf("%s: got %v", name, result.Err)
+		}
+	}
+}
@@ -0,0 +1,383 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Run with -race: the functors of an isolated Parallel node write to their own copies of the data.
+func TestParallelIsolatedHasNoRace(t *testing.T) {
+	write := func(name string) ICallable {
+		return func(data *DataSet) *Result {
+			data.Name += name
+			return nil
+		}
+	}
+	merge := func(dst *DataSet, src *DataSet) {
+		dst.Name += src.Name
+	}
+	flow := NewFlow().ParallelIsolated(merge, write("a"), write("b"), write("c"))
+	if result := flow.Wait(); result.Err != nil {
+		t.Fatal(result.Err)
+	}
+	if name := flow.data.Name; name != "abc" {
+		t.Errorf("merged in the order of the functors into %q", name)
+	}
+}
+
+func TestParallelIsolatedAccumulatesThroughTheMerge(t *testing.T) {
+	type key struct{}
+	ctx := context.WithValue(context.Background(), key{}, "value")
+	var mu sync.Mutex
+	seen := make(map[*DataSet]bool)
+	increment := func(data *DataSet) *Result {
+		mu.Lock()
+		seen[data] = true
+		shared := data.Ctx == ctx
+		mu.Unlock()
+		if !shared {
+			return failed(errTest)
+		}
+		count, _ := strconv.Atoi(data.Name)
+		data.Name = strconv.Itoa(count + 1)
+		return nil
+	}
+	add := func(dst *DataSet, src *DataSet) {
+		total, _ := strconv.Atoi(dst.Name)
+		count, _ := strconv.Atoi(src.Name)
+		dst.Name = strconv.Itoa(total + count)
+	}
+	functors := make([]ICallable, 10)
+	for i := range functors {
+		functors[i] = increment
+	}
+	flow := NewFlow().ParallelIsolated(add, functors...)
+	flow.data.Ctx, flow.data.Name = ctx, "0"
+	if result := flow.Wait(); result.Err != nil {
+		t.Fatalf("a copy doesn't share the ctx: %v", result.Err)
+	}
+	if flow.data.Name != "10" {
+		t.Errorf("merged into %q", flow.data.Name)
+	}
+	if len(seen) != 10 || seen[flow.data] {
+		t.Errorf("%d copies for 10 functors", len(seen))
+	}
+}
+
+func TestShallowCloneDataKeepsTheCtx(t *testing.T) {
+	data := &DataSet{Ctx: context.Background(), Name: "Tom"}
+	clone := ShallowCloneData(data)
+	clone.Name = "Jerry"
+	if clone == data || clone.Ctx != data.Ctx || data.Name != "Tom" {
+		t.Errorf("cloned %+v into %+v", data, clone)
+	}
+}
+
+func TestParallelSharesDataWithoutMerger(t *testing.T) {
+	var seen []*DataSet
+	record := func(data *DataSet) *Result {
+		seen = append(seen, data)
+		return nil
+	}
+	flow := NewFlow().SetDeterministic(true).Parallel(record, record)
+	flow.Wait()
+	if len(seen) != 2 || seen[0] != flow.data || seen[1] != flow.data {
+		t.Error("the functors don't share the data when the node isn't isolated")
+	}
+}
+
+func TestSetDataIsolationCoversAllParallelNodes(t *testing.T) {
+	merge := func(dst *DataSet, src *DataSet) {
+		if !strings.Contains(dst.Name, src.Name) {
+			dst.Name += src.Name
+		}
+	}
+	flow := NewFlow().SetDataIsolation(merge, nil).
+		Parallel(setName("x"), setName("y")).
+		Parallel(setName("z"))
+	flow.Wait()
+	if flow.data.Name != "xyz" {
+		t.Errorf("got %q", flow.data.Name)
+	}
+}
+
+func TestParallelKeepsEveryResult(t *testing.T) {
+	flow := NewFlow().SetDeterministic(true).Parallel(ok, status(2), fail, status(0)).SetNote("fan-out")
+	result := flow.Wait()
+	if result.StatusCode != 2 || result.Err != nil {
+		t.Errorf("the node result isn't the first failure: %+v", result)
+	}
+	results := flow.ParallelResults("fan-out")
+	if len(results) != 4 {
+		t.Fatalf("%d results", len(results))
+	}
+	if results[0] != nil || results[1].StatusCode != 2 || results[2].Err != errTest || results[3].StatusCode != 0 {
+		t.Errorf("results %v", results)
+	}
+}
+
+func TestParallelWithLimitBoundsInFlightFunctors(t *testing.T) {
+	var mu sync.Mutex
+	inFlight, peak := 0, 0
+	work := func(*DataSet) *Result {
+		mu.Lock()
+		inFlight++
+		if inFlight > peak {
+			peak = inFlight
+		}
+		mu.Unlock()
+		time.Sleep(time.Millisecond)
+		mu.Lock()
+		inFlight--
+		mu.Unlock()
+		return nil
+	}
+	functors := make([]ICallable, 20)
+	for i := range functors {
+		functors[i] = work
+	}
+	flow := NewFlow().ParallelWithLimit(3, functors...).SetNote("limited")
+	if result := flow.Wait(); result.Err != nil {
+		t.Fatal(result.Err)
+	}
+	if peak > 3 || peak == 0 {
+		t.Errorf("peak of %d functors in flight", peak)
+	}
+	if len(flow.ParallelResults("limited")) != 20 {
+		t.Error("not all the functors ran")
+	}
+}
+
+func TestParallelWithoutLimitRunsAllAtOnce(t *testing.T) {
+	const n = 5
+	var started sync.WaitGroup
+	started.Add(n)
+	work := func(*DataSet) *Result {
+		started.Done()
+		// Only returns once all of them have started, which can't happen with a limit
+		started.Wait()
+		return nil
+	}
+	functors := make([]ICallable, n)
+	for i := range functors {
+		functors[i] = work
+	}
+	if result := NewFlow().ParallelWithLimit(0, functors...).Wait(); result.Err != nil {
+		t.Fatal(result.Err)
+	}
+}
+
+func TestParallelWithLimitRecoversPanics(t *testing.T) {
+	panics := func(*DataSet) *Result { panic("boom") }
+	result := NewFlow().ParallelWithLimit(1, ok, panics, ok).Wait()
+	if !errors.Is(result.Err, ErrPanicHappened) {
+		t.Errorf("got %v", result.Err)
+	}
+}
+
+func TestParallelConditionalRunsOnlyGuardedInBranches(t *testing.T) {
+	c := newCalls()
+	flow := NewFlow().ParallelConditional([]ConditionalBranch{
+		{Condition: holds, Functor: c.fn("in", nil)},
+		{Condition: fails, Functor: c.fn("out", failed(errTest))},
+		{Condition: holds, Functor: c.fn("also", new(Result))},
+	}).SetNote("optional")
+	if result := flow.Wait(); result.Err != nil {
+		t.Fatalf("a guarded-off branch fails the node: %v", result.Err)
+	}
+	if c.count("out") != 0 || c.count("in") != 1 || c.count("also") != 1 {
+		t.Errorf("calls %v", c.sequence())
+	}
+	if results := flow.ParallelResults("optional"); len(results) != 2 {
+		t.Errorf("%d results for 2 branches", len(results))
+	}
+}
+
+func TestParallelConditionalWithNilGuardFails(t *testing.T) {
+	result := NewFlow().ParallelConditional([]ConditionalBranch{{Condition: nil, Functor: ok}}).Wait()
+	if !errors.Is(result.Err, ErrConditionNotFound) {
+		t.Errorf("got %v", result.Err)
+	}
+}
+
+func TestParallelRunsEveryBranchDespiteAnEarlyFailure(t *testing.T) {
+	c := newCalls()
+	failedFirst := make(chan struct{})
+	early := func(*DataSet) *Result {
+		defer close(failedFirst)
+		c.record("early")
+		return failed(errTest)
+	}
+	late := func(name string) ICallable {
+		return func(*DataSet) *Result {
+			<-failedFirst
+			time.Sleep(5 * time.Millisecond)
+			c.record(name)
+			return nil
+		}
+	}
+	flow := NewFlow().Parallel(early, late("late 1"), late("late 2")).SetNote("notify")
+	result := flow.Wait()
+	if result.Err != errTest {
+		t.Fatalf("got %v", result.Err)
+	}
+	if c.count("late 1") != 1 || c.count("late 2") != 1 {
+		t.Errorf("calls %v", c.sequence())
+	}
+	if results := flow.ParallelResults("notify"); len(results) != 3 || results[0].Err != errTest {
+		t.Errorf("results %v", results)
+	}
+}
+
+func TestParallelIfStartsNothingWhenTheConditionFails(t *testing.T) {
+	c := newCalls()
+	flow := NewFlow().ParallelIf(fails, c.fn("a", failed(errTest)), c.fn("b", nil)).SetNote("fan-out").Do(c.fn("after", nil))
+	if result := flow.Wait(); result.Err != nil {
+		t.Fatal(result.Err)
+	}
+	if got := c.sequence(); len(got) != 1 || got[0] != "after" {
+		t.Errorf("calls %v", got)
+	}
+	if results := flow.ParallelResults("fan-out"); len(results) != 0 {
+		t.Errorf("results %v", results)
+	}
+}
+
+func TestParallelIfRunsTheFunctorsWhenTheConditionHolds(t *testing.T) {
+	c := newCalls()
+	result := NewFlow().ParallelIf(holds, c.fn("a", nil), c.fn("b", withStatus(3))).Wait()
+	if result.StatusCode != 3 || c.count("a") != 1 || c.count("b") != 1 {
+		t.Errorf("got %+v after %v", result, c.sequence())
+	}
+}
+
+func TestParallelIfWithNilCondition(t *testing.T) {
+	if result := NewFlow().ParallelIf(nil, ok).Wait(); !errors.Is(result.Err, ErrConditionNotFound) {
+		t.Errorf("got %v", result.Err)
+	}
+}
+
+func TestParallelGatherKeepsTheOrderOfTheFunctors(t *testing.T) {
+	thirdDone := make(chan struct{})
+	// The third functor finishes first, and the first one last
+	first := func(*DataSet) *Result {
+		<-thirdDone
+		time.Sleep(5 * time.Millisecond)
+		return withStatus(1)
+	}
+	second := func(*DataSet) *Result {
+		<-thirdDone
+		return failed(errTest)
+	}
+	third := func(*DataSet) *Result {
+		defer close(thirdDone)
+		return &Result{Err: nil, StatusCode: 0, StatusMsg: "third"}
+	}
+	flow := NewFlow().ParallelGather(first, second, third).SetNote("gather")
+	if result := flow.Wait(); !DefaultFailure(result) {
+		t.Errorf("the node doesn't fail: %+v", result)
+	}
+	gathered := flow.GatheredResults("gather")
+	if len(gathered) != 3 {
+		t.Fatalf("%d results", len(gathered))
+	}
+	if gathered[0].StatusCode != 1 || gathered[1].Err != errTest || gathered[2].StatusMsg != "third" {
+		t.Errorf("gathered %v", gathered)
+	}
+	if finished := flow.ParallelResults("gather"); finished[0].StatusMsg != "third" {
+		t.Errorf("the third functor didn't finish first: %v", finished)
+	}
+}
+
+func TestParallelDoesNotGather(t *testing.T) {
+	flow := NewFlow().Parallel(ok, fail).SetNote("plain")
+	flow.Wait()
+	if gathered := flow.GatheredResults("plain"); gathered != nil {
+		t.Errorf("gathered %v", gathered)
+	}
+}
+
+func TestParallelReduceFoldsEveryResult(t *testing.T) {
+	var mu sync.Mutex
+	calls := 0
+	highest := func(acc, next *Result) *Result {
+		mu.Lock()
+		calls++
+		mu.Unlock()
+		if next != nil && next.StatusCode > acc.StatusCode {
+			return next
+		}
+		return acc
+	}
+	result := NewFlow().ParallelReduce(highest, status(3), status(7), ok, status(5)).Wait()
+	if result.StatusCode != 7 || calls != 4 {
+		t.Errorf("%d calls end with %+v", calls, result)
+	}
+}
+
+func TestParallelReducePrefersASuccess(t *testing.T) {
+	preferSuccess := func(acc, next *Result) *Result {
+		if next != nil && next.Err == nil {
+			return next
+		}
+		if acc.Err == nil && acc.StatusMsg != "" {
+			return acc
+		}
+		return next
+	}
+	answer := func(*DataSet) *Result { return &Result{Err: nil, StatusCode: 0, StatusMsg: "answer"} }
+	result := NewFlow().ParallelReduce(preferSuccess, fail, answer, fail).Wait()
+	if result.Err != nil || result.StatusMsg != "answer" {
+		t.Errorf("got %+v", result)
+	}
+}
+
+func TestParallelErrorsByFunctor(t *testing.T) {
+	wrong := errors.New("something wrong")
+	broken := func(*DataSet) *Result { return failed(wrong) }
+	panics := func(*DataSet) *Result { panic("boom") }
+	flow := NewFlow().Parallel(ok, broken, status(3), panics).SetNote("fan-out")
+	flow.Wait()
+	errs := flow.ParallelErrors("fan-out")
+	if len(errs) != 2 || errs[1] != wrong || !errors.Is(errs[3], ErrPanicHappened) {
+		t.Errorf("errors %v", errs)
+	}
+	if flow.ParallelErrors("missing") != nil {
+		t.Error("errors for a note which isn't in the flow")
+	}
+}
+
+func TestDeterministicParallelRunsInTheOrderOfTheFunctors(t *testing.T) {
+	c := newCalls()
+	functors := make([]ICallable, 10)
+	want := make([]string, len(functors))
+	for i := range functors {
+		want[i] = strconv.Itoa(i)
+		functors[i] = c.fn(want[i], nil)
+	}
+	for run := 0; run < 5; run++ {
+		NewFlow().SetDeterministic(true).Parallel(functors...).Wait()
+	}
+	got := c.sequence()
+	for run := 0; run < 5; run++ {
+		if order := got[run*10 : run*10+10]; !reflect.DeepEqual(order, want) {
+			t.Errorf("run %d in the order %v", run, order)
+		}
+	}
+}
+
+func TestDeterministicParallelKeepsTheAggregation(t *testing.T) {
+	flow := NewFlow().SetDeterministic(true).Parallel(ok, fail, status(2)).SetNote("fan-out")
+	if result := flow.Wait(); result.Err != errTest {
+		t.Errorf("the node result isn't the first failure: %+v", result)
+	}
+	if results := flow.ParallelResults("fan-out"); len(results) != 3 || results[2].StatusCode != 2 {
+		t.Errorf("results %v", results)
+	}
+}
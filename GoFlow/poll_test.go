@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestPollUntilTheJobIsDone(t *testing.T) {
+	clock := useFakeClock(t)
+	polls := 0
+	check := func(data *DataSet) *Result {
+		polls++
+		if polls == 3 {
+			data.Name = "done"
+		}
+		return nil
+	}
+	done := func(data *DataSet) bool { return data.Name == "done" }
+	c := newCalls()
+	result := NewFlow().Poll(time.Second, time.Minute, done, check).Do(c.fn("after", nil)).Wait()
+	if result.Err != nil || polls != 3 || c.count("after") != 1 {
+		t.Errorf("%d polls end with %+v", polls, result)
+	}
+	if waited := clock.Waited(); !reflect.DeepEqual(waited, []time.Duration{time.Second, time.Second}) {
+		t.Errorf("waited %v", waited)
+	}
+}
+
+func TestPollTimesOut(t *testing.T) {
+	useFakeClock(t)
+	polls := 0
+	check := func(*DataSet) *Result {
+		polls++
+		return nil
+	}
+	result := NewFlow().Poll(time.Second, 5*time.Second, func(*DataSet) bool { return false }, check).SetNote("job").Wait()
+	if !errors.Is(result.Err, ErrNodeTimeout) {
+		t.Fatalf("got %v", result.Err)
+	}
+	if polls != 6 {
+		t.Errorf("%d polls in 5 seconds", polls)
+	}
+}
+
+func TestPollStopsAtAFailure(t *testing.T) {
+	useFakeClock(t)
+	polls := 0
+	broken := func(*DataSet) *Result {
+		polls++
+		return failed(errTest)
+	}
+	result := NewFlow().Poll(time.Second, time.Minute, func(*DataSet) bool { return false }, broken).Wait()
+	if result.Err != errTest || polls != 1 {
+		t.Errorf("%d polls end with %v", polls, result.Err)
+	}
+}
+
+func TestPollStopsWhenCancelled(t *testing.T) {
+	useFakeClock(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	polls := 0
+	check := func(*DataSet) *Result {
+		polls++
+		cancel()
+		return nil
+	}
+	result := NewFlow().Poll(time.Second, 0, func(*DataSet) bool { return false }, check).WaitContext(ctx)
+	if !errors.Is(result.Err, context.Canceled) || polls != 1 {
+		t.Errorf("%d polls end with %v", polls, result.Err)
+	}
+}
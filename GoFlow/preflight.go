@@ -0,0 +1,275 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// Validate checks the structure of the flow without running anything: ElseIf and Else must follow If or ElseIf, If,
+// ElseIf, ParallelIf and Poll must have a condition, Assert must have a check, For must loop at least once, and Split
+// must have a positive weight. The branches left out when the flow was built, since they didn't follow If or ElseIf,
+// come first. An empty slice means the flow is well-formed.
+func (f *FlowEngine) Validate() []error {
+	errs := append(make([]error, 0), f.buildErrors...)
+	for i, node := range f.nodes {
+		for _, problem := range validateNode(f.nodes, i) {
+			errs = append(errs, errors.New(nodeName(i, node)+": "+problem))
+		}
+	}
+	return errs
+}
+
+// Preflight checks that every node has at least one functor, or a provider for DoDynamic, and that none of its
+// functors, conditions or guards is nil, on top of what Validate checks, so that a misconfigured flow can be found when
+// the service starts rather than when it runs. All the problems are listed in the error.
+func (f *FlowEngine) Preflight() error {
+	problems := make([]string, 0)
+	for _, err := range f.Validate() {
+		problems = append(problems, err.Error())
+	}
+	for i, node := range f.nodes {
+		for _, problem := range preflightNode(node) {
+			problems = append(problems, nodeName(i, node)+": "+problem)
+		}
+	}
+	if len(problems) == 0 {
+		return nil
+	}
+	return errors.New("preflight failed:\n  " + strings.Join(problems, "\n  "))
+}
+
+// Strict makes the flow panic as soon as a node which Validate would complain about is added, so that the stack points
+// at the wrong call, and so does a nil functor given to any node, which is skipped otherwise. It's for tests and
+// prototypes, a flow for production had better be checked by Validate.
+func (f *FlowEngine) Strict() *FlowEngine {
+	f.strict = true
+	for _, err := range f.buildErrors {
+		panic(err)
+	}
+	for i := range f.nodes {
+		f.checkStrict(i)
+	}
+	return f
+}
+
+func (f *FlowEngine) checkStrict(index int) {
+	problems := append(validateNode(f.nodes, index), skippedFunctors(f.nodes[index])...)
+	if len(problems) != 0 {
+		panic(nodeName(index, f.nodes[index]) + ": " + strings.Join(problems, ", "))
+	}
+}
+
+func (f *FlowEngine) addBuildError(err error) {
+	if f.strict {
+		panic(err)
+	}
+	f.buildErrors = append(f.buildErrors, err)
+}
+
+func (e *ElseFlowEngine) Strict() *ElseFlowEngine {
+	e.invoker.Strict()
+	return e
+}
+
+func (e *ElseFlowEngine) Validate() []error {
+	return e.invoker.Validate()
+}
+
+func (e *ElseFlowEngine) Preflight() error {
+	return e.invoker.Preflight()
+}
+
+func nodeName(index int, node IBasicFlowNode) string {
+	name := fmt.Sprintf("node %d (%s", index, node.GetNodeType())
+	if node.GetNote() != "" {
+		name += fmt.Sprintf(" %q", node.GetNote())
+	}
+	return name + ")"
+}
+
+func validateNode(nodes []IBasicFlowNode, index int) []string {
+	switch n := nodes[index].(type) {
+	case *IfNode:
+		return nilFunctor("condition", n.Condition == nil && n.CheckedCondition == nil && !n.ByStatus)
+	case *ElseIfNode:
+		return append(danglingBranch(nodes, index), nilFunctor("condition", n.Condition == nil && n.CheckedCondition == nil)...)
+	case *ElseNode:
+		return danglingBranch(nodes, index)
+	case *ParallelNode:
+		if n.Conditional {
+			return nilFunctor("condition", n.Condition == nil)
+		}
+	case *ForNode:
+		if n.Times <= 0 {
+			return []string{fmt.Sprintf("loops %d times", n.Times)}
+		}
+	case *PollNode:
+		return nilFunctor("condition", n.Until == nil)
+	case *AssertNode:
+		return nilFunctor("check", n.Check == nil)
+	case *SplitNode:
+		if n.TotalWeight() <= 0 {
+			return []string{"no branch has a positive weight"}
+		}
+	}
+	return nil
+}
+
+func danglingBranch(nodes []IBasicFlowNode, index int) []string {
+	if conditionBefore(nodes, index) < 0 {
+		return []string{"not after If or ElseIf"}
+	}
+	return nil
+}
+
+func preflightNode(node IBasicFlowNode) []string {
+	switch n := node.(type) {
+	case *NormalNode:
+		if n.Dynamic || n.Provider != nil {
+			// The functors are only known when the node runs
+			return nilFunctor("provider", n.Provider == nil)
+		}
+		return nilFunctors("functor", n.Functors, true)
+	case *ElseNode:
+		return nilFunctors("functor", n.Functors, true)
+	case *ForNode:
+		return nilFunctors("functor", n.Functors, true)
+	case *FallbackNode:
+		return nilFunctors("functor", n.Functors, true)
+	case *RetryNode:
+		return nilFunctors("functor", n.Functors, true)
+	case *RaceNode:
+		return nilFunctors("functor", n.Functors, true)
+	case *PrevNode:
+		return nilFunctors("functor", n.Functors, true)
+	case *TapNode:
+		return nilFunctors("functor", n.Functors, true)
+	case *PollNode:
+		return nilFunctors("functor", n.Functors, true)
+	case *BreakerNode:
+		return nilFunctors("functor", n.Functors, true)
+	case *RateLimitedNode:
+		return append(nilFunctor("limiter", n.Limiter == nil), nilFunctors("functor", n.Functors, true)...)
+	case *SplitNode:
+		problems := make([]string, 0)
+		for i, branch := range n.Branches {
+			problems = append(problems, nilFunctors(fmt.Sprintf("functor of branch %d", i), branch.Functors, true)...)
+		}
+		return problems
+	case *ForEachNode:
+		return append(nilFunctor("items", n.Items == nil), nilFunctor("body", n.Body == nil)...)
+	case *PrepareNode:
+		return nilFunctors("functor", n.Functors, true)
+	case *IfNode:
+		return nilFunctors("functor", n.Functors, true)
+	case *ElseIfNode:
+		return nilFunctors("functor", n.Functors, true)
+	case *ParallelNode:
+		return append(nilFunctors("functor", n.Functors, true), nilFunctors("guard", n.Guards, false)...)
+	case *RouteNode:
+		problems := nilFunctors("default functor", n.DefaultRoute, len(n.Routes) == 0)
+		for _, code := range sortedCodes(n.Routes) {
+			problems = append(problems, nilFunctors(fmt.Sprintf("functor of route %d", code), n.Routes[code], true)...)
+		}
+		return problems
+	case *CompensableNode:
+		return nilFunctor("action", n.Action == nil)
+	case *GotoNode:
+		return nilFunctor("condition", n.Condition == nil)
+	case *TimeoutFallbackNode:
+		return append(nilFunctor("primary", n.Primary == nil), nilFunctor("fallback", n.Fallback == nil)...)
+	}
+	return nil
+}
+
+// skippedFunctors lists the nil functors of the nodes which skip them when they run.
+func skippedFunctors(node IBasicFlowNode) []string {
+	switch n := node.(type) {
+	case *NormalNode:
+		return nilFunctors("functor", n.Functors, false)
+	case *IfNode:
+		return nilFunctors("functor", n.Functors, false)
+	case *ElseIfNode:
+		return nilFunctors("functor", n.Functors, false)
+	case *ElseNode:
+		return nilFunctors("functor", n.Functors, false)
+	case *ForNode:
+		return nilFunctors("functor", n.Functors, false)
+	case *ParallelNode:
+		return nilFunctors("functor", n.Functors, false)
+	case *FallbackNode:
+		return nilFunctors("functor", n.Functors, false)
+	case *RetryNode:
+		return nilFunctors("functor", n.Functors, false)
+	case *RaceNode:
+		return nilFunctors("functor", n.Functors, false)
+	case *PrevNode:
+		return nilFunctors("functor", n.Functors, false)
+	case *TapNode:
+		return nilFunctors("functor", n.Functors, false)
+	case *PollNode:
+		return nilFunctors("functor", n.Functors, false)
+	case *BreakerNode:
+		return nilFunctors("functor", n.Functors, false)
+	case *RateLimitedNode:
+		return nilFunctors("functor", n.Functors, false)
+	case *PrepareNode:
+		return nilFunctors("functor", n.Functors, false)
+	case *SplitNode:
+		problems := make([]string, 0)
+		for i, branch := range n.Branches {
+			problems = append(problems, nilFunctors(fmt.Sprintf("functor of branch %d", i), branch.Functors, false)...)
+		}
+		return problems
+	case *RouteNode:
+		problems := nilFunctors("default functor", n.DefaultRoute, false)
+		for _, code := range sortedCodes(n.Routes) {
+			problems = append(problems, nilFunctors(fmt.Sprintf("functor of route %d", code), n.Routes[code], false)...)
+		}
+		return problems
+	case *ForEachNode:
+		return nilFunctor("body", n.Body == nil)
+	case *CompensableNode:
+		return nilFunctor("action", n.Action == nil)
+	case *TimeoutFallbackNode:
+		return append(nilFunctor("primary", n.Primary == nil), nilFunctor("fallback", n.Fallback == nil)...)
+	}
+	return nil
+}
+
+func sortedCodes(routes map[int64][]ICallable) []int64 {
+	codes := make([]int64, 0, len(routes))
+	for code := range routes {
+		codes = append(codes, code)
+	}
+	sort.Slice(codes, func(i, j int) bool { return codes[i] < codes[j] })
+	return codes
+}
+
+func nilFunctor(kind string, isNil bool) []string {
+	if isNil {
+		return []string{kind + " is nil"}
+	}
+	return nil
+}
+
+// nilFunctors lists the nil functions in the slice, and reports an empty slice if required is true.
+func nilFunctors(kind string, functors interface{}, required bool) []string {
+	value := reflect.ValueOf(functors)
+	if value.Len() == 0 {
+		if required {
+			return []string{"no " + kind}
+		}
+		return nil
+	}
+	problems := make([]string, 0)
+	for i := 0; i < value.Len(); i++ {
+		if value.Index(i).IsNil() {
+			problems = append(problems, fmt.Sprintf("%s %d is nil", kind, i))
+		}
+	}
+	return problems
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestPreflightPinpointsANilFunctor(t *testing.T) {
+	var missing ICallable
+	flow := NewFlow().Do(ok).SetNote("load").Do(ok, missing).SetNote("save")
+	err := flow.Preflight()
+	if err == nil {
+		t.Fatal("a nil functor passes preflight")
+	}
+	if !strings.Contains(err.Error(), `node 1 (`) || !strings.Contains(err.Error(), `"save"): functor 1 is nil`) {
+		t.Errorf("got %v", err)
+	}
+	if strings.Contains(err.Error(), "load") {
+		t.Errorf("a good node is listed: %v", err)
+	}
+}
+
+func TestPreflightListsEveryProblem(t *testing.T) {
+	flow := NewFlow().If(nil, ok).Else(nil).Parallel()
+	err := flow.Preflight()
+	if err == nil {
+		t.Fatal("passes preflight")
+	}
+	for _, problem := range []string{"condition is nil", "functor 0 is nil", "no functor"} {
+		if !strings.Contains(err.Error(), problem) {
+			t.Errorf("%q isn't in %v", problem, err)
+		}
+	}
+}
+
+func TestPreflightOfAGoodFlow(t *testing.T) {
+	if err := NewFlow().Do(ok).If(holds, ok).Else(ok).Preflight(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestValidateFindsStructuralProblems(t *testing.T) {
+	called := false
+	condition := func(*DataSet) bool {
+		called = true
+		return true
+	}
+	flow := NewFlow().If(nil, ok).ElseIf(condition, ok).Else(ok).For(0, ok)
+	errs := flow.Validate()
+	if called {
+		t.Error("Validate calls a condition")
+	}
+	if len(errs) != 2 {
+		t.Fatalf("errors %v", errs)
+	}
+	if !strings.Contains(errs[0].Error(), "node 0 (If): condition is nil") || !strings.Contains(errs[1].Error(), "loops 0 times") {
+		t.Errorf("errors %v", errs)
+	}
+}
+
+func TestValidateOfAWellFormedFlow(t *testing.T) {
+	if errs := NewFlow().Do(ok).If(holds, ok).ElseIf(fails, ok).Else(ok).For(2, ok).Validate(); len(errs) != 0 {
+		t.Errorf("errors %v", errs)
+	}
+}
+
+func TestElseAfterAnInterveningDoIsReported(t *testing.T) {
+	c := newCalls()
+	branch := NewFlow().If(fails, c.fn("then", nil))
+	branch.Do(c.fn("between", nil))
+	flow := branch.Else(c.fn("else", nil))
+	errs := flow.Validate()
+	if len(errs) != 1 || !strings.Contains(errs[0].Error(), "Else after node 1 (Normal) is left out") {
+		t.Fatalf("errors %v", errs)
+	}
+	flow.Wait()
+	if c.count("else") != 0 || c.count("between") != 1 || len(flow.nodes) != 2 {
+		t.Errorf("calls %v", c.sequence())
+	}
+}
+
+func TestStrictPanicsOnADanglingElse(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("no panic")
+		}
+	}()
+	branch := NewFlow().Strict().If(holds, ok)
+	branch.Do(ok)
+	branch.ElseIf(holds, ok)
+}
+
+func TestStrictPanicsAtTheWrongCall(t *testing.T) {
+	mustPanic := func(name string, build func()) {
+		defer func() {
+			if recover() == nil {
+				t.Errorf("%s doesn't panic", name)
+			}
+		}()
+		build()
+	}
+	mustPanic("a nil condition", func() { NewFlow().Strict().If(nil, ok) })
+	mustPanic("a nil functor", func() { NewFlow().Strict().Do(ok, nil) })
+	mustPanic("a flow made strict after the mistake", func() { NewFlow().Do(nil).Strict() })
+}
+
+func TestNotStrictDefersTheMistakesToRuntime(t *testing.T) {
+	flow := NewFlow().If(nil, ok)
+	if errs := flow.Validate(); len(errs) != 1 {
+		t.Errorf("errors %v", errs)
+	}
+	if result := flow.Wait(); !errors.Is(result.Err, ErrConditionNotFound) {
+		t.Errorf("got %v", result.Err)
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestPrepareBetweenNodesFillsTheSharedData(t *testing.T) {
+	var seen []string
+	look := func(data *DataSet) *Result {
+		seen = append(seen, data.Name)
+		return nil
+	}
+	fill := func(data *DataSet, input InputParam) *Result {
+		data.Ctx = input.Ctx
+		data.Name = "prepared"
+		return nil
+	}
+	flow := NewFlow().Do(look).Prepare(InputParam{Ctx: context.Background()}, fill).Do(look)
+	if result := flow.Wait(); result.Err != nil {
+		t.Fatal(result.Err)
+	}
+	if !reflect.DeepEqual(seen, []string{"", "prepared"}) {
+		t.Errorf("the nodes saw %v", seen)
+	}
+	if flow.data.Name != "prepared" || flow.data.Ctx == nil {
+		t.Errorf("the data of the flow is %+v", flow.data)
+	}
+}
+
+func TestFailedPrepareStopsTheFlow(t *testing.T) {
+	c := newCalls()
+	reject := func(*DataSet, InputParam) *Result { return failed(errTest) }
+	result := NewFlow().Prepare(InputParam{}, reject).Do(c.fn("after", nil)).Wait()
+	if result.Err != errTest || c.count("after") != 0 {
+		t.Errorf("got %v", result.Err)
+	}
+}
+
+func TestPrepareInsideAnIfKeepsItOpen(t *testing.T) {
+	fill := func(data *DataSet, _ InputParam) *Result {
+		data.Name = "prepared"
+		return nil
+	}
+	prepared := func(data *DataSet) bool { return data.Name == "prepared" }
+	for _, test := range []struct {
+		ifMatches bool
+		want      []string
+	}{
+		{true, []string{"if", "after"}},
+		{false, []string{"else if", "after"}},
+	} {
+		c := newCalls()
+		flow := NewFlow().
+			If(func(*DataSet) bool { return test.ifMatches }, c.fn("if", nil)).
+			Prepare(InputParam{}, fill).
+			ElseIf(prepared, c.fn("else if", nil)).
+			Else(c.fn("else", nil)).
+			Do(c.fn("after", nil))
+		if result := flow.Wait(); result.Err != nil {
+			t.Fatal(result.Err)
+		}
+		if got := c.sequence(); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("calls %v when the If is %v", got, test.ifMatches)
+		}
+		if (flow.data.Name == "prepared") == test.ifMatches {
+			t.Errorf("the data is %q when the If is %v", flow.data.Name, test.ifMatches)
+		}
+	}
+}
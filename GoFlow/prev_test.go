@@ -0,0 +1,40 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestDoWithPrevSeesTheResultSoFar(t *testing.T) {
+	var seen []int64
+	branch := func(data *DataSet, prev *Result) *Result {
+		seen = append(seen, prev.StatusCode)
+		return nil
+	}
+	onlyErrors := func(result *Result) bool { return result != nil && result.Err != nil }
+	// A 404 isn't a failure here, and the Parallel node keeps it as the result
+	NewFlow().SetFailurePredicate(onlyErrors).
+		Parallel(status(404)).
+		DoWithPrev(branch).
+		Wait()
+	if len(seen) != 1 || seen[0] != 404 {
+		t.Errorf("saw %v", seen)
+	}
+}
+
+func TestDoWithPrevRunsAfterASuccess(t *testing.T) {
+	c := newCalls()
+	result := NewFlow().
+		Do(ok).
+		DoWithPrev(func(data *DataSet, prev *Result) *Result {
+			c.record("prev")
+			if prev.StatusCode != 0 || prev.Err != nil {
+				return withStatus(1)
+			}
+			return withStatus(2)
+		}).
+		Do(c.fn("after", nil)).
+		Wait()
+	if result.StatusCode != 2 || c.count("prev") != 1 || c.count("after") != 0 {
+		t.Errorf("got %+v after %v", result, c.sequence())
+	}
+}
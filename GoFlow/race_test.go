@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+)
+
+func TestRaceTakesTheFastSuccess(t *testing.T) {
+	var stopped sync.WaitGroup
+	stopped.Add(2)
+	slow := func(data *DataSet) *Result {
+		defer stopped.Done()
+		<-data.Ctx.Done()
+		return failed(data.Ctx.Err())
+	}
+	fast := func(data *DataSet) *Result {
+		data.Name = "fast"
+		return &Result{Err: nil, StatusCode: 0, StatusMsg: "fast"}
+	}
+	flow := NewFlow().Race(slow, fast, slow)
+	flow.data.Ctx = context.Background()
+	result := flow.Wait()
+	if result.StatusMsg != "fast" || result.Err != nil {
+		t.Errorf("got %+v", result)
+	}
+	if flow.data.Name != "fast" || flow.data.Ctx != context.Background() {
+		t.Errorf("the data is %+v", flow.data)
+	}
+	// The slow ones are told to stop, or this never returns
+	stopped.Wait()
+}
+
+func TestRaceEndsWithTheLastFailureIfNoneSucceeds(t *testing.T) {
+	first := make(chan struct{})
+	early := func(*DataSet) *Result {
+		defer close(first)
+		return withStatus(1)
+	}
+	late := func(*DataSet) *Result {
+		<-first
+		return withStatus(2)
+	}
+	if result := NewFlow().Race(early, late).Wait(); result.StatusCode != 2 {
+		t.Errorf("got %+v", result)
+	}
+}
+
+func TestRaceRecoversPanics(t *testing.T) {
+	panics := func(*DataSet) *Result { panic("boom") }
+	if result := NewFlow().Race(panics, panics).Wait(); !errors.Is(result.Err, ErrPanicHappened) {
+		t.Errorf("got %v", result.Err)
+	}
+}
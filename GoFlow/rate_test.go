@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// intervalLimiter lets one run through every interval, like a rate.Limiter with a burst of 1.
+type intervalLimiter struct {
+	mu       sync.Mutex
+	interval time.Duration
+	next     time.Time
+}
+
+func (l *intervalLimiter) Wait(ctx context.Context) error {
+	l.mu.Lock()
+	now := time.Now()
+	at := l.next
+	if at.Before(now) {
+		at = now
+	}
+	l.next = at.Add(l.interval)
+	l.mu.Unlock()
+	select {
+	case <-time.After(at.Sub(now)):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func TestRateLimitedSpacesOutConcurrentFlows(t *testing.T) {
+	const interval = 20 * time.Millisecond
+	limiter := &intervalLimiter{interval: interval}
+	var mu sync.Mutex
+	var started []time.Time
+	call := func(*DataSet) *Result {
+		mu.Lock()
+		started = append(started, time.Now())
+		mu.Unlock()
+		return nil
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if result := NewFlow().RateLimited(limiter, call).Wait(); result.Err != nil {
+				t.Error(result.Err)
+			}
+		}()
+	}
+	wg.Wait()
+	if len(started) != 2 {
+		t.Fatalf("%d calls", len(started))
+	}
+	gap := started[1].Sub(started[0])
+	if gap < 0 {
+		gap = -gap
+	}
+	if gap < interval-2*time.Millisecond {
+		t.Errorf("the calls are %v apart", gap)
+	}
+}
+
+// blockedLimiter never lets a run through.
+type blockedLimiter struct{}
+
+func (blockedLimiter) Wait(ctx context.Context) error {
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func TestRateLimitedAbortsWhenCancelledWhileWaiting(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	c := newCalls()
+	flow := NewFlow().RateLimited(blockedLimiter{}, c.fn("call", nil))
+	flow.data.Ctx = ctx
+	result := flow.Wait()
+	if !errors.Is(result.Err, context.DeadlineExceeded) || c.count("call") != 0 {
+		t.Errorf("got %v after %v", result.Err, c.sequence())
+	}
+}
+
+// refusingLimiter refuses every run.
+type refusingLimiter struct{}
+
+func (refusingLimiter) Wait(context.Context) error {
+	return errTest
+}
+
+func TestRateLimitedFailsWithTheErrorOfTheLimiter(t *testing.T) {
+	c := newCalls()
+	result := NewFlow().RateLimited(refusingLimiter{}, c.fn("call", nil)).Wait()
+	if result.Err != errTest || c.count("call") != 0 {
+		t.Errorf("got %v after %v", result.Err, c.sequence())
+	}
+}
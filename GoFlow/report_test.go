@@ -0,0 +1,66 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestReportOfAMixedRun(t *testing.T) {
+	flow := NewFlow().SetName("order").
+		Do(ok).SetNote("load").
+		If(fails, ok).SetNote("cached").
+		ElseIf(holds, setName("fresh")).SetNote("fetch").
+		Else(ok).SetNote("default").
+		Do(status(7)).SetNote("charge").
+		Do(ok).SetNote("ship")
+	result := flow.Wait()
+	report := flow.Report()
+
+	if report.FlowName != "order" || report.ExecutionID == "" || report.Duration < 0 {
+		t.Errorf("report header %+v", report)
+	}
+	if len(report.Nodes) != 6 {
+		t.Fatalf("%d traces", len(report.Nodes))
+	}
+	if matched := report.Nodes[1].Matched; matched == nil || *matched {
+		t.Error("the If is recorded as matched")
+	}
+	if matched := report.Nodes[2].Matched; matched == nil || !*matched {
+		t.Error("the ElseIf isn't recorded as matched")
+	}
+	var skipped []string
+	for _, trace := range report.Skipped {
+		skipped = append(skipped, trace.Note)
+	}
+	if len(skipped) != 2 || skipped[0] != "default" || skipped[1] != "ship" {
+		t.Errorf("skipped %v", skipped)
+	}
+	if report.FailedNode == nil || report.FailedNode.Note != "charge" {
+		t.Errorf("failed node %+v", report.FailedNode)
+	}
+	if report.Result == nil || report.Result.StatusCode != result.StatusCode {
+		t.Errorf("final result %+v", report.Result)
+	}
+	if _, err := json.Marshal(report); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestReportHasNoFailedNodeAfterRecovery(t *testing.T) {
+	flow := NewFlow().Do(fail).SetNote("broken").Fallback(ok).SetNote("fallback")
+	flow.Wait()
+	if report := flow.Report(); report.FailedNode != nil || report.Error != "" {
+		t.Errorf("a recovered failure is reported: %+v", report.FailedNode)
+	}
+}
+
+func TestResultByNote(t *testing.T) {
+	flow := NewFlow().Do(status(3)).SetNote("first")
+	flow.Wait()
+	if result, found := flow.ResultByNote("first"); !found || result.StatusCode != 3 {
+		t.Errorf("got %+v", result)
+	}
+	if _, found := flow.ResultByNote("missing"); found {
+		t.Error("found a note which isn't in the flow")
+	}
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestResetRerunsAFixedFlow(t *testing.T) {
+	c := newCalls()
+	check := func(data *DataSet) *Result {
+		if data.Name == "" {
+			return withStatus(400)
+		}
+		return nil
+	}
+	flow := NewFlow().
+		Do(check).
+		If(holds, c.fn("then", nil)).
+		Else(c.fn("else", nil))
+	if result := flow.Wait(); result.StatusCode != 400 {
+		t.Fatalf("got %+v", result)
+	}
+
+	flow.data.Name = "fixed"
+	result := flow.Reset().Wait()
+	if result.StatusCode != 0 || result.Err != nil {
+		t.Fatalf("got %+v after the reset", result)
+	}
+	if c.count("then") != 1 || c.count("else") != 0 {
+		t.Errorf("calls %v", c.sequence())
+	}
+}
+
+func TestResetKeepsTheData(t *testing.T) {
+	flow := NewFlow().Do(setName("Tom")).Do(fail)
+	flow.Wait()
+	flow.Reset()
+	if (*flow.result).Err != nil || flow.data.Name != "Tom" {
+		t.Errorf("the result is %+v and the data %+v", *flow.result, flow.data)
+	}
+	for _, node := range flow.nodes {
+		if node.GetShouldSkip() {
+			t.Error("a node is still skipped")
+		}
+	}
+}
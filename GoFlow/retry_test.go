@@ -0,0 +1,215 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestBeforeRetryRunsBetweenAttempts(t *testing.T) {
+	clock := useFakeClock(t)
+	refreshes, attempts := 0, 0
+	var tokens []string
+	refresh := func(data *DataSet) *DataSet {
+		refreshes++
+		return &DataSet{Ctx: data.Ctx, Name: "token" + string(rune('0'+refreshes))}
+	}
+	call := func(data *DataSet) *Result {
+		attempts++
+		tokens = append(tokens, data.Name)
+		return failed(errTest)
+	}
+	flow := NewFlow().RetryWithRefresh(3, 10*time.Millisecond, refresh, call)
+	if result := flow.Wait(); result.Err != errTest {
+		t.Fatalf("got %v", result.Err)
+	}
+	if attempts != 3 || refreshes != 2 {
+		t.Errorf("%d attempts and %d refreshes", attempts, refreshes)
+	}
+	if !reflect.DeepEqual(tokens, []string{"", "token1", "token2"}) {
+		t.Errorf("the retried functor saw %v", tokens)
+	}
+	if waited := clock.Waited(); !reflect.DeepEqual(waited, []time.Duration{10 * time.Millisecond, 20 * time.Millisecond}) {
+		t.Errorf("backed off %v", waited)
+	}
+}
+
+func TestBeforeRetryNotCalledOnSuccess(t *testing.T) {
+	useFakeClock(t)
+	refreshes := 0
+	refresh := func(data *DataSet) *DataSet {
+		refreshes++
+		return data
+	}
+	if result := NewFlow().RetryWithRefresh(3, time.Second, refresh, ok).Wait(); result.Err != nil {
+		t.Fatal(result.Err)
+	}
+	if refreshes != 0 {
+		t.Errorf("refreshed %d times before the first attempt", refreshes)
+	}
+}
+
+func TestSetBeforeRetryOnTheLastRetry(t *testing.T) {
+	useFakeClock(t)
+	calls := 0
+	flaky := func(*DataSet) *Result {
+		calls++
+		if calls < 2 {
+			return failed(errTest)
+		}
+		return nil
+	}
+	flow := NewFlow().Retry(3, time.Second, flaky).SetBeforeRetry(func(data *DataSet) *DataSet {
+		data.Name = "refreshed"
+		return data
+	})
+	if result := flow.Wait(); result.Err != nil {
+		t.Fatal(result.Err)
+	}
+	if flow.data.Name != "refreshed" || calls != 2 {
+		t.Errorf("called %d times, data %q", calls, flow.data.Name)
+	}
+}
+
+func TestDoWithVersionCheckRetriesAConflict(t *testing.T) {
+	useFakeClock(t)
+	version, attempts := 1, 0
+	save := func(*DataSet) *Result {
+		attempts++
+		if attempts == 1 {
+			// Someone else has written in the meantime
+			version++
+			return withStatus(409)
+		}
+		return nil
+	}
+	result := NewFlow().DoWithVersionCheck(func(*DataSet) int { return version }, save).Wait()
+	if result.StatusCode != 0 || attempts != 2 {
+		t.Errorf("%d attempts end with %+v", attempts, result)
+	}
+}
+
+func TestDoWithVersionCheckDoesNotRetryOtherFailures(t *testing.T) {
+	useFakeClock(t)
+	attempts := 0
+	save := func(*DataSet) *Result {
+		attempts++
+		return failed(errTest)
+	}
+	result := NewFlow().DoWithVersionCheck(func(*DataSet) int { return 1 }, save).Wait()
+	if result.Err != errTest || attempts != 1 {
+		t.Errorf("%d attempts end with %v", attempts, result.Err)
+	}
+}
+
+func TestSetConflictPredicate(t *testing.T) {
+	useFakeClock(t)
+	attempts := 0
+	save := func(*DataSet) *Result {
+		attempts++
+		return withStatus(409)
+	}
+	conflict := func(expected int, data *DataSet, result *Result) bool {
+		return result.StatusCode == 409
+	}
+	NewFlow().DoWithVersionCheck(func(*DataSet) int { return 1 }, save).SetConflictPredicate(conflict).Wait()
+	if attempts != DefaultVersionCheckAttempts {
+		t.Errorf("%d attempts", attempts)
+	}
+}
+
+func TestRetrySucceedsOnTheThirdAttempt(t *testing.T) {
+	clock := useFakeClock(t)
+	attempts := 0
+	flaky := func(*DataSet) *Result {
+		attempts++
+		if attempts <= 2 {
+			return withStatus(503)
+		}
+		return new(Result)
+	}
+	c := newCalls()
+	result := NewFlow().Retry(5, 10*time.Millisecond, flaky).Do(c.fn("after", nil)).Wait()
+	if result.StatusCode != 0 || result.Err != nil || attempts != 3 {
+		t.Errorf("%d attempts end with %+v", attempts, result)
+	}
+	if c.count("after") != 1 {
+		t.Error("the flow doesn't go on after the retries")
+	}
+	if waited := clock.Waited(); !reflect.DeepEqual(waited, []time.Duration{10 * time.Millisecond, 20 * time.Millisecond}) {
+		t.Errorf("backed off %v", waited)
+	}
+}
+
+func TestRetryPropagatesTheLastFailure(t *testing.T) {
+	useFakeClock(t)
+	attempts := 0
+	broken := func(*DataSet) *Result {
+		attempts++
+		return failed(errTest)
+	}
+	c := newCalls()
+	result := NewFlow().Retry(3, time.Millisecond, broken).Do(c.fn("after", nil)).Wait()
+	if result.Err != errTest || attempts != 3 || c.count("after") != 0 {
+		t.Errorf("%d attempts end with %v", attempts, result.Err)
+	}
+}
+
+func TestRetryStopsWhenCancelledBetweenAttempts(t *testing.T) {
+	useFakeClock(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	attempts := 0
+	broken := func(*DataSet) *Result {
+		attempts++
+		cancel()
+		return failed(errTest)
+	}
+	flow := NewFlow().Retry(5, time.Millisecond, broken)
+	flow.data.Ctx = ctx
+	if result := flow.Wait(); !errors.Is(result.Err, context.Canceled) || attempts != 1 {
+		t.Errorf("%d attempts end with %v", attempts, result.Err)
+	}
+}
+
+var errTransient = errors.New("transient")
+
+func transient(result *Result) bool {
+	return errors.Is(result.Err, errTransient)
+}
+
+func TestRetryIfDoesNotRetryAPermanentFailure(t *testing.T) {
+	clock := useFakeClock(t)
+	attempts := 0
+	invalid := func(*DataSet) *Result {
+		attempts++
+		return failed(errTest)
+	}
+	result := NewFlow().RetryIf(5, time.Second, transient, invalid).Wait()
+	if result.Err != errTest || attempts != 1 {
+		t.Errorf("%d attempts end with %v", attempts, result.Err)
+	}
+	if waited := clock.Waited(); len(waited) != 0 {
+		t.Errorf("backed off %v", waited)
+	}
+}
+
+func TestRetryIfRetriesATransientFailure(t *testing.T) {
+	useFakeClock(t)
+	attempts := 0
+	flaky := func(*DataSet) *Result {
+		attempts++
+		switch attempts {
+		case 1, 2:
+			return failed(errTransient)
+		case 3:
+			return failed(errTest)
+		}
+		return nil
+	}
+	result := NewFlow().RetryIf(5, time.Second, transient, flaky).Wait()
+	if result.Err != errTest || attempts != 3 {
+		t.Errorf("%d attempts end with %v", attempts, result.Err)
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestReturnEarlyEndsAsASuccess(t *testing.T) {
+	c := newCalls()
+	result := NewFlow().
+		Do(c.fn("first", nil)).
+		Do(func(*DataSet) *Result { return ReturnEarly() }).
+		Do(c.fn("skipped", nil)).
+		OnSuccess(func(*DataSet, *Result) { c.record("success") }).
+		OnFail(func(*DataSet, *Result) { c.record("fail") }).
+		Wait()
+	if result.Err != nil {
+		t.Fatalf("got %v", result.Err)
+	}
+	if got := c.sequence(); !reflect.DeepEqual(got, []string{"first", "success"}) {
+		t.Errorf("calls %v", got)
+	}
+}
+
+func TestReturnNodeEndsTheFlowUnlessItFails(t *testing.T) {
+	c := newCalls()
+	if result := NewFlow().Return(c.fn("return", nil)).Do(c.fn("skipped", nil)).Wait(); result.Err != nil {
+		t.Fatalf("got %v", result.Err)
+	}
+	if result := NewFlow().Return(fail).Do(c.fn("skipped", nil)).Wait(); result.Err != errTest {
+		t.Errorf("got %v", result.Err)
+	}
+	if c.count("return") != 1 || c.count("skipped") != 0 {
+		t.Errorf("calls %v", c.sequence())
+	}
+}
+
+func TestReturnEarlyIsNotAFailure(t *testing.T) {
+	breaker := "return-" + t.Name()
+	for name, build := range map[string]func(flow *FlowEngine, done ICallable) *FlowEngine{
+		"Retry": func(flow *FlowEngine, done ICallable) *FlowEngine { return flow.Retry(3, time.Millisecond, done) },
+		"DoAll": func(flow *FlowEngine, done ICallable) *FlowEngine { return flow.DoAll(done, ok) },
+		"DoWithFallback": func(flow *FlowEngine, done ICallable) *FlowEngine {
+			return flow.DoWithFallback(time.Second, done, fail)
+		},
+		"Breaker": func(flow *FlowEngine, done ICallable) *FlowEngine {
+			return flow.Breaker(breaker, BreakerConfig{FailureThreshold: 1, Cooldown: time.Hour}, done)
+		},
+		"DoWithCompensation": func(flow *FlowEngine, done ICallable) *FlowEngine {
+			return flow.DoWithCompensation(done, ok)
+		},
+	} {
+		c := newCalls()
+		done := func(*DataSet) *Result {
+			c.record("done")
+			return ReturnEarly()
+		}
+		flow := build(NewFlow(), done).Do(c.fn("skipped", nil)).
+			OnSuccess(func(*DataSet, *Result) { c.record("success") })
+		if result := flow.Wait(); result.Err != nil {
+			t.Errorf("%s: got %v", name, result.Err)
+		}
+		if got := c.sequence(); !reflect.DeepEqual(got, []string{"done", "success"}) {
+			t.Errorf("%s: calls %v", name, got)
+		}
+	}
+	if state := GetBreaker(breaker).State(); state != BreakerClosed {
+		t.Errorf("the return opens the breaker: %v", state)
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDoAfterWaitIsRejected(t *testing.T) {
+	c := newCalls()
+	flow := NewFlow().Do(c.fn("first", nil))
+	flow.Wait()
+	flow.Do(c.fn("late", nil))
+	if len(flow.nodes) != 1 {
+		t.Fatalf("%d nodes", len(flow.nodes))
+	}
+	errs := flow.Validate()
+	if len(errs) != 1 || !strings.Contains(errs[0].Error(), "added after Wait") {
+		t.Errorf("errors %v", errs)
+	}
+	flow.Reset().Wait()
+	if c.count("late") != 0 {
+		t.Errorf("calls %v", c.sequence())
+	}
+}
+
+func TestStrictPanicsOnANodeAddedAfterWait(t *testing.T) {
+	flow := NewFlow().Strict().Do(ok)
+	flow.Wait()
+	defer func() {
+		if recover() == nil {
+			t.Error("no panic")
+		}
+	}()
+	flow.If(holds, ok)
+}
+
+func TestNodesCanBeAddedAfterReset(t *testing.T) {
+	c := newCalls()
+	flow := NewFlow().Do(c.fn("first", nil))
+	flow.Wait()
+	flow.Reset().Do(c.fn("second", nil)).Wait()
+	if c.count("first") != 2 || c.count("second") != 1 {
+		t.Errorf("calls %v", c.sequence())
+	}
+}
+
+func TestMaxNodesRejectsTheNodeBeyondIt(t *testing.T) {
+	c := newCalls()
+	flow := NewFlow().SetMaxNodes(2).Do(c.fn("first", nil)).Do(c.fn("second", nil)).Do(c.fn("third", nil))
+	if len(flow.nodes) != 2 {
+		t.Fatalf("%d nodes", len(flow.nodes))
+	}
+	errs := flow.Validate()
+	if len(errs) != 1 || !strings.Contains(errs[0].Error(), "can't have more than 2 nodes") {
+		t.Errorf("errors %v", errs)
+	}
+	flow.Wait()
+	if c.count("third") != 0 || c.count("second") != 1 {
+		t.Errorf("calls %v", c.sequence())
+	}
+}
+
+func TestMaxNodesPanicsInStrictMode(t *testing.T) {
+	flow := NewFlow().Strict().SetMaxNodes(1).Do(ok)
+	defer func() {
+		if recover() == nil {
+			t.Error("no panic")
+		}
+	}()
+	flow.Do(ok)
+}
+
+func TestNoMaxNodesByDefault(t *testing.T) {
+	flow := NewFlow()
+	for i := 0; i < 1000; i++ {
+		flow.Do(ok)
+	}
+	if len(flow.nodes) != 1000 || len(flow.Validate()) != 0 {
+		t.Errorf("%d nodes", len(flow.nodes))
+	}
+}
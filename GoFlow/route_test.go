@@ -0,0 +1,89 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRouteByCode(t *testing.T) {
+	cases := []struct {
+		code  int64
+		route string
+	}{
+		{0, "ok"},
+		{404, "missing"},
+		{500, "broken"},
+		{418, "default"},
+	}
+	for _, c := range cases {
+		calls := newCalls()
+		routes := map[int64][]ICallable{
+			0:   {calls.fn("ok", nil)},
+			404: {calls.fn("missing", nil)},
+			500: {calls.fn("broken", withStatus(500))},
+		}
+		result := NewFlow().Do(status(c.code)).RouteByCode(routes, []ICallable{calls.fn("default", nil)}).Wait()
+		if seq := calls.sequence(); len(seq) != 1 || seq[0] != c.route {
+			t.Errorf("code %d routed to %v", c.code, seq)
+		}
+		if c.route == "broken" {
+			if result.StatusCode != 500 {
+				t.Errorf("the route's failure is lost: %+v", result)
+			}
+		} else if result.StatusCode != 0 {
+			t.Errorf("code %d isn't cleared by its route: %+v", c.code, result)
+		}
+	}
+}
+
+func TestRouteByCodeWithoutDefaultKeepsTheResult(t *testing.T) {
+	result := NewFlow().Do(status(7)).RouteByCode(map[int64][]ICallable{0: {ok}}, nil).Wait()
+	if result.StatusCode != 7 {
+		t.Errorf("got %+v", result)
+	}
+}
+
+func TestRouteByCodeDoesNotRouteAnError(t *testing.T) {
+	calls := newCalls()
+	result := NewFlow().Do(fail).RouteByCode(nil, []ICallable{calls.fn("default", nil)}).Wait()
+	if result.Err != errTest || calls.count("default") != 0 {
+		t.Errorf("got %+v", result)
+	}
+}
+
+func TestIfStatusHandlesTheStatusAndClearsIt(t *testing.T) {
+	c := newCalls()
+	result := NewFlow().
+		Do(status(10000)).
+		IfStatus(10000, c.fn("handler", nil)).
+		Else(c.fn("else", nil)).
+		Do(c.fn("after", nil)).
+		Wait()
+	if result.StatusCode != 0 || result.Err != nil {
+		t.Errorf("got %+v", result)
+	}
+	if got := c.sequence(); !reflect.DeepEqual(got, []string{"handler", "after"}) {
+		t.Errorf("calls %v", got)
+	}
+}
+
+func TestIfStatusLeavesAnotherStatus(t *testing.T) {
+	c := newCalls()
+	result := NewFlow().
+		Do(status(500)).
+		IfStatus(10000, c.fn("handler", nil)).
+		ElseIf(holds, c.fn("else if", nil)).
+		Do(c.fn("after", nil)).
+		Wait()
+	if result.StatusCode != 500 || len(c.sequence()) != 0 {
+		t.Errorf("got %+v after %v", result, c.sequence())
+	}
+}
+
+func TestIfStatusOfASuccess(t *testing.T) {
+	c := newCalls()
+	NewFlow().Do(ok).IfStatus(0, c.fn("zero", nil)).Else(c.fn("else", nil)).Wait()
+	if got := c.sequence(); !reflect.DeepEqual(got, []string{"zero"}) {
+		t.Errorf("calls %v", got)
+	}
+}
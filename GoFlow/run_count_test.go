@@ -0,0 +1,50 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRunCountOfALoop(t *testing.T) {
+	clock := useFakeClock(t)
+	iterations := 0
+	count := func(*DataSet) *Result {
+		iterations++
+		return nil
+	}
+	flow := NewFlow().For(3, count).If(holds, ok).Else(ok)
+	if node := flow.nodes[0]; node.GetRunCount() != 0 || !node.GetLastRun().IsZero() {
+		t.Fatalf("ran %d times before Wait", node.GetRunCount())
+	}
+	flow.Wait()
+	first := flow.nodes[0].GetLastRun()
+	clock.Advance(time.Minute)
+	flow.Reset().Wait()
+	loop := flow.nodes[0]
+	if iterations != 6 || loop.GetRunCount() != 2 {
+		t.Errorf("%d runs for %d iterations", loop.GetRunCount(), iterations)
+	}
+	if got := loop.GetLastRun(); got.Sub(first) != time.Minute {
+		t.Errorf("last ran at %v after %v", got, first)
+	}
+	if then := flow.nodes[1]; then.GetRunCount() != 2 {
+		t.Errorf("the If ran %d times", then.GetRunCount())
+	}
+	if skipped := flow.nodes[2]; skipped.GetRunCount() != 0 {
+		t.Errorf("the skipped Else ran %d times", skipped.GetRunCount())
+	}
+}
+
+func TestRunCountOfAGotoBack(t *testing.T) {
+	loops := 0
+	flow := NewFlow().
+		Do(func(*DataSet) *Result {
+			loops++
+			return nil
+		}).SetNote("start").
+		Goto("start", func(*DataSet) bool { return loops < 3 })
+	flow.Wait()
+	if count := flow.nodes[0].GetRunCount(); count != 3 {
+		t.Errorf("ran %d times", count)
+	}
+}
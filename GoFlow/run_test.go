@@ -0,0 +1,58 @@
+package main
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRunTurnsAStatusIntoAnError(t *testing.T) {
+	func9 := func(*DataSet) *Result {
+		return &Result{Err: nil, StatusCode: 10000, StatusMsg: "too old"}
+	}
+	err := NewFlow().Do(func9).Run()
+	var statusErr *StatusError
+	if !errors.As(err, &statusErr) || statusErr.StatusCode != 10000 || statusErr.StatusMsg != "too old" {
+		t.Fatalf("got %v", err)
+	}
+	if !strings.Contains(err.Error(), "10000") || !strings.Contains(err.Error(), "too old") {
+		t.Errorf("the error is %q", err)
+	}
+}
+
+func TestRunReturnsTheErrOfTheResult(t *testing.T) {
+	if err := NewFlow().Do(fail).Run(); err != errTest {
+		t.Errorf("got %v", err)
+	}
+	if err := NewFlow().Do(ok).Run(); err != nil {
+		t.Errorf("got %v", err)
+	}
+	if err := NewFlow().If(holds, fail).Run(); err != errTest {
+		t.Errorf("the ElseFlowEngine got %v", err)
+	}
+}
+
+func TestRunOnlyRunsTheNodesWithTheNotes(t *testing.T) {
+	c := newCalls()
+	flow := NewFlow().
+		Do(c.fn("step1", nil)).SetNote("step1").
+		Do(c.fn("step2", nil)).SetNote("step2").
+		Do(c.fn("unnamed", nil)).
+		Do(c.fn("step3", nil)).SetNote("step3")
+	if result := flow.RunOnly("step2", ""); result.Err != nil {
+		t.Fatal(result.Err)
+	}
+	if got := c.sequence(); !reflect.DeepEqual(got, []string{"step2"}) {
+		t.Errorf("calls %v", got)
+	}
+	for _, node := range flow.nodes {
+		if node.GetShouldSkip() {
+			t.Errorf("%q is still skipped", node.GetNote())
+		}
+	}
+	flow.Reset().Wait()
+	if c.count("step1") != 1 || c.count("unnamed") != 1 || c.count("step3") != 1 {
+		t.Errorf("calls %v after RunOnly", c.sequence())
+	}
+}
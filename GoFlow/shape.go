@@ -0,0 +1,130 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// TestingT is the part of *testing.T used by AssertShape.
+type TestingT interface {
+	Helper()
+	Errorf(format string, args ...interface{})
+}
+
+// IWalker is what can be walked through, both FlowEngine and ElseFlowEngine.
+type IWalker interface {
+	Walk(visitor func(index int, node IBasicFlowNode) bool)
+}
+
+// ShapeStep describes a node in the shape of a flow. Count is -1 and Note is empty if they are not to be compared.
+type ShapeStep struct {
+	Kind  string
+	Count int
+	Note  string
+}
+
+func (s ShapeStep) String() string {
+	res := s.Kind
+	if s.Count >= 0 {
+		res += "(" + strconv.Itoa(s.Count) + ")"
+	}
+	if s.Note != "" {
+		res += "[" + s.Note + "]"
+	}
+	return res
+}
+
+func (s ShapeStep) matches(actual ShapeStep) bool {
+	return s.Kind == actual.Kind && (s.Count < 0 || s.Count == actual.Count) && (s.Note == "" || s.Note == actual.Note)
+}
+
+func shapeKind(nodeType NodeType) string {
+	if nodeType == NormalNodeType {
+		return "do"
+	}
+	return strings.ToLower(nodeType.String())
+}
+
+// Shape describes the nodes of the flow in order, such as "prepare(1) -> if(2)[check] -> else(1) -> parallel(3)", that
+// is, the kind of each node, followed by the number of functors and the note if it has one.
+func Shape(flow IWalker) []ShapeStep {
+	steps := make([]ShapeStep, 0)
+	flow.Walk(func(index int, node IBasicFlowNode) bool {
+		steps = append(steps, ShapeStep{Kind: shapeKind(node.GetNodeType()), Count: node.GetFunctorCount(), Note: node.GetNote()})
+		return true
+	})
+	return steps
+}
+
+// ParseShape parses the description of a shape. The number of functors and the note can be left out of a step.
+func ParseShape(shape string) ([]ShapeStep, error) {
+	steps := make([]ShapeStep, 0)
+	if strings.TrimSpace(shape) == "" {
+		return steps, nil
+	}
+	for _, item := range strings.Split(shape, "->") {
+		step := ShapeStep{Count: -1}
+		item = strings.TrimSpace(item)
+		if i := strings.Index(item, "["); i >= 0 {
+			if !strings.HasSuffix(item, "]") {
+				return nil, fmt.Errorf("unclosed note in %q", item)
+			}
+			step.Note = item[i+1 : len(item)-1]
+			item = item[:i]
+		}
+		if i := strings.Index(item, "("); i >= 0 {
+			if !strings.HasSuffix(item, ")") {
+				return nil, fmt.Errorf("unclosed count in %q", item)
+			}
+			count, err := strconv.Atoi(item[i+1 : len(item)-1])
+			if err != nil {
+				return nil, fmt.Errorf("bad count in %q: %v", item, err)
+			}
+			step.Count = count
+			item = item[:i]
+		}
+		if item == "" {
+			return nil, fmt.Errorf("empty step in %q", shape)
+		}
+		step.Kind = strings.ToLower(item)
+		steps = append(steps, step)
+	}
+	return steps, nil
+}
+
+func joinShape(steps []ShapeStep) string {
+	items := make([]string, 0, len(steps))
+	for _, step := range steps {
+		items = append(items, step.String())
+	}
+	return strings.Join(items, " -> ")
+}
+
+// AssertShape reports an error to t if the flow doesn't have the expected shape, listing the steps which differ.
+func AssertShape(t TestingT, flow IWalker, expected string) bool {
+	t.Helper()
+	want, err := ParseShape(expected)
+	if err != nil {
+		t.Errorf("bad shape: %v", err)
+		return false
+	}
+	got := Shape(flow)
+
+	diffs := make([]string, 0)
+	for i := 0; i < len(want) || i < len(got); i++ {
+		switch {
+		case i >= len(got):
+			diffs = append(diffs, fmt.Sprintf("  #%d: expected %s, got nothing", i, want[i]))
+		case i >= len(want):
+			diffs = append(diffs, fmt.Sprintf("  #%d: expected nothing, got %s", i, got[i]))
+		case !want[i].matches(got[i]):
+			diffs = append(diffs, fmt.Sprintf("  #%d: expected %s, got %s", i, want[i], got[i]))
+		}
+	}
+	if len(diffs) == 0 {
+		return true
+	}
+	t.Errorf("flow shape mismatch\n  expected: %s\n  actual:   %s\n%s", joinShape(want), joinShape(got), strings.Join(diffs, "\n"))
+	return false
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// recordingT keeps the errors instead of failing the test.
+type recordingT struct {
+	errors []string
+}
+
+func (r *recordingT) Helper() {}
+
+func (r *recordingT) Errorf(format string, args ...interface{}) {
+	r.errors = append(r.errors, fmt.Sprintf(format, args...))
+}
+
+func shapedFlow() *FlowEngine {
+	return NewFlow().Prepare(InputParam{}, PrepareData).
+		If(holds, ok).SetNote("cond").
+		Else(ok, ok).
+		Parallel(ok, ok, ok)
+}
+
+func TestAssertShapeMatches(t *testing.T) {
+	AssertShape(t, shapedFlow(), "prepare -> if[cond] -> else(2) -> parallel(3)")
+	AssertShape(t, shapedFlow(), "prepare(1) -> if(1)[cond] -> else -> parallel")
+}
+
+func TestAssertShapeReportsADiff(t *testing.T) {
+	recorder := new(recordingT)
+	reordered := NewFlow().Prepare(InputParam{}, PrepareData).Parallel(ok, ok, ok).If(holds, ok).SetNote("cond").Else(ok, ok)
+	if AssertShape(recorder, reordered, "prepare -> if[cond] -> else(2) -> parallel(3)") {
+		t.Fatal("a reordered flow matches")
+	}
+	if len(recorder.errors) != 1 {
+		t.Fatalf("errors %v", recorder.errors)
+	}
+	message := recorder.errors[0]
+	for _, want := range []string{
+		"expected: prepare -> if[cond] -> else(2) -> parallel(3)",
+		"actual:   prepare(1) -> parallel(3) -> if(1)[cond] -> else(2)",
+		"#1: expected if[cond], got parallel(3)",
+		"#3: expected parallel(3), got else(2)",
+	} {
+		if !strings.Contains(message, want) {
+			t.Errorf("%q isn't in\n%s", want, message)
+		}
+	}
+}
+
+func TestAssertShapeReportsABadShape(t *testing.T) {
+	recorder := new(recordingT)
+	if AssertShape(recorder, shapedFlow(), "prepare -> if[cond") || len(recorder.errors) != 1 {
+		t.Errorf("errors %v", recorder.errors)
+	}
+}
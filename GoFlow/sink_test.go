@@ -0,0 +1,117 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// stuckSink holds the first result until it's released, so that the next ones pile up in the buffer.
+type stuckSink struct {
+	mu      sync.Mutex
+	notes   []string
+	started chan struct{}
+	release chan struct{}
+}
+
+func newStuckSink() *stuckSink {
+	return &stuckSink{started: make(chan struct{}), release: make(chan struct{})}
+}
+
+func (s *stuckSink) sink(note string, nodeType NodeType, result *Result) {
+	s.mu.Lock()
+	s.notes = append(s.notes, note)
+	first := len(s.notes) == 1
+	s.mu.Unlock()
+	if first {
+		close(s.started)
+		<-s.release
+	}
+}
+
+// flow has five nodes, the second of which waits for the sink to get stuck on the first.
+func (s *stuckSink) flow(policy SinkPolicy) *FlowEngine {
+	flow := NewFlow().SetAsyncResultSink(s.sink, 1, policy).
+		Do(ok).SetNote("n0").
+		Do(func(*DataSet) *Result {
+			<-s.started
+			return nil
+		}).SetNote("n1")
+	for _, note := range []string{"n2", "n3", "n4"} {
+		flow.Do(ok).SetNote(note)
+	}
+	return flow
+}
+
+func TestAsyncResultSinkDropsTheNewest(t *testing.T) {
+	s := newStuckSink()
+	flow := s.flow(SinkDropNewest)
+	flow.Wait()
+	close(s.release)
+	if dropped := flow.FlushResultSink(); dropped != 3 {
+		t.Errorf("dropped %d", dropped)
+	}
+	if !reflect.DeepEqual(s.notes, []string{"n0", "n1"}) {
+		t.Errorf("the sink got %v", s.notes)
+	}
+}
+
+func TestAsyncResultSinkDropsTheOldest(t *testing.T) {
+	s := newStuckSink()
+	flow := s.flow(SinkDropOldest)
+	flow.Wait()
+	close(s.release)
+	if dropped := flow.FlushResultSink(); dropped != 3 {
+		t.Errorf("dropped %d", dropped)
+	}
+	if !reflect.DeepEqual(s.notes, []string{"n0", "n4"}) {
+		t.Errorf("the sink got %v", s.notes)
+	}
+}
+
+func TestAsyncResultSinkBlocksWithoutLosingResults(t *testing.T) {
+	var notes []string
+	slow := func(note string, nodeType NodeType, result *Result) {
+		time.Sleep(time.Millisecond)
+		notes = append(notes, note)
+	}
+	flow := NewFlow().SetAsyncResultSink(slow, 1, SinkBlock)
+	want := []string{"a", "b", "c", "d", "e", "f"}
+	for _, note := range want {
+		flow.Do(ok).SetNote(note)
+	}
+	flow.Wait()
+	if dropped := flow.FlushResultSink(); dropped != 0 {
+		t.Errorf("dropped %d", dropped)
+	}
+	if !reflect.DeepEqual(notes, want) {
+		t.Errorf("the sink got %v", notes)
+	}
+}
+
+func TestAsyncResultSinkSurvivesAPanic(t *testing.T) {
+	logged := captureLog(t)
+	var notes []string
+	sink := func(note string, nodeType NodeType, result *Result) {
+		if note == "b" {
+			panic("sink is down")
+		}
+		notes = append(notes, note)
+	}
+	flow := NewFlow().SetAsyncResultSink(sink, 1, SinkBlock).
+		Do(ok).SetNote("a").
+		Do(ok).SetNote("b").
+		Do(ok).SetNote("c")
+	flow.Wait()
+	if dropped := flow.FlushResultSink(); dropped != 1 {
+		t.Errorf("dropped %d", dropped)
+	}
+	if !reflect.DeepEqual(notes, []string{"a", "c"}) {
+		t.Errorf("the sink got %v", notes)
+	}
+	if !strings.Contains(logged.String(), "sink is down") {
+		t.Errorf("the panic isn't logged: %q", logged.String())
+	}
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestSkipIfSeesTheResultSoFar(t *testing.T) {
+	above := func(code int64) ISkipFunc {
+		return func(result *Result) bool { return result.StatusCode > code }
+	}
+	run := func(code int64) *calls {
+		c := newCalls()
+		NewFlow().SetFailurePredicate(func(result *Result) bool { return result.Err != nil }).
+			Parallel(status(code)).
+			Do(c.fn("guarded", nil)).SkipIf(above(2)).
+			Do(c.fn("after", nil)).
+			Wait()
+		return c
+	}
+	if c := run(1); c.count("guarded") != 1 || c.count("after") != 1 {
+		t.Errorf("calls %v below the bound", c.sequence())
+	}
+	if c := run(3); c.count("guarded") != 0 || c.count("after") != 1 {
+		t.Errorf("calls %v above the bound", c.sequence())
+	}
+}
+
+func TestSkipIfIsCheckedEachRun(t *testing.T) {
+	c := newCalls()
+	skip := true
+	flow := NewFlow().Do(c.fn("guarded", nil)).SkipIf(func(*Result) bool { return skip })
+	flow.Wait()
+	skip = false
+	flow.Reset().Wait()
+	if c.count("guarded") != 1 {
+		t.Errorf("calls %v", c.sequence())
+	}
+}
+
+func TestSkipIfDoesNotOverrideTheFailureShortCircuit(t *testing.T) {
+	c := newCalls()
+	result := NewFlow().Do(fail).Do(c.fn("after", nil)).SkipIf(func(*Result) bool { return false }).Wait()
+	if result.Err != errTest || c.count("after") != 0 {
+		t.Errorf("got %v after %v", result.Err, c.sequence())
+	}
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// snapshotResult keeps the fields every Result has, with Err as its text since errors cannot be unmarshaled.
+type snapshotResult struct {
+	Err        string `json:",omitempty"`
+	StatusCode int64
+	StatusMsg  string
+}
+
+type flowSnapshot struct {
+	ExecutionID string
+	Position    int
+	Jumps       int
+	Result      snapshotResult
+	Empty       bool `json:",omitempty"`
+	NodeTypes   []NodeType
+	Skips       []bool
+	Traces      []NodeTrace
+	Results     []*snapshotResult
+}
+
+func newSnapshotResult(result *Result) *snapshotResult {
+	if result == nil {
+		return nil
+	}
+	snapshot := &snapshotResult{StatusCode: result.StatusCode, StatusMsg: result.StatusMsg}
+	if result.Err != nil {
+		snapshot.Err = result.Err.Error()
+	}
+	return snapshot
+}
+
+func (s *snapshotResult) result() *Result {
+	if s == nil {
+		return nil
+	}
+	result := &Result{StatusCode: s.StatusCode, StatusMsg: s.StatusMsg}
+	if s.Err != "" {
+		result.Err = errors.New(s.Err)
+	}
+	return result
+}
+
+// Snapshot saves where the flow is, the result so far, which branches are skipped and what the nodes which ran have
+// left behind, but neither the data nor the functors. Taken while a node runs, the position is that node, so it runs
+// again after Restore. Errors are kept as their text.
+func (f *FlowEngine) Snapshot() ([]byte, error) {
+	snapshot := flowSnapshot{
+		ExecutionID: f.executionID,
+		Position:    f.position,
+		Jumps:       f.jumps,
+		Result:      *newSnapshotResult(*f.result),
+		Empty:       *f.result == f.startResult,
+		NodeTypes:   make([]NodeType, 0, len(f.nodes)),
+		Skips:       make([]bool, 0, len(f.nodes)),
+		Traces:      make([]NodeTrace, 0, len(f.traces)),
+		Results:     make([]*snapshotResult, 0, len(f.traces)),
+	}
+	for _, node := range f.nodes {
+		snapshot.NodeTypes = append(snapshot.NodeTypes, node.GetNodeType())
+		snapshot.Skips = append(snapshot.Skips, node.GetShouldSkip())
+	}
+	for _, trace := range f.traces {
+		snapshot.Results = append(snapshot.Results, newSnapshotResult(trace.Result))
+		trace.Result = nil
+		snapshot.Traces = append(snapshot.Traces, trace)
+	}
+	return json.Marshal(snapshot)
+}
+
+// Restore brings back the state saved by Snapshot onto a flow built the same way, and the next Wait goes on from where
+// the snapshot was taken. The data has to be restored by the caller, and the compensations of the nodes which ran
+// before the snapshot are lost.
+func (f *FlowEngine) Restore(snapshot []byte) error {
+	var saved flowSnapshot
+	if err := json.Unmarshal(snapshot, &saved); err != nil {
+		return err
+	}
+	if len(saved.NodeTypes) != len(f.nodes) {
+		return fmt.Errorf("snapshot of %d nodes, but the flow has %d", len(saved.NodeTypes), len(f.nodes))
+	}
+	for i, node := range f.nodes {
+		if node.GetNodeType() != saved.NodeTypes[i] {
+			return fmt.Errorf("node %d is %s in the snapshot, but %s in the flow", i, saved.NodeTypes[i], node.GetNodeType())
+		}
+	}
+	if len(saved.Results) != len(saved.Traces) {
+		return errors.New("snapshot is corrupted")
+	}
+
+	for i, node := range f.nodes {
+		node.SetShouldSkip(saved.Skips[i])
+	}
+	for i := range saved.Traces {
+		saved.Traces[i].Result = saved.Results[i].result()
+	}
+	f.executionID, f.position, f.jumps, f.traces = saved.ExecutionID, saved.Position, saved.Jumps, saved.Traces
+	*f.result = saved.Result.result()
+	if saved.Empty {
+		*f.result = f.startResult
+	}
+	f.restored = true
+	return nil
+}
+
+func (e *ElseFlowEngine) Snapshot() ([]byte, error) {
+	return e.invoker.Snapshot()
+}
+
+func (e *ElseFlowEngine) Restore(snapshot []byte) error {
+	return e.invoker.Restore(snapshot)
+}
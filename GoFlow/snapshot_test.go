@@ -0,0 +1,80 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRestoredSnapshotResumesAtTheNode(t *testing.T) {
+	var snapshot []byte
+	build := func(c *calls, checkpoint func(flow *FlowEngine) ICallable) *FlowEngine {
+		flow := NewFlow()
+		flow.Do(c.fn("load", nil)).SetNote("load").
+			If(fails, c.fn("cached", nil)).
+			Else(c.fn("fetch", nil)).
+			Do(checkpoint(flow)).SetNote("charge").
+			Do(c.fn("ship", nil)).SetNote("ship")
+		return flow
+	}
+
+	first := newCalls()
+	crashed := build(first, func(flow *FlowEngine) ICallable {
+		return func(*DataSet) *Result {
+			var err error
+			if snapshot, err = flow.Snapshot(); err != nil {
+				t.Fatal(err)
+			}
+			// The process goes down here
+			return failed(errTest)
+		}
+	})
+	crashed.Wait()
+	if !reflect.DeepEqual(first.sequence(), []string{"load", "fetch"}) {
+		t.Fatalf("calls %v", first.sequence())
+	}
+
+	second := newCalls()
+	resumed := build(second, func(*FlowEngine) ICallable { return second.fn("charge", nil) })
+	if err := resumed.Restore(snapshot); err != nil {
+		t.Fatal(err)
+	}
+	if result := resumed.Wait(); result.Err != nil {
+		t.Fatal(result.Err)
+	}
+	if got := second.sequence(); !reflect.DeepEqual(got, []string{"charge", "ship"}) {
+		t.Errorf("calls %v after the restore", got)
+	}
+	report := resumed.Report()
+	if len(report.Nodes) != 5 || report.Nodes[0].Note != "load" {
+		t.Errorf("the traces before the snapshot are lost: %+v", report.Nodes)
+	}
+}
+
+func TestRestoreOntoAnotherFlow(t *testing.T) {
+	snapshot, err := NewFlow().Do(ok).Do(ok).Snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := NewFlow().Do(ok).Restore(snapshot); err == nil {
+		t.Error("restored onto a flow with fewer nodes")
+	}
+	if err := NewFlow().Do(ok).If(holds, ok).Restore(snapshot); err == nil {
+		t.Error("restored onto a flow with other nodes")
+	}
+}
+
+func TestRestoreKeepsTheEmptyStartingResult(t *testing.T) {
+	snapshot, err := NewFlow().SetFailurePredicate(okIs200).Do(ok).Snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := newCalls()
+	flow := NewFlow().SetFailurePredicate(okIs200).Do(c.fn("resumed", nil))
+	if err := flow.Restore(snapshot); err != nil {
+		t.Fatal(err)
+	}
+	flow.Wait()
+	if c.count("resumed") != 1 {
+		t.Error("the restored empty result is taken for a failure")
+	}
+}
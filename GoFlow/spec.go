@@ -0,0 +1,175 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+)
+
+// FlowSpec describes a flow so that it can be stored as JSON, the functors and the conditions are referred to by name.
+type FlowSpec struct {
+	Name  string     `json:"name,omitempty"`
+	Steps []StepSpec `json:"steps"`
+}
+
+// StepSpec describes a node. Type is one of "do", "doall", "return", "if", "elseif", "else", "for" and "parallel", and
+// Times is the loop count of "for".
+type StepSpec struct {
+	Type      string   `json:"type"`
+	Note      string   `json:"note,omitempty"`
+	Condition string   `json:"condition,omitempty"`
+	Functors  []string `json:"functors,omitempty"`
+	Times     int      `json:"times,omitempty"`
+}
+
+// BuildFromSpec builds the flow described by spec, the names of the functors and the conditions are looked up in the
+// registries.
+func BuildFromSpec(spec FlowSpec, registry map[string]ICallable, conds map[string]IBoolFunc) (*FlowEngine, error) {
+	flow := NewFlowEngine().SetName(spec.Name)
+	var branch *ElseFlowEngine
+	for i, step := range spec.Steps {
+		functors := make([]ICallable, 0, len(step.Functors))
+		for _, name := range step.Functors {
+			functor, ok := registry[name]
+			if !ok {
+				return nil, fmt.Errorf("step %d (%s): unknown functor %q", i, step.Type, name)
+			}
+			functors = append(functors, functor)
+		}
+		var condition IBoolFunc
+		if step.Type == "if" || step.Type == "elseif" {
+			var ok bool
+			if condition, ok = conds[step.Condition]; !ok {
+				return nil, fmt.Errorf("step %d (%s): unknown condition %q", i, step.Type, step.Condition)
+			}
+		}
+		if (step.Type == "elseif" || step.Type == "else") && branch == nil {
+			return nil, fmt.Errorf("step %d (%s): not after if or elseif", i, step.Type)
+		}
+
+		switch step.Type {
+		case "do":
+			flow.Do(functors...)
+		case "doall":
+			flow.DoAll(functors...)
+		case "return":
+			flow.Return(functors...)
+		case "for":
+			flow.For(step.Times, functors...)
+		case "parallel":
+			flow.Parallel(functors...)
+		case "if":
+			branch = flow.If(condition, functors...)
+		case "elseif":
+			branch.ElseIf(condition, functors...)
+		case "else":
+			branch.Else(functors...)
+		default:
+			return nil, fmt.Errorf("step %d: unknown type %q", i, step.Type)
+		}
+		if step.Type != "if" && step.Type != "elseif" {
+			branch = nil
+		}
+		flow.SetNote(step.Note)
+	}
+	flow.spec = &FlowSpec{Name: spec.Name, Steps: append([]StepSpec(nil), spec.Steps...)}
+	return flow, nil
+}
+
+// ToSpec describes the flow with the names of its functors and conditions in the registries. The functors are told
+// apart by their code, so the closures made by the same function literal can't be.
+func (f *FlowEngine) ToSpec(registry map[string]ICallable, conds map[string]IBoolFunc) (FlowSpec, error) {
+	functorNames := make(map[uintptr]string, len(registry))
+	for _, name := range sortedNames(registry) {
+		if _, ok := functorNames[funcPointer(registry[name])]; !ok {
+			functorNames[funcPointer(registry[name])] = name
+		}
+	}
+	condNames := make(map[uintptr]string, len(conds))
+	for _, name := range sortedNames(conds) {
+		if _, ok := condNames[funcPointer(conds[name])]; !ok {
+			condNames[funcPointer(conds[name])] = name
+		}
+	}
+
+	spec := FlowSpec{Name: f.name, Steps: make([]StepSpec, 0, len(f.nodes))}
+	for i, node := range f.nodes {
+		step := StepSpec{Type: shapeKind(node.GetNodeType()), Note: node.GetNote()}
+		var functors []ICallable
+		var condition IBoolFunc
+		switch n := node.(type) {
+		case *NormalNode:
+			functors = n.Functors
+			if n.Dynamic || n.Provider != nil {
+				return FlowSpec{}, fmt.Errorf("node %d: dynamic functors are not supported", i)
+			}
+			if n.RunAll && n.Return {
+				return FlowSpec{}, fmt.Errorf("node %d: do all with return is not supported", i)
+			}
+			if n.RunAll {
+				step.Type = "doall"
+			}
+			if n.Return {
+				step.Type = "return"
+			}
+		case *ForNode:
+			functors, step.Times = n.Functors, n.Times
+		case *ParallelNode:
+			if n.Guards != nil || n.Conditional {
+				return FlowSpec{}, fmt.Errorf("node %d: conditional parallel is not supported", i)
+			}
+			if n.Reducer != nil {
+				return FlowSpec{}, fmt.Errorf("node %d: parallel with a reducer is not supported", i)
+			}
+			functors = n.Functors
+		case *IfNode:
+			if n.ByStatus || n.CheckedCondition != nil {
+				return FlowSpec{}, fmt.Errorf("node %d: if by status or with a checked condition is not supported", i)
+			}
+			functors, condition = n.Functors, n.Condition
+		case *ElseIfNode:
+			if n.CheckedCondition != nil {
+				return FlowSpec{}, fmt.Errorf("node %d: else if with a checked condition is not supported", i)
+			}
+			functors, condition = n.Functors, n.Condition
+		case *ElseNode:
+			functors = n.Functors
+		default:
+			return FlowSpec{}, fmt.Errorf("node %d: %s is not supported", i, node.GetNodeType())
+		}
+		if condition != nil {
+			name, ok := condNames[funcPointer(condition)]
+			if !ok {
+				return FlowSpec{}, fmt.Errorf("node %d (%s): condition not in the registry", i, step.Type)
+			}
+			step.Condition = name
+		}
+		for j, functor := range functors {
+			name, ok := functorNames[funcPointer(functor)]
+			if !ok {
+				return FlowSpec{}, fmt.Errorf("node %d (%s): functor %d not in the registry", i, step.Type, j)
+			}
+			step.Functors = append(step.Functors, name)
+		}
+		spec.Steps = append(spec.Steps, step)
+	}
+	return spec, nil
+}
+
+func funcPointer(fn interface{}) uintptr {
+	if reflect.ValueOf(fn).IsNil() {
+		return 0
+	}
+	return reflect.ValueOf(fn).Pointer()
+}
+
+// sortedNames keeps the names picked by ToSpec the same when a function is registered more than once.
+func sortedNames(registry interface{}) []string {
+	keys := reflect.ValueOf(registry).MapKeys()
+	names := make([]string, 0, len(keys))
+	for _, key := range keys {
+		names = append(names, key.String())
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var (
+	specRegistry = map[string]ICallable{"ok": ok, "fail": fail}
+	specConds    = map[string]IBoolFunc{"holds": holds, "fails": fails}
+)
+
+func TestSpecRoundTrip(t *testing.T) {
+	flow := NewFlow().SetName("order").
+		Do(ok).SetNote("load").
+		DoAll(ok, fail).
+		If(fails, ok).SetNote("cached").
+		ElseIf(holds, ok).
+		Else(fail).
+		For(3, ok).
+		Parallel(ok, ok).
+		Return(ok)
+	spec, err := flow.ToSpec(specRegistry, specConds)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bytes, err := json.Marshal(spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded FlowSpec
+	if err := json.Unmarshal(bytes, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	built, err := BuildFromSpec(decoded, specRegistry, specConds)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(Shape(built), Shape(flow)) {
+		t.Errorf("built %s from %s", joinShape(Shape(built)), joinShape(Shape(flow)))
+	}
+	again, err := built.ToSpec(specRegistry, specConds)
+	if err != nil || !reflect.DeepEqual(again, spec) {
+		t.Errorf("got %+v, %v", again, err)
+	}
+	if built.name != "order" || spec.Steps[5].Times != 3 || spec.Steps[2].Condition != "fails" {
+		t.Errorf("spec %+v", spec)
+	}
+}
+
+func TestBuildFromSpecRejectsUnknownNames(t *testing.T) {
+	cases := map[string]FlowSpec{
+		`unknown functor "missing"`:  {Steps: []StepSpec{{Type: "do", Functors: []string{"missing"}}}},
+		`unknown condition "maybe"`:  {Steps: []StepSpec{{Type: "if", Condition: "maybe"}}},
+		`unknown type "loop"`:        {Steps: []StepSpec{{Type: "loop"}}},
+		`not after if or elseif`:     {Steps: []StepSpec{{Type: "do"}, {Type: "else"}}},
+		`step 1 (do): unknown funct`: {Steps: []StepSpec{{Type: "do"}, {Type: "do", Functors: []string{"x"}}}},
+	}
+	for want, spec := range cases {
+		if _, err := BuildFromSpec(spec, specRegistry, specConds); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("%q: got %v", want, err)
+		}
+	}
+}
+
+func TestToSpecRejectsFunctorsNotInTheRegistry(t *testing.T) {
+	if _, err := NewFlow().Do(setName("x")).ToSpec(specRegistry, specConds); err == nil {
+		t.Error("a closure isn't rejected")
+	}
+	if _, err := NewFlow().Tap(func(*DataSet, *Result) {}).ToSpec(specRegistry, specConds); err == nil {
+		t.Error("an unsupported node isn't rejected")
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+func TestSplitFollowsTheWeights(t *testing.T) {
+	c := newCalls()
+	flow := NewFlow().Split(rand.New(rand.NewSource(1)), []WeightedBranch{
+		{Weight: 1, Functors: []ICallable{c.fn("a", nil)}},
+		{Weight: 0, Functors: []ICallable{c.fn("never", nil)}},
+		{Weight: 3, Functors: []ICallable{c.fn("b", nil)}},
+	})
+	const runs = 4000
+	for i := 0; i < runs; i++ {
+		if result := flow.Reset().Wait(); result.Err != nil {
+			t.Fatal(result.Err)
+		}
+	}
+	if c.count("never") != 0 || c.count("a")+c.count("b") != runs {
+		t.Fatalf("%d a, %d b and %d never", c.count("a"), c.count("b"), c.count("never"))
+	}
+	if share := float64(c.count("a")) / runs; share < 0.22 || share > 0.28 {
+		t.Errorf("a ran in %.3f of the runs for a quarter of the weight", share)
+	}
+}
+
+func TestSplitIsDeterministicWithASeed(t *testing.T) {
+	choices := func() []int {
+		flow := NewFlow().Split(rand.New(rand.NewSource(7)), []WeightedBranch{
+			{Weight: 1, Functors: []ICallable{ok}},
+			{Weight: 1, Functors: []ICallable{ok}},
+		})
+		var chosen []int
+		for i := 0; i < 20; i++ {
+			flow.Reset().Wait()
+			chosen = append(chosen, flow.nodes[0].(*SplitNode).Chosen)
+		}
+		return chosen
+	}
+	first, second := choices(), choices()
+	for i := range first {
+		if first[i] != second[i] {
+			t.Fatalf("the runs chose %v and %v", first, second)
+		}
+	}
+}
+
+func TestSplitWithoutWeightIsInvalid(t *testing.T) {
+	flow := NewFlow().Split(nil, []WeightedBranch{{Weight: 0, Functors: []ICallable{ok}}})
+	errs := flow.Validate()
+	if len(errs) != 1 || !strings.Contains(errs[0].Error(), "positive weight") {
+		t.Errorf("errors %v", errs)
+	}
+}
+
+func TestSplitRunsTheChosenBranchUntilAFailure(t *testing.T) {
+	c := newCalls()
+	result := NewFlow().Split(nil, []WeightedBranch{
+		{Weight: 1, Functors: []ICallable{c.fn("first", nil), fail, c.fn("after", nil)}},
+	}).Wait()
+	if result.Err != errTest || c.count("first") != 1 || c.count("after") != 0 {
+		t.Errorf("got %v after %v", result.Err, c.sequence())
+	}
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"strconv"
+	"sync"
+)
+
+var statusNames = struct {
+	sync.RWMutex
+	named map[int64]string
+}{named: make(map[int64]string)}
+
+// RegisterStatus names the status code, so that StatusError, the traces and the spans show the name instead of the
+// number. Registering a code again renames it.
+func RegisterStatus(code int64, name string) {
+	statusNames.Lock()
+	defer statusNames.Unlock()
+	statusNames.named[code] = name
+}
+
+// StatusName returns the name registered for the status code, or the number if there's none.
+func StatusName(code int64) string {
+	statusNames.RLock()
+	defer statusNames.RUnlock()
+	if name, ok := statusNames.named[code]; ok {
+		return name
+	}
+	return strconv.FormatInt(code, 10)
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestTraceShowsTheRegisteredStatus(t *testing.T) {
+	RegisterStatus(4290, "RATE_LIMITED")
+	_, traces := NewFlow().Do(status(4290)).WaitWithTrace()
+	if len(traces) != 1 || traces[0].Status != "RATE_LIMITED" {
+		t.Errorf("traced %+v", traces)
+	}
+	_, traces = NewFlow().Do(status(4291)).WaitWithTrace()
+	if len(traces) != 1 || traces[0].Status != "4291" {
+		t.Errorf("an unknown code is traced as %+v", traces)
+	}
+}
+
+func TestStatusErrorShowsTheRegisteredStatus(t *testing.T) {
+	RegisterStatus(4292, "AUTH_FAILED")
+	if err := NewFlow().Do(status(4292)).Run(); err == nil || err.Error() != "status AUTH_FAILED: " {
+		t.Errorf("got %v", err)
+	}
+	RegisterStatus(4292, "FORBIDDEN")
+	if name := StatusName(4292); name != "FORBIDDEN" {
+		t.Errorf("renamed to %q", name)
+	}
+}
@@ -5,6 +5,7 @@ import "context"
 //************************DEFINE YOUR STRUCTURE BELOW****************************//
 // The name starts with underscore means replaceable.
 // [IMPORTANT] Notice that even though Result can be replace with other type, the Err, StatusCode and StatusMsg must be provided
+// [IMPORTANT] The Ctx of DataSet must be provided as well, the flow stops once it's done
 
 type DataSet struct {
 	Ctx  context.Context
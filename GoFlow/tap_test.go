@@ -0,0 +1,34 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestTapCannotChangeTheResult(t *testing.T) {
+	onlyErrors := func(result *Result) bool { return result != nil && result.Err != nil }
+	var seen int64
+	result := NewFlow().SetFailurePredicate(onlyErrors).
+		Parallel(status(5)).
+		Tap(func(data *DataSet, result *Result) {
+			seen = result.StatusCode
+			result.StatusCode, result.StatusMsg = 0, "changed by the tap"
+		}).
+		Wait()
+	if seen != 5 {
+		t.Errorf("the tap saw %d", seen)
+	}
+	if result.StatusCode != 5 || result.StatusMsg != "" {
+		t.Errorf("the tap changed the result into %+v", result)
+	}
+}
+
+func TestTapSeesTheDataAndIsShortCircuited(t *testing.T) {
+	c := newCalls()
+	tap := func(data *DataSet, result *Result) {
+		c.record("tap " + data.Name)
+	}
+	NewFlow().Do(setName("Tom")).Tap(tap).Do(fail).Tap(tap).Wait()
+	if c.count("tap Tom") != 1 || len(c.sequence()) != 1 {
+		t.Errorf("calls %v", c.sequence())
+	}
+}
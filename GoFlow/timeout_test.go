@@ -0,0 +1,72 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestSetTimeoutStopsASlowNode(t *testing.T) {
+	c := newCalls()
+	slow := func(*DataSet) *Result {
+		time.Sleep(100 * time.Millisecond)
+		return nil
+	}
+	start := time.Now()
+	result := NewFlow().Do(slow).SetNote("slow").SetTimeout(10 * time.Millisecond).Do(c.fn("after", nil)).Wait()
+	if elapsed := time.Since(start); elapsed >= 100*time.Millisecond {
+		t.Errorf("waited %v for the slow node", elapsed)
+	}
+	var timeoutErr *NodeTimeoutError
+	if !errors.As(result.Err, &timeoutErr) || timeoutErr.GetNote() != "slow" || timeoutErr.Timeout != 10*time.Millisecond {
+		t.Fatalf("got %v", result.Err)
+	}
+	if c.count("after") != 0 {
+		t.Error("the chain goes on after the timeout")
+	}
+}
+
+func TestSetTimeoutCoversTheWholeFanOut(t *testing.T) {
+	slow := func(*DataSet) *Result {
+		time.Sleep(100 * time.Millisecond)
+		return nil
+	}
+	result := NewFlow().Parallel(ok, slow).SetTimeout(10 * time.Millisecond).Wait()
+	if !errors.Is(result.Err, ErrNodeTimeout) {
+		t.Errorf("got %v", result.Err)
+	}
+}
+
+func TestNodeInTimeKeepsItsWrites(t *testing.T) {
+	flow := NewFlow().Do(fail).Fallback(setName("recovered")).SetTimeout(time.Second).
+		If(holds, ok).SetTimeout(time.Second).Else(setName("else"))
+	if result := flow.Wait(); result.Err != nil {
+		t.Fatal(result.Err)
+	}
+	if flow.data.Name != "recovered" {
+		t.Errorf("data %q", flow.data.Name)
+	}
+}
+
+// Run with -race: the node given up on writes to the data and the result in the background while the flow reads them.
+func TestTimedOutNodeDropsItsWrites(t *testing.T) {
+	release, done := make(chan struct{}), make(chan struct{})
+	slow := func(data *DataSet) *Result {
+		<-release
+		data.Name = "late"
+		close(done)
+		return nil
+	}
+	flow := NewFlow().Do(fail).Fallback(slow).SetTimeout(10 * time.Millisecond).
+		Do(setName("after"))
+	result := flow.Wait()
+	close(release)
+	name := flow.data.Name
+	<-done
+	if !errors.Is(result.Err, ErrNodeTimeout) || !errors.Is((*flow.result).Err, ErrNodeTimeout) {
+		t.Fatalf("got %v", result.Err)
+	}
+	if name != "" || flow.data.Name != "" {
+		t.Errorf("the late write got through: %q", flow.data.Name)
+	}
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestWaitWithTraceFollowsTheExecutionOrder(t *testing.T) {
+	flow := NewFlow().
+		Do(ok).SetNote("load").
+		If(fails, ok).SetNote("cached").
+		ElseIf(holds, status(5)).SetNote("fetch").
+		Else(ok).SetNote("default")
+	result, traces := flow.WaitWithTrace()
+	if result.StatusCode != 5 {
+		t.Fatalf("got %+v", result)
+	}
+	if len(traces) != 4 {
+		t.Fatalf("%d traces", len(traces))
+	}
+	for i, want := range []struct {
+		note     string
+		nodeType NodeType
+		skipped  bool
+	}{
+		{"load", NormalNodeType, false},
+		{"cached", IfNodeType, false},
+		{"fetch", ElseIfNodeType, false},
+		{"default", ElseNodeType, true},
+	} {
+		trace := traces[i]
+		if trace.Note != want.note || trace.NodeType != want.nodeType || trace.Skipped != want.skipped {
+			t.Errorf("trace %d: %+v", i, trace)
+		}
+		if trace.End.Before(trace.Start) {
+			t.Errorf("trace %d ends before it starts", i)
+		}
+	}
+	if traces[0].Result != nil && traces[0].Result.StatusCode != 0 {
+		t.Errorf("the first node left %+v", traces[0].Result)
+	}
+	if traces[2].Result == nil || traces[2].Result.StatusCode != 5 {
+		t.Errorf("the ElseIf left %+v", traces[2].Result)
+	}
+}
+
+func TestWaitWithTraceSnapshotsTheResult(t *testing.T) {
+	flow := NewFlow().Do(status(1)).SetNote("first").Do(ok).SetNote("second")
+	result, traces := flow.WaitWithTrace()
+	if len(traces) != 2 || traces[0].Result == nil || traces[0].Result.StatusCode != 1 {
+		t.Fatalf("traces %+v", traces)
+	}
+	if traces[0].Result == result {
+		t.Error("the trace shares the result of the flow")
+	}
+	if !traces[1].Skipped {
+		t.Error("the node after the failure isn't skipped")
+	}
+}